@@ -0,0 +1,158 @@
+// Command pinchecksums downloads every catalog entry that has no pinned
+// checksum, checks it against the checksum file upstream publishes where
+// there is one, and prints the Checksums maps to paste into the catalog.
+//
+//	go run ./cmd/pinchecksums [package ID...]
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"vps-panel/internal/services/appstore"
+)
+
+var client = &http.Client{Timeout: 30 * time.Minute}
+
+var sha256Re = regexp.MustCompile(`\b[0-9a-fA-F]{64}\b`)
+
+func main() {
+	only := map[string]bool{}
+	for _, id := range os.Args[1:] {
+		only[id] = true
+	}
+
+	failed := false
+	for _, pkg := range appstore.PortableCatalog {
+		if len(only) > 0 && !only[pkg.ID] {
+			continue
+		}
+		for _, version := range pkg.Versions {
+			platforms := make([]string, 0, len(version.Downloads))
+			for platform := range version.Downloads {
+				if version.Checksums[platform] == "" {
+					platforms = append(platforms, platform)
+				}
+			}
+			if len(platforms) == 0 {
+				continue
+			}
+			sort.Strings(platforms)
+
+			sums := map[string]string{}
+			for _, platform := range platforms {
+				url := version.Downloads[platform]
+				sum, err := pin(url)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s %s %s: %v\n", pkg.ID, version.Version, platform, err)
+					failed = true
+					continue
+				}
+				sums[platform] = sum
+			}
+			if len(sums) == 0 {
+				continue
+			}
+
+			fmt.Printf("// %s %s\nChecksums: map[string]string{\n", pkg.ID, version.Version)
+			for _, platform := range platforms {
+				if sum, ok := sums[platform]; ok {
+					fmt.Printf("\t%q: %q,\n", platform, sum)
+				}
+			}
+			fmt.Println("},")
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// pin downloads url and returns its SHA-256, refusing it when upstream
+// publishes a different checksum
+func pin(url string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download failed: %s", resp.Status)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, resp.Body); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	published, source := publishedSum(url)
+	switch {
+	case published == "":
+		fmt.Fprintf(os.Stderr, "warning: %s: upstream publishes no SHA-256, pinned as downloaded\n", url)
+	case published != sum:
+		return "", fmt.Errorf("sha256 %s does not match %s from %s", sum, published, source)
+	}
+	return sum, nil
+}
+
+// publishedSum looks for the file's SHA-256 in the checksum files upstreams
+// commonly publish next to their downloads
+func publishedSum(url string) (sum, source string) {
+	dir, file := path.Split(url)
+	candidates := []string{
+		url + ".sha256",
+		url + ".sha256sum",
+		dir + "SHASUMS256.txt",
+		dir + "sha256sums.txt",
+		dir + "sha256sum.txt",
+	}
+	for _, candidate := range candidates {
+		if sum := findSum(candidate, file); sum != "" {
+			return sum, candidate
+		}
+	}
+	return "", ""
+}
+
+// findSum returns the SHA-256 listed for file in a checksum file, or the
+// only one in a file covering a single download
+func findSum(url, file string) string {
+	resp, err := client.Get(url)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	var sums []string
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, 1<<20))
+	for scanner.Scan() {
+		line := scanner.Text()
+		sum := sha256Re.FindString(line)
+		if sum == "" {
+			continue
+		}
+		if strings.Contains(line, file) {
+			return strings.ToLower(sum)
+		}
+		sums = append(sums, strings.ToLower(sum))
+	}
+	if len(sums) == 1 && (strings.HasSuffix(url, ".sha256") || strings.HasSuffix(url, ".sha256sum")) {
+		return sums[0]
+	}
+	return ""
+}
@@ -20,7 +20,16 @@ import (
 	"vps-panel/internal/handlers"
 	"vps-panel/internal/middleware"
 	"vps-panel/internal/models"
+	"vps-panel/internal/services/alert"
+	"vps-panel/internal/services/ban"
 	"vps-panel/internal/services/cron"
+	"vps-panel/internal/services/firewall"
+	"vps-panel/internal/services/metrics"
+	"vps-panel/internal/services/monitor"
+	"vps-panel/internal/services/rbac"
+	"vps-panel/internal/services/session"
+	"vps-panel/internal/services/task"
+	"vps-panel/internal/services/terminal"
 	ws "vps-panel/internal/services/websocket"
 )
 
@@ -50,24 +59,58 @@ func main() {
 	// Auto migrate models
 	if err := database.AutoMigrate(
 		&models.User{},
+		&models.Role{},
+		&models.Session{},
 		&models.Setting{},
 		&models.InstalledPackage{},
 		&models.ActivityLog{},
 		&models.CronJob{},
 		&models.FirewallRule{},
+		&models.Ban{},
+		&models.BanWhitelist{},
+		&models.TerminalRecording{},
+		&models.MetricSample{},
+		&models.AlertRule{},
+		&models.AlertChannel{},
+		&models.AlertEvent{},
+		&models.Task{},
 	); err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	// Seed built-in roles
+	rbac.Init()
+
 	// Create default admin user if not exists
 	createDefaultAdmin(cfg)
 
+	// Start sampling system stats
+	monitor.Start(cfg.Monitor.Interval, cfg.Monitor.Collect)
+
 	// Initialize WebSocket hub
 	ws.InitHub()
 
 	// Initialize Cron service
 	cron.Init()
 
+	// Detect firewall backend and reconcile rules
+	firewall.Init()
+
+	// Start brute-force protection
+	ban.Init()
+
+	// Start the terminal session manager and recording retention
+	terminal.Init()
+
+	// Start collecting system stats history
+	metrics.Init()
+
+	// Start evaluating alert rules
+	alert.Init()
+
+	// Fail tasks cut short by a restart and start the task queue
+	task.Init()
+
 	// Setup template engine
 	engine := html.New("./web/templates", ".html")
 	engine.Reload(true)
@@ -89,6 +132,7 @@ func main() {
 
 	// Middleware
 	app.Use(recover.New())
+	app.Use(middleware.RequestMetrics())
 	app.Use(logger.New(logger.Config{
 		Format: "[${time}] ${status} - ${method} ${path} ${latency}\n",
 	}))
@@ -102,14 +146,19 @@ func main() {
 	// Static files
 	app.Static("/static", "./web/static")
 
+	// Reject banned IPs before upgrading
+	app.Use("/ws", middleware.NotBanned())
+
 	// WebSocket upgrade middleware
 	app.Use("/ws", func(c *fiber.Ctx) error {
 		if websocket.IsWebSocketUpgrade(c) {
 			c.Locals("allowed", true)
+			c.Locals("ip", c.IP())
 			return c.Next()
 		}
 		return fiber.ErrUpgradeRequired
 	})
+	app.Use("/ws", middleware.WebSocketAuth())
 
 	// Routes
 	setupRoutes(app, cfg)
@@ -133,7 +182,7 @@ func setupRoutes(app *fiber.App, cfg *config.Config) {
 			token, err := jwt.ParseWithClaims(tokenStr, &middleware.JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
 				return []byte(cfg.JWT.Secret), nil
 			})
-			if err == nil && token.Valid {
+			if err == nil && token.Valid && session.Validate(token.Claims.(*middleware.JWTClaims).ID) {
 				return c.Redirect("/dashboard")
 			}
 		}
@@ -144,115 +193,218 @@ func setupRoutes(app *fiber.App, cfg *config.Config) {
 	})
 
 	// API routes - Public
-	api := app.Group("/api")
+	api := app.Group("/api", middleware.NotBanned())
 	api.Post("/auth/login", handlers.Login)
 
 	// API routes - Protected
-	protected := api.Group("/", middleware.AuthRequired())
+	protected := api.Group("/", middleware.AuthRequired(), middleware.AuditLog())
 	protected.Post("/auth/logout", handlers.Logout)
 	protected.Get("/auth/profile", handlers.GetProfile)
 	protected.Post("/auth/2fa/setup", handlers.Setup2FA)
 	protected.Post("/auth/2fa/verify", handlers.Verify2FA)
 	protected.Post("/auth/2fa/disable", handlers.Disable2FA)
+	protected.Post("/auth/password", handlers.ChangePassword)
+	protected.Get("/auth/sessions", handlers.GetSessions)
+	protected.Delete("/auth/sessions", handlers.RevokeAllSessions)
+	protected.Delete("/auth/sessions/:id", handlers.RevokeSession)
+	protected.Post("/ws/ticket", handlers.IssueWebSocketTicket)
+
+	// User management API
+	usersAPI := protected.Group("/users", middleware.RequirePermission(rbac.UsersManage))
+	usersAPI.Get("/", handlers.GetUsers)
+	usersAPI.Post("/", handlers.CreateUser)
+	usersAPI.Get("/:id", handlers.GetUser)
+	usersAPI.Put("/:id", handlers.UpdateUser)
+	usersAPI.Post("/:id/disable", handlers.SetUserDisabled(true))
+	usersAPI.Post("/:id/enable", handlers.SetUserDisabled(false))
+	usersAPI.Delete("/:id", handlers.DeleteUser)
+	usersAPI.Get("/:id/sessions", handlers.GetUserSessions)
+	usersAPI.Delete("/:id/sessions", handlers.RevokeUserSessions)
+
+	// Audit API
+	auditAPI := protected.Group("/audit", middleware.RequirePermission(rbac.AuditRead))
+	auditAPI.Get("/", handlers.GetAuditLog)
+	auditAPI.Get("/export", handlers.ExportAuditLog)
+
+	// Terminal API
+	terminalAPI := protected.Group("/terminal")
+	terminalAPI.Get("/sessions", handlers.GetTerminalSessions)
+	terminalAPI.Delete("/sessions/:id", handlers.CloseTerminalSession)
+	terminalAPI.Post("/sessions/:id/shares", handlers.ShareTerminalSession)
+	terminalAPI.Delete("/sessions/:id/shares/:userId", handlers.UnshareTerminalSession)
+	terminalAPI.Get("/recordings", middleware.RequirePermission(rbac.TerminalRecordings), handlers.GetTerminalRecordings)
+	terminalAPI.Get("/recordings/:id", middleware.RequirePermission(rbac.TerminalRecordings), handlers.GetTerminalRecording)
+
+	// Tasks API; everyone sees their own tasks
+	tasksAPI := protected.Group("/tasks")
+	tasksAPI.Get("/", handlers.GetTasks)
+	tasksAPI.Get("/:id", handlers.GetTask)
+	tasksAPI.Post("/:id/cancel", handlers.CancelTask)
+
+	// Roles API
+	protected.Get("/roles", middleware.RequirePermission(rbac.UsersManage), handlers.GetRoles)
 
 	// Dashboard API
-	protected.Get("/dashboard", handlers.GetDashboard)
-	protected.Get("/system/stats", handlers.GetSystemStats)
+	dashboardAPI := protected.Group("/dashboard", middleware.RequirePermission(rbac.DashboardView))
+	systemAPI := protected.Group("/system", middleware.RequirePermission(rbac.DashboardView))
+	dashboardAPI.Get("/", handlers.GetDashboard)
+	systemAPI.Get("/stats", handlers.GetSystemStats)
+
+	// Metrics history API
+	metricsAPI := protected.Group("/metrics", middleware.RequirePermission(rbac.DashboardView))
+	metricsAPI.Get("/", handlers.GetMetricNames)
+	metricsAPI.Get("/query", handlers.QueryMetrics)
+
+	// Alerts API
+	alertsAPI := protected.Group("/alerts", middleware.ModulePermission(rbac.AlertsRead, rbac.AlertsManage))
+	alertsAPI.Get("/rules", handlers.GetAlertRules)
+	alertsAPI.Post("/rules", handlers.CreateAlertRule)
+	alertsAPI.Put("/rules/:id", handlers.UpdateAlertRule)
+	alertsAPI.Delete("/rules/:id", handlers.DeleteAlertRule)
+	alertsAPI.Get("/channels", handlers.GetAlertChannels)
+	alertsAPI.Post("/channels", handlers.CreateAlertChannel)
+	alertsAPI.Put("/channels/:id", handlers.UpdateAlertChannel)
+	alertsAPI.Delete("/channels/:id", handlers.DeleteAlertChannel)
+	alertsAPI.Post("/channels/:id/test", handlers.TestAlertChannel)
+	alertsAPI.Get("/history", handlers.GetAlertHistory)
 
 	// App Store API (system package manager)
-	protected.Get("/appstore/packages", handlers.GetPackages)
-	protected.Get("/appstore/packages/:id/status", handlers.GetPackageStatus)
-	protected.Get("/appstore/installed", handlers.GetInstalledPackages)
-	protected.Post("/appstore/install", handlers.InstallPackage)
-	protected.Delete("/appstore/packages/:id", handlers.UninstallPackage)
-	protected.Get("/appstore/system", handlers.GetSystemInfo)
-	protected.Post("/appstore/preview", handlers.PreviewInstall)
+	appStoreAPI := protected.Group("/appstore", middleware.ModulePermission(rbac.AppStoreRead, rbac.AppStoreInstall))
+	appStoreAPI.Get("/packages", handlers.GetPackages)
+	appStoreAPI.Get("/packages/:id/status", handlers.GetPackageStatus)
+	appStoreAPI.Get("/installed", handlers.GetInstalledPackages)
+	appStoreAPI.Post("/install", handlers.InstallPackage)
+	appStoreAPI.Delete("/packages/:id", handlers.UninstallPackage)
+	appStoreAPI.Get("/system", handlers.GetSystemInfo)
+	appStoreAPI.Post("/preview", handlers.PreviewInstall)
 
 	// Portable App Store API (download-based installation)
-	protected.Get("/portable/packages", handlers.GetPortablePackages)
-	protected.Get("/portable/installed", handlers.GetPortableInstalled)
-	protected.Post("/portable/install", handlers.InstallPortablePackage)
-	protected.Delete("/portable/packages/:id", handlers.UninstallPortablePackage)
-	protected.Get("/portable/system", handlers.GetPortableSystemInfo)
-	protected.Post("/portable/preview", handlers.PreviewPortableInstall)
+	portableAPI := protected.Group("/portable", middleware.ModulePermission(rbac.AppStoreRead, rbac.AppStoreInstall))
+	portableAPI.Get("/packages", handlers.GetPortablePackages)
+	portableAPI.Get("/installed", handlers.GetPortableInstalled)
+	portableAPI.Post("/install", handlers.InstallPortablePackage)
+	portableAPI.Get("/jobs", handlers.GetPortableJobs)
+	portableAPI.Get("/jobs/:id", handlers.GetPortableJob)
+	portableAPI.Post("/jobs/:id/cancel", handlers.CancelPortableJob)
+	portableAPI.Delete("/packages/:id", handlers.UninstallPortablePackage)
+	portableAPI.Get("/system", handlers.GetPortableSystemInfo)
+	portableAPI.Post("/preview", handlers.PreviewPortableInstall)
 
 	// Service Control API
-	protected.Get("/service/:id/status", handlers.GetServiceStatus)
-	protected.Post("/service/:id/start", handlers.StartService)
-	protected.Post("/service/:id/stop", handlers.StopService)
-	protected.Post("/service/:id/restart", handlers.RestartService)
-	protected.Get("/service/:id/config", handlers.GetServiceConfig)
-	protected.Post("/service/:id/config", handlers.SaveServiceConfig)
-	protected.Get("/service/:id/logs", handlers.GetServiceLogs)
+	serviceAPI := protected.Group("/service", middleware.ModulePermission(rbac.ServicesRead, rbac.ServicesManage))
+	serviceAPI.Get("/:id/status", handlers.GetServiceStatus)
+	serviceAPI.Post("/:id/start", handlers.StartService)
+	serviceAPI.Post("/:id/stop", handlers.StopService)
+	serviceAPI.Post("/:id/restart", handlers.RestartService)
+	serviceAPI.Get("/:id/config", handlers.GetServiceConfig)
+	serviceAPI.Post("/:id/config", handlers.SaveServiceConfig)
+	serviceAPI.Get("/:id/logs", handlers.GetServiceLogs)
 
 	// Services List API
-	protected.Get("/services", handlers.GetAllServices)
-	protected.Post("/services/:id/:action", handlers.ServiceAction)
+	servicesAPI := protected.Group("/services", middleware.ModulePermission(rbac.ServicesRead, rbac.ServicesManage))
+	servicesAPI.Get("/", handlers.GetAllServices)
+	servicesAPI.Post("/:id/:action", handlers.ServiceAction)
 
 	// Web Server API
-	protected.Get("/webserver/status", handlers.GetWebServerStatus)
-	protected.Get("/webserver/sites", handlers.GetSites)
-	protected.Post("/webserver/sites", handlers.CreateSite)
-	protected.Delete("/webserver/sites/:name", handlers.DeleteSite)
-	protected.Get("/webserver/sites/:name/config", handlers.GetSiteConfigHandler)
-	protected.Post("/webserver/sites/:name/config", handlers.SaveSiteConfigHandler)
-	protected.Post("/webserver/reload", handlers.ReloadNginx)
-	protected.Get("/webserver/php", handlers.GetPHPVersions)
-	protected.Post("/webserver/php/start", handlers.StartPHPCGI)
-	protected.Post("/webserver/php/stop", handlers.StopPHPCGI)
-	protected.Get("/webserver/php/status", handlers.GetPHPCGIStatus)
+	webServerAPI := protected.Group("/webserver", middleware.ModulePermission(rbac.WebServerRead, rbac.WebServerManage))
+	webServerAPI.Get("/status", handlers.GetWebServerStatus)
+	webServerAPI.Get("/sites", handlers.GetSites)
+	webServerAPI.Post("/sites", handlers.CreateSite)
+	webServerAPI.Delete("/sites/:name", handlers.DeleteSite)
+	webServerAPI.Get("/sites/:name/config", handlers.GetSiteConfigHandler)
+	webServerAPI.Post("/sites/:name/config", handlers.SaveSiteConfigHandler)
+	webServerAPI.Post("/reload", handlers.ReloadNginx)
+	webServerAPI.Get("/php", handlers.GetPHPVersions)
+	webServerAPI.Post("/php/start", handlers.StartPHPCGI)
+	webServerAPI.Post("/php/stop", handlers.StopPHPCGI)
+	webServerAPI.Get("/php/status", handlers.GetPHPCGIStatus)
 
 	// Database API
-	protected.Get("/database/status", handlers.GetDatabaseStatus)
-	protected.Get("/database/databases", handlers.GetDatabases)
-	protected.Post("/database/databases", handlers.CreateDatabase)
-	protected.Delete("/database/databases/:name", handlers.DropDatabase)
-	protected.Get("/database/users", handlers.GetDBUsers)
-	protected.Post("/database/users", handlers.CreateDBUser)
-	protected.Delete("/database/users/:username", handlers.DropDBUser)
-	protected.Post("/database/start", handlers.StartMySQL)
-	protected.Post("/database/stop", handlers.StopMySQL)
+	databaseAPI := protected.Group("/database", middleware.ModulePermission(rbac.DatabaseRead, rbac.DatabaseManage))
+	databaseAPI.Get("/status", handlers.GetDatabaseStatus)
+	databaseAPI.Get("/databases", handlers.GetDatabases)
+	databaseAPI.Post("/databases", handlers.CreateDatabase)
+	databaseAPI.Delete("/databases/:name", handlers.DropDatabase)
+	databaseAPI.Get("/users", handlers.GetDBUsers)
+	databaseAPI.Post("/users", handlers.CreateDBUser)
+	databaseAPI.Delete("/users/:username", handlers.DropDBUser)
+	databaseAPI.Post("/start", handlers.StartMySQL)
+	databaseAPI.Post("/stop", handlers.StopMySQL)
 
 	// File Manager API
-	protected.Get("/files/list", handlers.ListFiles)
-	protected.Get("/files/read", handlers.ReadFileContent)
-	protected.Post("/files/save", handlers.SaveFileContent)
-	protected.Post("/files/folder", handlers.CreateFolder)
-	protected.Post("/files/create", handlers.CreateFile)
-	protected.Delete("/files/delete", handlers.DeleteItem)
-	protected.Post("/files/rename", handlers.RenameItem)
-	protected.Post("/files/upload", handlers.UploadFile)
-	protected.Get("/files/download", handlers.DownloadFile)
+	filesAPI := protected.Group("/files", middleware.ModulePermission(rbac.FilesRead, rbac.FilesWrite))
+	filesAPI.Get("/list", handlers.ListFiles)
+	filesAPI.Get("/read", handlers.ReadFileContent)
+	filesAPI.Post("/save", handlers.SaveFileContent)
+	filesAPI.Post("/folder", handlers.CreateFolder)
+	filesAPI.Post("/create", handlers.CreateFile)
+	filesAPI.Delete("/delete", handlers.DeleteItem)
+	filesAPI.Post("/rename", handlers.RenameItem)
+	filesAPI.Post("/upload", handlers.UploadFile)
+	filesAPI.Get("/download", handlers.DownloadFile)
 
 	// Cron API
-	protected.Get("/cron/jobs", handlers.GetCronJobs)
-	protected.Post("/cron/jobs", handlers.AddCronJob)
-	protected.Delete("/cron/jobs/:id", handlers.RemoveCronJob)
-	protected.Post("/cron/jobs/:id/toggle", handlers.ToggleCronJob)
+	cronAPI := protected.Group("/cron", middleware.ModulePermission(rbac.CronRead, rbac.CronManage))
+	cronAPI.Get("/jobs", handlers.GetCronJobs)
+	cronAPI.Post("/jobs", handlers.AddCronJob)
+	cronAPI.Delete("/jobs/:id", handlers.RemoveCronJob)
+	cronAPI.Post("/jobs/:id/toggle", handlers.ToggleCronJob)
 
 	// Firewall API
-	protected.Get("/firewall/rules", handlers.GetFirewallRules)
-	protected.Post("/firewall/rules", handlers.AddFirewallRule)
-	protected.Delete("/firewall/rules", handlers.DeleteFirewallRule)
+	firewallAPI := protected.Group("/firewall", middleware.ModulePermission(rbac.FirewallRead, rbac.FirewallManage))
+	firewallAPI.Get("/rules", handlers.GetFirewallRules)
+	firewallAPI.Post("/rules", handlers.AddFirewallRule)
+	firewallAPI.Delete("/rules", handlers.DeleteFirewallRule)
+	firewallAPI.Get("/drift", handlers.GetFirewallDrift)
+	firewallAPI.Post("/reconcile", handlers.ReconcileFirewall)
+	firewallAPI.Get("/pending", handlers.GetFirewallPending)
+	firewallAPI.Post("/confirm", handlers.ConfirmFirewallChange)
+	firewallAPI.Post("/rollback", handlers.RollbackFirewallChange)
+
+	// Process API
+	processesAPI := protected.Group("/processes", middleware.ModulePermission(rbac.ProcessesRead, rbac.ProcessesManage))
+	processesAPI.Get("/", handlers.GetProcesses)
+	processesAPI.Get("/:pid", handlers.GetProcess)
+	processesAPI.Post("/:pid/signal", handlers.SignalProcess)
+	processesAPI.Post("/:pid/renice", handlers.ReniceProcess)
+
+	// Ban API
+	bansAPI := protected.Group("/bans", middleware.ModulePermission(rbac.FirewallRead, rbac.FirewallManage))
+	bansAPI.Get("/", handlers.GetBans)
+	bansAPI.Post("/", handlers.CreateBan)
+	bansAPI.Get("/whitelist", handlers.GetBanWhitelist)
+	bansAPI.Post("/whitelist", handlers.AddBanWhitelist)
+	bansAPI.Delete("/whitelist/:id", handlers.RemoveBanWhitelist)
+	bansAPI.Delete("/:id", handlers.Unban)
 
 	// Docker API
-	protected.Get("/docker/status", handlers.GetDockerStatus)
-	protected.Get("/docker/containers", handlers.GetContainers)
-	protected.Get("/docker/images", handlers.GetImages)
-	protected.Post("/docker/containers/:id/start", handlers.StartContainer)
-	protected.Post("/docker/containers/:id/stop", handlers.StopContainer)
-	protected.Post("/docker/containers/:id/restart", handlers.RestartContainer)
-	protected.Delete("/docker/containers/:id", handlers.RemoveContainer)
-	protected.Get("/docker/containers/:id/logs", handlers.GetContainerLogs)
-	protected.Post("/docker/images/pull", handlers.PullImage)
-	protected.Delete("/docker/images/:id", handlers.RemoveImage)
-	protected.Post("/docker/run", handlers.RunContainer)
+	dockerAPI := protected.Group("/docker", middleware.ModulePermission(rbac.DockerRead, rbac.DockerManage))
+	dockerAPI.Get("/status", handlers.GetDockerStatus)
+	dockerAPI.Get("/containers", handlers.GetContainers)
+	dockerAPI.Get("/images", handlers.GetImages)
+	dockerAPI.Post("/containers/:id/start", handlers.StartContainer)
+	dockerAPI.Post("/containers/:id/stop", handlers.StopContainer)
+	dockerAPI.Post("/containers/:id/restart", handlers.RestartContainer)
+	dockerAPI.Delete("/containers/:id", handlers.RemoveContainer)
+	dockerAPI.Get("/containers/:id/logs", handlers.GetContainerLogs)
+	dockerAPI.Post("/images/pull", handlers.PullImage)
+	dockerAPI.Delete("/images/:id", handlers.RemoveImage)
+	dockerAPI.Post("/run", handlers.RunContainer)
 
 	// WebSocket
-	app.Get("/ws/stats", websocket.New(ws.HandleWebSocket))
+	app.Get("/ws/stats", middleware.RequirePermission(rbac.DashboardView), websocket.New(ws.HandleWebSocket))
+
+	// Panel events, authorized per topic
+	app.Get("/ws/events", websocket.New(handlers.EventsHandler))
+
+	// Live process list
+	app.Get("/ws/processes", middleware.RequirePermission(rbac.ProcessesRead), websocket.New(handlers.ProcessesHandler))
 
 	// Terminal WebSocket
-	app.Get("/ws/terminal", websocket.New(handlers.TerminalHandler))
+	app.Get("/ws/terminal", handlers.TerminalAccess, websocket.New(handlers.TerminalHandler))
+
+	// Prometheus exporter, authenticated with its own scrape token
+	app.Get("/metrics", middleware.NotBanned(), middleware.ScrapeToken(), handlers.PrometheusMetrics)
 
 	// Dashboard pages (protected via cookie)
 	dashboard := app.Group("/dashboard")
@@ -330,6 +482,13 @@ func setupRoutes(app *fiber.App, cfg *config.Config) {
 		})
 	})
 
+	dashboard.Get("/recordings", func(c *fiber.Ctx) error {
+		return c.Render("pages/recordings", fiber.Map{
+			"Title":  "Terminal Recordings - VPS Panel",
+			"Active": "recordings",
+		})
+	})
+
 }
 
 func createDefaultAdmin(cfg *config.Config) {
@@ -339,12 +498,17 @@ func createDefaultAdmin(cfg *config.Config) {
 		return
 	}
 
+	// The configured password is a bootstrap secret and must be changed
 	admin := models.User{
-		Username: cfg.Admin.Username,
-		Email:    cfg.Admin.Email,
-		Role:     "admin",
+		Username:           cfg.Admin.Username,
+		Email:              cfg.Admin.Email,
+		Role:               "admin",
+		MustChangePassword: true,
+	}
+	if err := admin.SetPassword(cfg.Admin.Password); err != nil {
+		log.Printf("Failed to create default admin: %v", err)
+		return
 	}
-	admin.SetPassword(cfg.Admin.Password)
 
 	if err := database.DB.Create(&admin).Error; err != nil {
 		log.Printf("Failed to create default admin: %v", err)
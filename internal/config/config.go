@@ -9,15 +9,25 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
-	JWT      JWTConfig      `yaml:"jwt"`
-	Admin    AdminConfig    `yaml:"admin"`
+	Server     ServerConfig     `yaml:"server"`
+	Database   DatabaseConfig   `yaml:"database"`
+	JWT        JWTConfig        `yaml:"jwt"`
+	Admin      AdminConfig      `yaml:"admin"`
+	Firewall   FirewallConfig   `yaml:"firewall"`
+	Ban        BanConfig        `yaml:"ban"`
+	Terminal   TerminalConfig   `yaml:"terminal"`
+	Monitor    MonitorConfig    `yaml:"monitor"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
+	Prometheus PrometheusConfig `yaml:"prometheus"`
+	Alerts     AlertsConfig     `yaml:"alerts"`
+	Tasks      TasksConfig      `yaml:"tasks"`
+	Portable   PortableConfig   `yaml:"portable"`
 }
 
 type ServerConfig struct {
-	Port int    `yaml:"port"`
-	Host string `yaml:"host"`
+	Port           int      `yaml:"port"`
+	Host           string   `yaml:"host"`
+	AllowedOrigins []string `yaml:"allowed_origins"` // Extra origins allowed to open WebSockets, e.g. behind a proxy
 }
 
 type DatabaseConfig struct {
@@ -35,6 +45,73 @@ type AdminConfig struct {
 	Email    string `yaml:"email"`
 }
 
+type FirewallConfig struct {
+	ReconcileOnBoot string        `yaml:"reconcile_on_boot"` // reapply, report, off
+	ConfirmTimeout  time.Duration `yaml:"confirm_timeout"`   // 0 disables commit-confirm
+	ProtectedPorts  []int         `yaml:"protected_ports"`   // Never blocked without force, besides the panel port
+}
+
+type BanConfig struct {
+	MaxRetries  int           `yaml:"max_retries"` // Failures within FindTime before a ban
+	FindTime    time.Duration `yaml:"find_time"`
+	BanTime     time.Duration `yaml:"ban_time"`
+	Whitelist   []string      `yaml:"whitelist"`    // IPs or CIDRs that are never banned
+	UseFirewall bool          `yaml:"use_firewall"` // Also block banned IPs with a firewall rule
+	SSHLog      string        `yaml:"ssh_log"`      // Auth log to watch, empty = auto-detect, "off" disables
+}
+
+type TerminalConfig struct {
+	Record             bool          `yaml:"record"` // Record sessions as asciicast v2 files
+	RecordingDir       string        `yaml:"recording_dir"`
+	RecordingRetention time.Duration `yaml:"recording_retention"` // Older recordings are deleted, 0 keeps them forever
+	IdleTimeout        time.Duration `yaml:"idle_timeout"`        // Detached sessions without output are killed after this, 0 keeps them
+	Scrollback         int           `yaml:"scrollback"`          // Bytes of output replayed when reattaching
+	MaxSessions        int           `yaml:"max_sessions"`        // Open sessions allowed per user
+}
+
+type MonitorConfig struct {
+	Interval time.Duration `yaml:"interval"` // How often system stats are sampled
+	Collect  []string      `yaml:"collect"`  // Stats to sample, empty = all
+}
+
+type MetricsConfig struct {
+	Enabled  bool          `yaml:"enabled"`  // Store system stats history
+	Interval time.Duration `yaml:"interval"` // Raw sampling interval
+	Tiers    []MetricsTier `yaml:"tiers"`    // Finest first; each tier is downsampled from the previous one
+}
+
+type MetricsTier struct {
+	Resolution time.Duration `yaml:"resolution"` // Ignored for the first tier, which uses Interval
+	Retention  time.Duration `yaml:"retention"`
+}
+
+type PrometheusConfig struct {
+	Token string `yaml:"token"` // Bearer token for scraping /metrics, empty disables the endpoint
+}
+
+type AlertsConfig struct {
+	Interval time.Duration `yaml:"interval"` // How often rules are evaluated, 0 disables alerting
+	SMTP     SMTPConfig    `yaml:"smtp"`     // Server used by smtp channels
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"` // 465 uses implicit TLS, other ports STARTTLS when offered
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+type TasksConfig struct {
+	Concurrency        map[string]int `yaml:"concurrency"`         // Tasks of a type that run at once, by type
+	DefaultConcurrency int            `yaml:"default_concurrency"` // For types not listed in Concurrency
+	Retention          time.Duration  `yaml:"retention"`           // Finished tasks older than this are deleted, 0 keeps them
+}
+
+type PortableConfig struct {
+	RequireChecksum bool `yaml:"require_checksum"` // Refuse downloads without a pinned SHA-256
+}
+
 var AppConfig *Config
 
 func Load(path string) (*Config, error) {
@@ -55,6 +132,52 @@ func Load(path string) (*Config, error) {
 			Password: "admin123",
 			Email:    "admin@localhost",
 		},
+		Firewall: FirewallConfig{
+			ReconcileOnBoot: "reapply",
+			ConfirmTimeout:  60 * time.Second,
+			ProtectedPorts:  []int{22},
+		},
+		Ban: BanConfig{
+			MaxRetries: 5,
+			FindTime:   10 * time.Minute,
+			BanTime:    15 * time.Minute,
+			Whitelist:  []string{"127.0.0.1", "::1"},
+		},
+		Terminal: TerminalConfig{
+			Record:             true,
+			RecordingDir:       "./data/recordings",
+			RecordingRetention: 30 * 24 * time.Hour,
+			IdleTimeout:        30 * time.Minute,
+			Scrollback:         256 * 1024,
+			MaxSessions:        5,
+		},
+		Monitor: MonitorConfig{
+			Interval: 2 * time.Second,
+		},
+		Metrics: MetricsConfig{
+			Enabled:  true,
+			Interval: 10 * time.Second,
+			Tiers: []MetricsTier{
+				{Retention: 24 * time.Hour},
+				{Resolution: 5 * time.Minute, Retention: 7 * 24 * time.Hour},
+				{Resolution: time.Hour, Retention: 90 * 24 * time.Hour},
+			},
+		},
+		Alerts: AlertsConfig{
+			Interval: 30 * time.Second,
+			SMTP: SMTPConfig{
+				Port: 587,
+			},
+		},
+		Tasks: TasksConfig{
+			Concurrency: map[string]int{
+				"portable.install": 2,
+				"docker.pull":      2,
+				"mysql.init":       1,
+			},
+			DefaultConcurrency: 2,
+			Retention:          30 * 24 * time.Hour,
+		},
 	}
 
 	data, err := os.ReadFile(path)
@@ -80,6 +203,9 @@ func Load(path string) (*Config, error) {
 	if secret := os.Getenv("VPS_PANEL_JWT_SECRET"); secret != "" {
 		config.JWT.Secret = secret
 	}
+	if token := os.Getenv("VPS_PANEL_PROMETHEUS_TOKEN"); token != "" {
+		config.Prometheus.Token = token
+	}
 
 	AppConfig = config
 	return config, nil
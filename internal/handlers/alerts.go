@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"vps-panel/internal/middleware"
+	"vps-panel/internal/models"
+	"vps-panel/internal/services/alert"
+	"vps-panel/internal/services/rbac"
+)
+
+// alertRuleRequest is the body for creating or updating a rule. Enabled is
+// a pointer so that omitting it keeps rules on.
+type alertRuleRequest struct {
+	models.AlertRule
+	Enabled *bool `json:"enabled"`
+}
+
+func (r *alertRuleRequest) rule() *models.AlertRule {
+	rule := r.AlertRule
+	rule.Enabled = r.Enabled == nil || *r.Enabled
+	return &rule
+}
+
+type alertChannelRequest struct {
+	models.AlertChannel
+	Enabled *bool `json:"enabled"`
+}
+
+func (r *alertChannelRequest) channel() *models.AlertChannel {
+	ch := r.AlertChannel
+	ch.Enabled = r.Enabled == nil || *r.Enabled
+	return &ch
+}
+
+func alertID(c *fiber.Ctx) (uint, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil || id <= 0 {
+		return 0, c.Status(400).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+	return uint(id), nil
+}
+
+// GetAlertRules lists alert rules with their current state
+func GetAlertRules(c *fiber.Ctx) error {
+	rules, err := alert.GetRules()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(rules)
+}
+
+// CreateAlertRule adds an alert rule
+func CreateAlertRule(c *fiber.Ctx) error {
+	var req alertRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	rule := req.rule()
+	if err := alert.CreateRule(rule); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	middleware.SetAudit(c, "alert.rule_add", rule.Name, rule.Kind)
+	return c.JSON(rule)
+}
+
+// UpdateAlertRule replaces an alert rule's settings
+func UpdateAlertRule(c *fiber.Ctx) error {
+	id, err := alertID(c)
+	if id == 0 {
+		return err
+	}
+
+	var req alertRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	rule, err := alert.UpdateRule(id, req.rule())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	middleware.SetAudit(c, "alert.rule_update", rule.Name, rule.Kind)
+	return c.JSON(rule)
+}
+
+// DeleteAlertRule removes an alert rule
+func DeleteAlertRule(c *fiber.Ctx) error {
+	id, err := alertID(c)
+	if id == 0 {
+		return err
+	}
+
+	if err := alert.DeleteRule(id); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	middleware.SetAudit(c, "alert.rule_delete", strconv.Itoa(int(id)), "")
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// GetAlertChannels lists notification channels. Their config holds webhook
+// URLs and bot tokens, so it is only shown to users who can manage alerts.
+func GetAlertChannels(c *fiber.Ctx) error {
+	channels, err := alert.GetChannels()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if !middleware.HasPermission(c, rbac.AlertsManage) {
+		for i := range channels {
+			channels[i].Config = nil
+		}
+	}
+	return c.JSON(channels)
+}
+
+// CreateAlertChannel adds a notification channel
+func CreateAlertChannel(c *fiber.Ctx) error {
+	var req alertChannelRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	ch := req.channel()
+	if err := alert.CreateChannel(ch); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	middleware.SetAudit(c, "alert.channel_add", ch.Name, ch.Type)
+	return c.JSON(ch)
+}
+
+// UpdateAlertChannel replaces a channel's settings
+func UpdateAlertChannel(c *fiber.Ctx) error {
+	id, err := alertID(c)
+	if id == 0 {
+		return err
+	}
+
+	var req alertChannelRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	ch, err := alert.UpdateChannel(id, req.channel())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	middleware.SetAudit(c, "alert.channel_update", ch.Name, ch.Type)
+	return c.JSON(ch)
+}
+
+// DeleteAlertChannel removes a notification channel
+func DeleteAlertChannel(c *fiber.Ctx) error {
+	id, err := alertID(c)
+	if id == 0 {
+		return err
+	}
+
+	if err := alert.DeleteChannel(id); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	middleware.SetAudit(c, "alert.channel_delete", strconv.Itoa(int(id)), "")
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// TestAlertChannel sends a test notification
+func TestAlertChannel(c *fiber.Ctx) error {
+	id, err := alertID(c)
+	if id == 0 {
+		return err
+	}
+
+	if err := alert.TestChannel(id); err != nil {
+		return c.Status(502).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// GetAlertHistory returns a page of fired and resolved alerts, newest first
+func GetAlertHistory(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	pageSize := c.QueryInt("page_size", 50)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 500 {
+		pageSize = 50
+	}
+
+	events, total, err := alert.GetHistory(uint(c.QueryInt("rule_id", 0)), page, pageSize)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"events":    events,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
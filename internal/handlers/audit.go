@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"vps-panel/internal/services/activity"
+)
+
+// maxExportRows caps a single export
+const maxExportRows = 100000
+
+// parseAuditFilter reads the filter shared by listing and export from the
+// query string. Times accept RFC 3339 or YYYY-MM-DD.
+func parseAuditFilter(c *fiber.Ctx) (activity.Filter, error) {
+	filter := activity.Filter{
+		Username: c.Query("username"),
+		Action:   c.Query("action"),
+		Target:   c.Query("target"),
+		IP:       c.Query("ip"),
+	}
+
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid user_id")
+		}
+		filter.UserID = uint(id)
+	}
+
+	for _, f := range []struct {
+		key string
+		dst *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		v := c.Query(f.key)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if t, err = time.ParseInLocation("2006-01-02", v, time.Local); err != nil {
+				return filter, fmt.Errorf("invalid %s, use RFC 3339 or YYYY-MM-DD", f.key)
+			}
+		}
+		*f.dst = t
+	}
+
+	return filter, nil
+}
+
+// GetAuditLog returns a page of audit entries, newest first
+func GetAuditLog(c *fiber.Ctx) error {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	filter.Page = c.QueryInt("page", 1)
+	filter.PageSize = c.QueryInt("page_size", 50)
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 || filter.PageSize > 500 {
+		filter.PageSize = 50
+	}
+
+	entries, total, err := activity.Query(filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"entries":   entries,
+		"total":     total,
+		"page":      filter.Page,
+		"page_size": filter.PageSize,
+	})
+}
+
+// ExportAuditLog downloads every matching entry as CSV or JSON
+func ExportAuditLog(c *fiber.Ctx) error {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	filter.PageSize = maxExportRows
+
+	format := c.Query("format", "csv")
+	if format != "csv" && format != "json" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "format must be csv or json",
+		})
+	}
+
+	entries, _, err := activity.Query(filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	filename := fmt.Sprintf("audit-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	if format == "json" {
+		return c.JSON(entries)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	w := csv.NewWriter(c.Response().BodyWriter())
+	writeCSVRow(w, []string{"id", "time", "user_id", "username", "ip", "action", "target", "method", "path", "status", "details", "payload"})
+	for _, e := range entries {
+		writeCSVRow(w, []string{
+			strconv.Itoa(int(e.ID)),
+			e.CreatedAt.Format(time.RFC3339),
+			strconv.Itoa(int(e.UserID)),
+			e.Username,
+			e.IP,
+			e.Action,
+			e.Target,
+			e.Method,
+			e.Path,
+			strconv.Itoa(e.Status),
+			e.Details,
+			e.Payload,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// writeCSVRow writes a row, defusing cells that spreadsheets would evaluate
+// as formulas
+func writeCSVRow(w *csv.Writer, row []string) {
+	for i, cell := range row {
+		if cell != "" && strings.ContainsRune("=+-@", rune(cell[0])) {
+			row[i] = "'" + cell
+		}
+	}
+	w.Write(row)
+}
@@ -6,6 +6,10 @@ import (
 	"vps-panel/internal/database"
 	"vps-panel/internal/middleware"
 	"vps-panel/internal/models"
+	"vps-panel/internal/services/activity"
+	"vps-panel/internal/services/ban"
+	"vps-panel/internal/services/rbac"
+	"vps-panel/internal/services/session"
 )
 
 type LoginRequest struct {
@@ -15,17 +19,62 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token        string `json:"token"`
-	User         *UserResponse `json:"user"`
-	Requires2FA  bool   `json:"requires_2fa,omitempty"`
+	Token              string        `json:"token"`
+	User               *UserResponse `json:"user"`
+	Requires2FA        bool          `json:"requires_2fa,omitempty"`
+	MustChangePassword bool          `json:"must_change_password,omitempty"`
 }
 
 type UserResponse struct {
-	ID               uint   `json:"id"`
-	Username         string `json:"username"`
-	Email            string `json:"email"`
-	Role             string `json:"role"`
-	TwoFactorEnabled bool   `json:"two_factor_enabled"`
+	ID               uint     `json:"id"`
+	Username         string   `json:"username"`
+	Email            string   `json:"email"`
+	Role             string   `json:"role"`
+	TwoFactorEnabled bool     `json:"two_factor_enabled"`
+	Permissions      []string `json:"permissions"`
+}
+
+// defaultAdminPassword is the config.yaml default, never accepted for long
+const defaultAdminPassword = "admin123"
+
+func newUserResponse(user models.User) *UserResponse {
+	return &UserResponse{
+		ID:               user.ID,
+		Username:         user.Username,
+		Email:            user.Email,
+		Role:             user.Role,
+		TwoFactorEnabled: user.TwoFactorEnabled,
+		Permissions:      rbac.Permissions(user.Role),
+	}
+}
+
+// issueToken starts a session, generates its token and sets it as the cookie
+func issueToken(c *fiber.Ctx, user *models.User) (string, error) {
+	s, err := session.Create(user.ID, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		return "", err
+	}
+
+	token, err := middleware.GenerateToken(user, s)
+	if err != nil {
+		return "", err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "token",
+		Value:    token,
+		HTTPOnly: true,
+		Secure:   false, // Set to true in production with HTTPS
+		MaxAge:   86400,
+		Path:     "/",
+	})
+	return token, nil
+}
+
+// loginFailed counts a failed login towards a ban and records it
+func loginFailed(c *fiber.Ctx, username string) {
+	ban.RecordFailure(c.IP(), username, "panel")
+	activity.Log(0, username, c.IP(), "auth.login_failed", username, "")
 }
 
 func Login(c *fiber.Ctx) error {
@@ -36,20 +85,34 @@ func Login(c *fiber.Ctx) error {
 		})
 	}
 
+	if ban.IsLocked(req.Username) {
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": "Account temporarily locked after too many failed logins",
+		})
+	}
+
 	var user models.User
 	result := database.DB.Where("username = ?", req.Username).First(&user)
 	if result.Error != nil {
+		loginFailed(c, req.Username)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid credentials",
 		})
 	}
 
 	if !user.CheckPassword(req.Password) {
+		loginFailed(c, req.Username)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid credentials",
 		})
 	}
 
+	if user.Disabled {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Account disabled",
+		})
+	}
+
 	// Check 2FA
 	if user.TwoFactorEnabled {
 		if req.TOTPCode == "" {
@@ -60,42 +123,110 @@ func Login(c *fiber.Ctx) error {
 
 		valid := totp.Validate(req.TOTPCode, user.TwoFactorSecret)
 		if !valid {
+			loginFailed(c, req.Username)
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Invalid 2FA code",
 			})
 		}
 	}
 
-	token, err := middleware.GenerateToken(user.ID, user.Username, user.Role)
+	ban.Reset(c.IP(), req.Username)
+
+	// Databases created before forced resets may still use the default
+	if req.Password == defaultAdminPassword && !user.MustChangePassword {
+		user.MustChangePassword = true
+		database.DB.Model(&user).Update("must_change_password", true)
+	}
+
+	token, err := issueToken(c, &user)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate token",
 		})
 	}
 
-	// Set cookie
-	c.Cookie(&fiber.Cookie{
-		Name:     "token",
-		Value:    token,
-		HTTPOnly: true,
-		Secure:   false, // Set to true in production with HTTPS
-		MaxAge:   86400,
-		Path:     "/",
-	})
+	activity.Log(user.ID, user.Username, c.IP(), "auth.login", user.Username, "")
 
 	return c.JSON(LoginResponse{
-		Token: token,
-		User: &UserResponse{
-			ID:               user.ID,
-			Username:         user.Username,
-			Email:            user.Email,
-			Role:             user.Role,
-			TwoFactorEnabled: user.TwoFactorEnabled,
-		},
+		Token:              token,
+		User:               newUserResponse(user),
+		MustChangePassword: user.MustChangePassword,
+	})
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangePassword changes the caller's password after checking the current one
+func ChangePassword(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+
+	var req ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if !user.CheckPassword(req.CurrentPassword) {
+		ban.RecordFailure(c.IP(), user.Username, "panel")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Current password is incorrect",
+		})
+	}
+	if err := validatePassword(req.NewPassword); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if req.NewPassword == req.CurrentPassword {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "New password must differ from the current one",
+		})
+	}
+
+	if err := user.SetPassword(req.NewPassword); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid password: " + err.Error(),
+		})
+	}
+	user.MustChangePassword = false
+	if err := database.DB.Save(&user).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to change password",
+		})
+	}
+
+	middleware.SetAudit(c, "auth.password_change", user.Username, "")
+
+	// Log out everywhere, then re-issue this client's token, which also
+	// lifts the password-change restriction
+	session.RevokeAll(user.ID, "")
+	token, err := issueToken(c, &user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Password changed successfully",
+		"token":   token,
 	})
 }
 
 func Logout(c *fiber.Ctx) error {
+	session.RevokeJTI(c.Locals("jti").(string))
+
 	c.Cookie(&fiber.Cookie{
 		Name:     "token",
 		Value:    "",
@@ -119,13 +250,7 @@ func GetProfile(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(UserResponse{
-		ID:               user.ID,
-		Username:         user.Username,
-		Email:            user.Email,
-		Role:             user.Role,
-		TwoFactorEnabled: user.TwoFactorEnabled,
-	})
+	return c.JSON(newUserResponse(user))
 }
 
 type Setup2FAResponse struct {
@@ -231,6 +356,10 @@ func Disable2FA(c *fiber.Ctx) error {
 		})
 	}
 
+	// Sessions elsewhere were opened with the second factor, end them
+	session.RevokeAll(user.ID, c.Locals("jti").(string))
+	middleware.SetAudit(c, "auth.2fa_disable", user.Username, "")
+
 	return c.JSON(fiber.Map{
 		"message": "2FA disabled successfully",
 	})
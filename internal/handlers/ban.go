@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"vps-panel/internal/config"
+	"vps-panel/internal/services/ban"
+)
+
+// GetBans returns active IP bans and username lockouts
+func GetBans(c *fiber.Ctx) error {
+	bans, err := ban.GetBans()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(bans)
+}
+
+// CreateBan bans an IP or locks a username manually
+func CreateBan(c *fiber.Ctx) error {
+	type Request struct {
+		Kind     string `json:"kind"` // ip (default), user
+		Value    string `json:"value"`
+		Reason   string `json:"reason"`
+		Duration string `json:"duration"` // e.g. "1h"; defaults to the configured ban time
+	}
+
+	var req Request
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Value == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Value is required",
+		})
+	}
+	if req.Kind == "" {
+		req.Kind = "ip"
+	}
+	if req.Reason == "" {
+		req.Reason = "Banned manually"
+	}
+
+	duration := config.AppConfig.Ban.BanTime
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid duration",
+			})
+		}
+		duration = d
+	}
+
+	b, err := ban.Ban(req.Kind, req.Value, "manual", req.Reason, duration)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(b)
+}
+
+// Unban lifts a ban before it expires
+func Unban(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+
+	if err := ban.Unban(uint(id)); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// GetBanWhitelist returns the whitelist entries added through the API
+func GetBanWhitelist(c *fiber.Ctx) error {
+	rows, err := ban.GetWhitelist()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"config":  config.AppConfig.Ban.Whitelist,
+		"entries": rows,
+	})
+}
+
+// AddBanWhitelist whitelists an IP or CIDR
+func AddBanWhitelist(c *fiber.Ctx) error {
+	type Request struct {
+		CIDR string `json:"cidr"`
+		Note string `json:"note"`
+	}
+
+	var req Request
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	row, err := ban.AddWhitelist(req.CIDR, req.Note)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(row)
+}
+
+// RemoveBanWhitelist deletes a whitelist entry
+func RemoveBanWhitelist(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+
+	if err := ban.RemoveWhitelist(uint(id)); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
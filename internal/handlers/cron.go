@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"strconv"
+	"vps-panel/internal/middleware"
 	"vps-panel/internal/services/cron"
 
 	"github.com/gofiber/fiber/v2"
@@ -39,6 +40,8 @@ func AddCronJob(c *fiber.Ctx) error {
 		})
 	}
 
+	middleware.SetAudit(c, "cron.add", req.Name, req.Schedule+" "+req.Command)
+
 	job, err := cron.AddJob(req.Name, req.Schedule, req.Command)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"path/filepath"
+	"vps-panel/internal/middleware"
 	"vps-panel/internal/services/appstore"
 	dbservice "vps-panel/internal/services/database"
 
@@ -65,6 +66,8 @@ func DropDatabase(c *fiber.Ctx) error {
 		})
 	}
 
+	middleware.SetAudit(c, "database.drop", name, "")
+
 	if err := dbservice.DropDatabase(name); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": err.Error(),
@@ -168,6 +171,9 @@ func StartMySQL(c *fiber.Ctx) error {
 	}
 
 	version := filepath.Base(mysqlPath)
+	if queued, err := initializeFirst(c, "mysql", version, "start"); queued {
+		return err
+	}
 	if err := appstore.StartService("mysql", version); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": err.Error(),
@@ -1,12 +1,17 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"os/exec"
 	"runtime"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"vps-panel/internal/middleware"
+	"vps-panel/internal/services/events"
+	"vps-panel/internal/services/task"
 )
 
 // Container represents a Docker container
@@ -20,6 +25,15 @@ type Container struct {
 	Created string `json:"created"`
 }
 
+// ContainerEvent is published on the container topic after a container
+// action
+type ContainerEvent struct {
+	ID     string `json:"id"`
+	Action string `json:"action"` // start, stop, restart, remove, create
+	Name   string `json:"name,omitempty"`
+	Image  string `json:"image,omitempty"`
+}
+
 // Image represents a Docker image
 type Image struct {
 	ID         string `json:"id"`
@@ -178,6 +192,7 @@ func StartContainer(c *fiber.Ctx) error {
 		})
 	}
 
+	events.Publish(events.TopicContainer, ContainerEvent{ID: id, Action: "start"})
 	return c.JSON(fiber.Map{"success": true, "message": "Container started"})
 }
 
@@ -195,6 +210,7 @@ func StopContainer(c *fiber.Ctx) error {
 		})
 	}
 
+	events.Publish(events.TopicContainer, ContainerEvent{ID: id, Action: "stop"})
 	return c.JSON(fiber.Map{"success": true, "message": "Container stopped"})
 }
 
@@ -212,6 +228,7 @@ func RestartContainer(c *fiber.Ctx) error {
 		})
 	}
 
+	events.Publish(events.TopicContainer, ContainerEvent{ID: id, Action: "restart"})
 	return c.JSON(fiber.Map{"success": true, "message": "Container restarted"})
 }
 
@@ -222,6 +239,8 @@ func RemoveContainer(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Container ID required"})
 	}
 
+	middleware.SetAudit(c, "docker.container_remove", id, "")
+
 	// Force remove
 	cmd := exec.Command("docker", "rm", "-f", id)
 	if output, err := cmd.CombinedOutput(); err != nil {
@@ -230,6 +249,7 @@ func RemoveContainer(c *fiber.Ctx) error {
 		})
 	}
 
+	events.Publish(events.TopicContainer, ContainerEvent{ID: id, Action: "remove"})
 	return c.JSON(fiber.Map{"success": true, "message": "Container removed"})
 }
 
@@ -265,19 +285,23 @@ func PullImage(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Image name required"})
 	}
 
-	cmd := exec.Command("docker", "pull", req.Image)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error":  "Failed to pull image",
-			"output": string(output),
-		})
-	}
-
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Image pulled",
-		"output":  string(output),
+	// Pulls can take minutes; docker's progress ends up in the task output
+	return enqueueTask(c, task.Options{
+		Type:   "docker.pull",
+		Title:  "Pull " + req.Image,
+		Target: req.Image,
+	}, func(ctx context.Context, t *task.Handle) error {
+		t.Progress(0, "Pulling "+req.Image+"...")
+		cmd := exec.CommandContext(ctx, "docker", "pull", req.Image)
+		cmd.Stdout = t
+		cmd.Stderr = t
+		if err := cmd.Run(); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to pull image: %w", err)
+		}
+		return nil
 	})
 }
 
@@ -351,10 +375,13 @@ func RunContainer(c *fiber.Ctx) error {
 		})
 	}
 
+	containerID := strings.TrimSpace(string(output))
+	events.Publish(events.TopicContainer, ContainerEvent{ID: containerID, Action: "create", Name: req.Name, Image: req.Image})
+
 	return c.JSON(fiber.Map{
 		"success":      true,
 		"message":      "Container created",
-		"container_id": strings.TrimSpace(string(output)),
+		"container_id": containerID,
 	})
 }
 
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/websocket/v2"
+	"vps-panel/internal/services/events"
+	"vps-panel/internal/services/rbac"
+	ws "vps-panel/internal/services/websocket"
+)
+
+// eventPermissions is the permission needed to subscribe to each topic
+var eventPermissions = map[string]string{
+	events.TopicStats:     rbac.DashboardView,
+	events.TopicInstall:   rbac.AppStoreRead,
+	events.TopicCron:      rbac.CronRead,
+	events.TopicService:   rbac.ServicesRead,
+	events.TopicContainer: rbac.DockerRead,
+	events.TopicAlert:     rbac.AlertsRead,
+	events.TopicFiles:     rbac.FilesRead,
+	events.TopicTask:      rbac.TasksRead,
+}
+
+// EventsHandler streams panel events. Clients pick topics with the topics
+// query parameter (comma separated) and change them later by sending
+// {"action": "subscribe"|"unsubscribe", "topics": [...]}.
+func EventsHandler(c *websocket.Conn) {
+	perms, _ := c.Locals("permissions").([]string)
+
+	var topics []string
+	for _, topic := range strings.Split(c.Query("topics"), ",") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+
+	ws.WSHub.Serve(c, ws.Options{
+		Topics: topics,
+		Allowed: func(topic string) bool {
+			perm, ok := eventPermissions[topic]
+			return ok && rbac.Has(perms, perm)
+		},
+	})
+}
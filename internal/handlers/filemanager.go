@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"vps-panel/internal/middleware"
+	"vps-panel/internal/services/events"
 )
 
 // FileInfo represents file/folder information
@@ -22,6 +24,31 @@ type FileInfo struct {
 	Ext     string    `json:"ext"`
 }
 
+// FileEvent is published on the files topic after a change made through
+// the file manager
+type FileEvent struct {
+	Action  string `json:"action"` // save, create, mkdir, delete, rename, upload
+	Path    string `json:"path"`   // Relative to the file manager root, as in FileInfo
+	NewPath string `json:"new_path,omitempty"`
+}
+
+func publishFileEvent(action, fullPath, newFullPath string) {
+	event := FileEvent{Action: action, Path: fileManagerPath(fullPath)}
+	if newFullPath != "" {
+		event.NewPath = fileManagerPath(newFullPath)
+	}
+	events.Publish(events.TopicFiles, event)
+}
+
+// fileManagerPath turns an absolute path into the form ListFiles returns
+func fileManagerPath(fullPath string) string {
+	rel, err := filepath.Rel(getFileManagerBaseDir(), fullPath)
+	if err != nil {
+		return fullPath
+	}
+	return "/" + strings.ReplaceAll(rel, "\\", "/")
+}
+
 // GetBaseDir returns the base directory for file manager
 func getFileManagerBaseDir() string {
 	cwd, _ := os.Getwd()
@@ -182,6 +209,8 @@ func SaveFileContent(c *fiber.Ctx) error {
 		})
 	}
 
+	publishFileEvent("save", fullPath, "")
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "File saved",
@@ -220,6 +249,8 @@ func CreateFolder(c *fiber.Ctx) error {
 		})
 	}
 
+	publishFileEvent("mkdir", fullPath, "")
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Folder created",
@@ -268,6 +299,8 @@ func CreateFile(c *fiber.Ctx) error {
 	}
 	file.Close()
 
+	publishFileEvent("create", fullPath, "")
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "File created",
@@ -295,12 +328,16 @@ func DeleteItem(c *fiber.Ctx) error {
 		})
 	}
 
+	middleware.SetAudit(c, "files.delete", fullPath, "")
+
 	if err := os.RemoveAll(fullPath); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
+	publishFileEvent("delete", fullPath, "")
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Deleted successfully",
@@ -339,6 +376,8 @@ func RenameItem(c *fiber.Ctx) error {
 		})
 	}
 
+	publishFileEvent("rename", oldFullPath, newFullPath)
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Renamed successfully",
@@ -397,6 +436,8 @@ func UploadFile(c *fiber.Ctx) error {
 		})
 	}
 
+	publishFileEvent("upload", targetPath, "")
+
 	return c.JSON(fiber.Map{
 		"success":  true,
 		"message":  "File uploaded",
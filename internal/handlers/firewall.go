@@ -1,12 +1,17 @@
 package handlers
 
 import (
+	"fmt"
+	"strings"
+
+	"vps-panel/internal/middleware"
+	"vps-panel/internal/models"
 	"vps-panel/internal/services/firewall"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-// GetFirewallRules returns list of firewall rules
+// GetFirewallRules returns list of firewall rules and the detected backends
 func GetFirewallRules(c *fiber.Ctx) error {
 	rules, err := firewall.GetRules()
 	if err != nil {
@@ -14,16 +19,20 @@ func GetFirewallRules(c *fiber.Ctx) error {
 			"error": err.Error(),
 		})
 	}
-	return c.JSON(rules)
+	return c.JSON(fiber.Map{
+		"backend":  firewall.BackendName(),
+		"backends": firewall.GetBackends(),
+		"rules":    rules,
+	})
 }
 
-// AddFirewallRule adds a firewall rule
+// AddFirewallRule adds a firewall rule. Rules that would lock out the panel
+// or the caller are refused unless forced, and the change rolls back unless
+// confirmed when commit-confirm is enabled.
 func AddFirewallRule(c *fiber.Ctx) error {
 	type Request struct {
-		Name     string `json:"name"`
-		Port     string `json:"port"`
-		Protocol string `json:"protocol"`
-		Action   string `json:"action"`
+		models.FirewallRule
+		Force bool `json:"force"`
 	}
 
 	var req Request
@@ -32,21 +41,33 @@ func AddFirewallRule(c *fiber.Ctx) error {
 			"error": "Invalid request body",
 		})
 	}
+	rule := req.FirewallRule
+	rule.ID = 0
 
-	if req.Name == "" || req.Port == "" {
+	if err := firewall.ValidateRule(&rule); err != nil {
 		return c.Status(400).JSON(fiber.Map{
-			"error": "Name and port are required",
+			"error": err.Error(),
 		})
 	}
 
-	if req.Protocol == "" {
-		req.Protocol = "TCP"
+	if !req.Force {
+		if err := firewall.CheckLockout(rule, c.IP()); err != nil {
+			return c.Status(409).JSON(fiber.Map{
+				"error":   err.Error() + " (set force to apply anyway)",
+				"lockout": true,
+			})
+		}
 	}
-	if req.Action == "" {
-		req.Action = "allow"
+
+	details := fmt.Sprintf("%s %s %s port=%s src=%s dst=%s priority=%d",
+		rule.Action, rule.Direction, rule.Protocol, rule.Port, rule.Source, rule.Destination, rule.Priority)
+	if req.Force {
+		details += " (forced)"
 	}
+	middleware.SetAudit(c, "firewall.rule_add", rule.Name, details)
 
-	if err := firewall.AddRule(req.Name, req.Port, req.Protocol, req.Action); err != nil {
+	pending, err := firewall.ApplyWithConfirm(firewall.Change{Add: &rule})
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": err.Error(),
 		})
@@ -55,6 +76,7 @@ func AddFirewallRule(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Rule added successfully",
+		"pending": pending,
 	})
 }
 
@@ -77,7 +99,10 @@ func DeleteFirewallRule(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := firewall.DeleteRule(req.Name); err != nil {
+	middleware.SetAudit(c, "firewall.rule_delete", req.Name, "")
+
+	pending, err := firewall.ApplyWithConfirm(firewall.Change{Delete: req.Name})
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": err.Error(),
 		})
@@ -86,5 +111,117 @@ func DeleteFirewallRule(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Rule deleted",
+		"pending": pending,
+	})
+}
+
+// GetFirewallPending returns the change awaiting confirmation, if any
+func GetFirewallPending(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"pending": firewall.GetPendingChange(),
+	})
+}
+
+// ConfirmFirewallChange keeps a pending firewall change
+func ConfirmFirewallChange(c *fiber.Ctx) error {
+	type Request struct {
+		ID string `json:"id"`
+	}
+
+	var req Request
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	middleware.SetAudit(c, "firewall.confirm", req.ID, "")
+
+	if err := firewall.ConfirmChange(req.ID); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Change confirmed",
+	})
+}
+
+// RollbackFirewallChange reverts a pending firewall change immediately
+func RollbackFirewallChange(c *fiber.Ctx) error {
+	type Request struct {
+		ID string `json:"id"`
+	}
+
+	var req Request
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	middleware.SetAudit(c, "firewall.rollback", req.ID, "")
+
+	if err := firewall.RollbackChange(req.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Change rolled back",
 	})
 }
+
+// GetFirewallDrift compares panel rules with the live OS ruleset
+func GetFirewallDrift(c *fiber.Ctx) error {
+	drift, err := firewall.DetectDrift()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(drift)
+}
+
+// ReconcileFirewall re-applies, adopts or deletes drifted rules. Like rule
+// edits, rules that would lock out the caller are skipped unless forced and
+// the changes roll back unless confirmed.
+func ReconcileFirewall(c *fiber.Ctx) error {
+	type Request struct {
+		Action string   `json:"action"`
+		Refs   []string `json:"refs"`
+		Force  bool     `json:"force"`
+	}
+
+	var req Request
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Action == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Action is required",
+		})
+	}
+
+	details := req.Action
+	if req.Force {
+		details += " (forced)"
+	}
+	middleware.SetAudit(c, "firewall.reconcile", strings.Join(req.Refs, ", "), details)
+
+	result, err := firewall.Reconcile(req.Action, req.Refs, c.IP(), req.Force)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(result)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"vps-panel/internal/services/metrics"
+)
+
+// parseMetricsTime accepts RFC 3339 or Unix seconds
+func parseMetricsTime(key, v string, fallback time.Time) (time.Time, error) {
+	if v == "" {
+		return fallback, nil
+	}
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, fmt.Errorf("invalid %s, use RFC 3339 or Unix seconds", key)
+	}
+	return t, nil
+}
+
+// GetMetricNames lists the metrics with stored history
+func GetMetricNames(c *fiber.Ctx) error {
+	names, err := metrics.Names()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"enabled": metrics.Enabled(),
+		"metrics": names,
+	})
+}
+
+// QueryMetrics returns a time series for ?metric= between ?from= and ?to=
+// (default: the last hour) in buckets of ?step= (a duration such as 5m, or
+// seconds; default: picked from the range)
+func QueryMetrics(c *fiber.Ctx) error {
+	to, err := parseMetricsTime("to", c.Query("to"), time.Now())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	from, err := parseMetricsTime("from", c.Query("from"), to.Add(-time.Hour))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var step time.Duration
+	if v := c.Query("step"); v != "" {
+		if sec, err := strconv.Atoi(v); err == nil {
+			step = time.Duration(sec) * time.Second
+		} else if step, err = time.ParseDuration(v); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "invalid step, use a duration such as 5m or seconds",
+			})
+		}
+	}
+
+	series, err := metrics.Query(c.Query("metric"), from, to, step)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(series)
+}
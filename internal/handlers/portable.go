@@ -1,7 +1,13 @@
 package handlers
 
 import (
+	"fmt"
+	"strconv"
+
+	"vps-panel/internal/middleware"
+	"vps-panel/internal/models"
 	"vps-panel/internal/services/appstore"
+	"vps-panel/internal/services/task"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -100,16 +106,30 @@ func InstallPortablePackage(c *fiber.Ctx) error {
 	}
 
 	// Get download URL to verify availability
-	downloadURL, err := appstore.GetDownloadURL(pkg, req.Version)
-	if err != nil {
+	if _, err := appstore.GetDownloadURL(pkg, req.Version); err != nil {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   err.Error(),
 			"message": "This package/version is not available for your platform",
 		})
 	}
 
-	// Perform installation
-	result, err := appstore.InstallPortablePackage(req.PackageID, req.Version, nil)
+	// Install in the background; progress is polled or streamed. The job
+	// fields keep clients of /api/portable/jobs working.
+	t, err := startTask(c, task.Options{
+		Type:   appstore.InstallTaskType,
+		Title:  "Install " + pkg.Name + " " + req.Version,
+		Target: req.PackageID + " " + req.Version,
+	}, appstore.InstallTask(req.PackageID, req.Version))
+	if err == task.ErrDuplicate {
+		job := appstore.JobFromTask(t)
+		return c.Status(409).JSON(fiber.Map{
+			"error":   err.Error(),
+			"task_id": t.ID,
+			"task":    t,
+			"job_id":  job.ID,
+			"job":     job,
+		})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   err.Error(),
@@ -117,12 +137,83 @@ func InstallPortablePackage(c *fiber.Ctx) error {
 		})
 	}
 
+	job := appstore.JobFromTask(t)
+	return c.Status(202).JSON(fiber.Map{
+		"success": true,
+		"task_id": t.ID,
+		"task":    t,
+		"job_id":  job.ID,
+		"job":     job,
+	})
+}
+
+// findPortableJob loads an install task of the current user for the
+// /api/portable/jobs aliases
+func findPortableJob(c *fiber.Ctx) (*models.Task, bool) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, false
+	}
+	t, err := task.Get(uint(id))
+	if err != nil || t.Type != appstore.InstallTaskType {
+		return nil, false
+	}
+	userID, _ := c.Locals("userID").(uint)
+	return t, t.UserID == userID
+}
+
+// GetPortableJobs lists your recent install tasks as jobs
+func GetPortableJobs(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(uint)
+	tasks, _, err := task.List(task.Filter{
+		Type:     appstore.InstallTaskType,
+		UserID:   userID,
+		Page:     1,
+		PageSize: 50,
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	jobs := make([]appstore.InstallJob, len(tasks))
+	for i := range tasks {
+		jobs[i] = appstore.JobFromTask(&tasks[i])
+	}
+	return c.JSON(jobs)
+}
+
+// GetPortableJob returns the progress of one of your install tasks
+func GetPortableJob(c *fiber.Ctx) error {
+	t, ok := findPortableJob(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Job not found",
+		})
+	}
+	return c.JSON(appstore.JobFromTask(t))
+}
+
+// CancelPortableJob cancels one of your install tasks, which removes what
+// it downloaded and extracted
+func CancelPortableJob(c *fiber.Ctx) error {
+	t, ok := findPortableJob(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Job not found",
+		})
+	}
+	if err := task.Cancel(t.ID); err != nil {
+		return c.Status(409).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	middleware.SetAudit(c, "portable.install_cancel", t.Target, fmt.Sprintf("task %d", t.ID))
 	return c.JSON(fiber.Map{
-		"success":      result.Status == "complete",
-		"message":      result.Message,
-		"status":       result.Status,
-		"install_path": result.InstallPath,
-		"download_url": downloadURL,
+		"success": true,
+		"message": "Cancelling installation",
 	})
 }
 
@@ -230,6 +321,10 @@ func StartService(c *fiber.Ctx) error {
 		})
 	}
 
+	if queued, err := initializeFirst(c, packageID, version, "start"); queued {
+		return err
+	}
+
 	if err := appstore.StartService(packageID, version); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   err.Error(),
@@ -278,6 +373,10 @@ func RestartService(c *fiber.Ctx) error {
 		})
 	}
 
+	if queued, err := initializeFirst(c, packageID, version, "restart"); queued {
+		return err
+	}
+
 	if err := appstore.RestartService(packageID, version); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   err.Error(),
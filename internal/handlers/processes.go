@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"vps-panel/internal/middleware"
+	"vps-panel/internal/services/process"
+)
+
+// processFilter is the filter shared by the REST listing and the live feed
+type processFilter struct {
+	Query string `json:"q"`
+	User  string `json:"user"`
+	Sort  string `json:"sort"`
+	Order string `json:"order"` // asc, desc
+	Limit int    `json:"limit"`
+}
+
+func (f processFilter) filter() (process.Filter, error) {
+	if !process.ValidSort(f.Sort) {
+		return process.Filter{}, fmt.Errorf("sort must be cpu, mem, rss, pid, name, user or started")
+	}
+	desc := f.Order == "desc"
+	if f.Order == "" {
+		// Resource columns read best biggest first
+		desc = f.Sort == "cpu" || f.Sort == "mem" || f.Sort == "rss"
+	}
+	return process.Filter{Query: f.Query, User: f.User, Sort: f.Sort, Desc: desc, Limit: f.Limit}, nil
+}
+
+func queryProcessFilter(query func(string, ...string) string, limit int) processFilter {
+	return processFilter{
+		Query: query("q"),
+		User:  query("user"),
+		Sort:  query("sort"),
+		Order: query("order"),
+		Limit: limit,
+	}
+}
+
+func processPID(c *fiber.Ctx) (int32, error) {
+	pid, err := strconv.Atoi(c.Params("pid"))
+	if err != nil || pid <= 0 {
+		return 0, c.Status(400).JSON(fiber.Map{
+			"error": "Invalid PID",
+		})
+	}
+	return int32(pid), nil
+}
+
+// GetProcesses lists processes, filtered by ?q= and ?user=, sorted by
+// ?sort= and ?order=, optionally as a tree with ?view=tree
+func GetProcesses(c *fiber.Ctx) error {
+	filter, err := queryProcessFilter(c.Query, c.QueryInt("limit", 0)).filter()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	procs, err := process.Snapshot()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Processes whose parent was filtered out become roots
+	if c.Query("view") == "tree" {
+		return c.JSON(fiber.Map{
+			"total": len(procs),
+			"tree":  process.Tree(process.Apply(procs, filter)),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"total":     len(procs),
+		"processes": process.Apply(procs, filter),
+	})
+}
+
+// GetProcess returns one process
+func GetProcess(c *fiber.Ctx) error {
+	pid, err := processPID(c)
+	if pid == 0 {
+		return err
+	}
+
+	p, err := process.Get(pid)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(p)
+}
+
+// SignalProcess sends TERM, KILL or HUP to a process
+func SignalProcess(c *fiber.Ctx) error {
+	pid, err := processPID(c)
+	if pid == 0 {
+		return err
+	}
+
+	var req struct {
+		Signal string `json:"signal"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	middleware.SetAudit(c, "process.signal", strconv.Itoa(int(pid)), req.Signal)
+	if err := process.Signal(pid, req.Signal); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// ReniceProcess changes a process's nice value
+func ReniceProcess(c *fiber.Ctx) error {
+	pid, err := processPID(c)
+	if pid == 0 {
+		return err
+	}
+
+	var req struct {
+		Nice *int `json:"nice"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Nice == nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "nice is required",
+		})
+	}
+
+	middleware.SetAudit(c, "process.renice", strconv.Itoa(int(pid)), strconv.Itoa(*req.Nice))
+	if err := process.Renice(pid, *req.Nice); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// ProcessesHandler streams a top-like process list every ?interval= seconds
+// (default 2). The client can change the filter by sending it as JSON, e.g.
+// {"q": "nginx", "sort": "mem"}.
+func ProcessesHandler(c *websocket.Conn) {
+	interval := 2 * time.Second
+	if v, err := strconv.Atoi(c.Query("interval")); err == nil && v >= 1 && v <= 60 {
+		interval = time.Duration(v) * time.Second
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = 50
+	}
+	initial := queryProcessFilter(c.Query, limit)
+	if initial.Sort == "" {
+		initial.Sort = "cpu"
+	}
+
+	// mu guards the filter and writes, which the reader also makes
+	var mu sync.Mutex
+	filter, err := initial.filter()
+	if err != nil {
+		c.WriteJSON(fiber.Map{"type": "error", "message": err.Error()})
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			_, message, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			next := initial
+			if err := json.Unmarshal(message, &next); err != nil {
+				continue
+			}
+			if next.Limit <= 0 {
+				next.Limit = limit
+			}
+			f, err := next.filter()
+			mu.Lock()
+			if err != nil {
+				c.WriteJSON(fiber.Map{"type": "error", "message": err.Error()})
+			} else {
+				filter = f
+			}
+			mu.Unlock()
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		procs, err := process.Snapshot()
+		if err == nil {
+			mu.Lock()
+			err = c.WriteJSON(fiber.Map{
+				"type":      "processes",
+				"time":      time.Now().Unix(),
+				"total":     len(procs),
+				"processes": process.Apply(procs, filter),
+			})
+			mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
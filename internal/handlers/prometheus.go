@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"vps-panel/internal/services/prometheus"
+)
+
+// PrometheusMetrics serves host, service, container, cron and panel metrics
+// in the Prometheus text format
+func PrometheusMetrics(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return prometheus.Write(c.Response().BodyWriter())
+}
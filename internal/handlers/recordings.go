@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"vps-panel/internal/services/terminal"
+)
+
+// GetTerminalRecordings lists recorded terminal sessions, newest first
+func GetTerminalRecordings(c *fiber.Ctx) error {
+	recordings, err := terminal.GetRecordings(c.Query("username"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(recordings)
+}
+
+// GetTerminalRecording returns the asciicast file of a recording
+func GetTerminalRecording(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+
+	_, path, err := terminal.RecordingPath(uint(id))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Recording file not found",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/x-asciicast")
+	return c.Send(data)
+}
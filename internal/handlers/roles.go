@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"vps-panel/internal/services/rbac"
+)
+
+// GetRoles returns the roles and the permissions that can be granted
+func GetRoles(c *fiber.Ctx) error {
+	roles, err := rbac.GetRoles()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"roles":       roles,
+		"permissions": rbac.AllPermissions,
+	})
+}
@@ -48,6 +48,12 @@ func ServiceAction(c *fiber.Ctx) error {
 		})
 	}
 
+	if action == "start" || action == "restart" {
+		if queued, err := initializeFirst(c, packageID, version, action); queued {
+			return err
+		}
+	}
+
 	var err error
 	var message string
 
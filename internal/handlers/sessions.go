@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"vps-panel/internal/middleware"
+	"vps-panel/internal/services/session"
+)
+
+type SessionResponse struct {
+	ID         uint      `json:"id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	Current    bool      `json:"current"`
+}
+
+// GetSessions lists the caller's active sessions
+func GetSessions(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+
+	sessions, err := session.List(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	current := c.Locals("jti").(string)
+	result := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		result = append(result, SessionResponse{
+			ID:         s.ID,
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			CreatedAt:  s.CreatedAt,
+			Current:    s.JTI == current,
+		})
+	}
+	return c.JSON(result)
+}
+
+// RevokeSession ends one of the caller's sessions
+func RevokeSession(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+
+	if err := session.Revoke(userID, uint(id)); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	middleware.SetAudit(c, "auth.session_revoke", c.Params("id"), "")
+
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// RevokeAllSessions logs the caller out everywhere, including this client
+func RevokeAllSessions(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+
+	count, err := session.RevokeAll(userID, "")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	middleware.SetAudit(c, "auth.logout_all", "", fmt.Sprintf("Revoked %d sessions", count))
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "token",
+		Value:    "",
+		HTTPOnly: true,
+		MaxAge:   -1,
+		Path:     "/",
+	})
+
+	return c.JSON(fiber.Map{
+		"revoked": count,
+	})
+}
+
+// IssueWebSocketTicket returns a one-time ticket for opening a WebSocket
+// from clients that authenticate with a bearer token instead of the cookie
+func IssueWebSocketTicket(c *fiber.Ctx) error {
+	perms, _ := c.Locals("permissions").([]string)
+	ticket, err := session.IssueTicket(session.Ticket{
+		UserID:      c.Locals("userID").(uint),
+		Username:    c.Locals("username").(string),
+		Role:        c.Locals("role").(string),
+		Permissions: perms,
+		JTI:         c.Locals("jti").(string),
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to issue ticket",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"ticket": ticket,
+	})
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"vps-panel/internal/middleware"
+	"vps-panel/internal/models"
+	"vps-panel/internal/services/appstore"
+	"vps-panel/internal/services/rbac"
+	"vps-panel/internal/services/task"
+)
+
+// enqueueTask starts a background task on behalf of the current user and
+// answers 202 with its ID, or 409 with the task already doing the same work
+func enqueueTask(c *fiber.Ctx, opts task.Options, fn task.Func) error {
+	t, err := startTask(c, opts, fn)
+	if err == task.ErrDuplicate {
+		return c.Status(409).JSON(fiber.Map{
+			"error":   err.Error(),
+			"task_id": t.ID,
+			"task":    t,
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(202).JSON(fiber.Map{
+		"success": true,
+		"task_id": t.ID,
+		"task":    t,
+	})
+}
+
+// startTask enqueues a task on behalf of the current user and audits it.
+// On ErrDuplicate the task already doing the same work is returned.
+func startTask(c *fiber.Ctx, opts task.Options, fn task.Func) (*models.Task, error) {
+	opts.UserID, _ = c.Locals("userID").(uint)
+	opts.Username, _ = c.Locals("username").(string)
+
+	t, err := task.Enqueue(opts, fn)
+	if err == nil {
+		middleware.SetAudit(c, opts.Type, opts.Target, fmt.Sprintf("task %d", t.ID))
+	}
+	return t, err
+}
+
+// initializeFirst answers with a "mysql.init" task when starting or
+// restarting the service first needs a data directory, which can take
+// minutes. It reports false when the service can start right away.
+func initializeFirst(c *fiber.Ctx, packageID, version, action string) (bool, error) {
+	if !appstore.NeedsInitialize(packageID, version) {
+		return false, nil
+	}
+	return true, enqueueTask(c, task.Options{
+		Type:   "mysql.init",
+		Title:  "Initialize " + packageID + " " + version,
+		Target: packageID + " " + version,
+	}, appstore.InitializeTask(packageID, version, action))
+}
+
+// findTask loads a task the current user may see; users without
+// tasks:read only see their own
+func findTask(c *fiber.Ctx) (*models.Task, bool) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, false
+	}
+	t, err := task.Get(uint(id))
+	if err != nil {
+		return nil, false
+	}
+	userID, _ := c.Locals("userID").(uint)
+	if t.UserID != userID && !middleware.HasPermission(c, rbac.TasksRead) {
+		return nil, false
+	}
+	return t, true
+}
+
+// GetTasks returns a page of tasks, newest first
+func GetTasks(c *fiber.Ctx) error {
+	filter := task.Filter{
+		Type:     c.Query("type"),
+		Status:   c.Query("status"),
+		Page:     c.QueryInt("page", 1),
+		PageSize: c.QueryInt("page_size", 50),
+	}
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 || filter.PageSize > 500 {
+		filter.PageSize = 50
+	}
+	if !middleware.HasPermission(c, rbac.TasksRead) {
+		filter.UserID, _ = c.Locals("userID").(uint)
+	}
+
+	tasks, total, err := task.List(filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"tasks":     tasks,
+		"total":     total,
+		"page":      filter.Page,
+		"page_size": filter.PageSize,
+	})
+}
+
+// GetTask returns a task with its output
+func GetTask(c *fiber.Ctx) error {
+	t, ok := findTask(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Task not found",
+		})
+	}
+	return c.JSON(t)
+}
+
+// CancelTask stops a queued or running task. Other users' tasks need
+// tasks:manage.
+func CancelTask(c *fiber.Ctx) error {
+	t, ok := findTask(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Task not found",
+		})
+	}
+
+	userID, _ := c.Locals("userID").(uint)
+	if t.UserID != userID && !middleware.HasPermission(c, rbac.TasksManage) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Permission required: " + rbac.TasksManage,
+		})
+	}
+
+	if err := task.Cancel(t.ID); err != nil {
+		return c.Status(409).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	middleware.SetAudit(c, "task.cancel", t.Target, fmt.Sprintf("%s task %d", t.Type, t.ID))
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Cancelling task",
+	})
+}
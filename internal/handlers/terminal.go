@@ -3,12 +3,18 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
-	"io"
-	"os/exec"
-	"runtime"
+	"log"
+	"strconv"
 
-	"github.com/creack/pty"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
 	"github.com/gofiber/websocket/v2"
+	"vps-panel/internal/database"
+	"vps-panel/internal/middleware"
+	"vps-panel/internal/models"
+	"vps-panel/internal/services/activity"
+	"vps-panel/internal/services/rbac"
+	"vps-panel/internal/services/terminal"
 )
 
 // TerminalMessage represents a message from the frontend
@@ -19,67 +25,160 @@ type TerminalMessage struct {
 	Rows int    `json:"rows,omitempty"`
 }
 
-// TerminalHandler handles the websocket connection for the terminal
+// TerminalEvent is a control message sent to the frontend as a text frame;
+// terminal output itself is sent as binary frames
+type TerminalEvent struct {
+	Type    string `json:"type"` // "session", "presence", "exit" or "error"
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Owner   string `json:"owner,omitempty"`
+	Mode    string `json:"mode,omitempty"` // The user's access to the session
+	Message string `json:"message,omitempty"`
+}
+
+// terminalPermissions lists what a user needs to open a target. Containers
+// only need terminal:docker; switching user also needs a host shell.
+func terminalPermissions(target terminal.Target) []string {
+	if target.Container != "" {
+		return []string{rbac.TerminalDocker}
+	}
+	if target.User != "" {
+		return []string{rbac.TerminalOpen, rbac.TerminalSwitchUser}
+	}
+	return []string{rbac.TerminalOpen}
+}
+
+// TerminalAccess runs before the WebSocket upgrade and checks that the user
+// may open the target given by ?user=, ?dir= and ?container=, or attach to
+// ?session=. Watching a session shared read-only needs no permission of its
+// own; typing into one needs the same permissions as opening its target.
+func TerminalAccess(c *fiber.Ctx) error {
+	var target terminal.Target
+	if id := c.Query("session"); id != "" {
+		userID, _ := c.Locals("userID").(uint)
+		sess := terminal.Get(id)
+		mode := ""
+		if sess != nil {
+			mode = sess.Access(userID)
+		}
+		if mode == "" {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Terminal session not found",
+			})
+		}
+		if mode == terminal.ModeRead {
+			return c.Next()
+		}
+		target = sess.Target
+	} else {
+		// Query values point into the request buffer; the target outlives it
+		target = terminal.Target{
+			User:      utils.CopyString(c.Query("user")),
+			Dir:       utils.CopyString(c.Query("dir")),
+			Container: utils.CopyString(c.Query("container")),
+		}
+		if err := target.Validate(); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	for _, perm := range terminalPermissions(target) {
+		if !middleware.HasPermission(c, perm) {
+			userID, _ := c.Locals("userID").(uint)
+			username, _ := c.Locals("username").(string)
+			activity.Log(userID, username, c.IP(), "terminal.open_failed", target.String(), "Permission required: "+perm)
+			return c.Status(403).JSON(fiber.Map{
+				"error": "Permission required: " + perm,
+			})
+		}
+	}
+
+	c.Locals("terminalTarget", target)
+	return c.Next()
+}
+
+// TerminalHandler handles the websocket connection for the terminal. With
+// ?session=<id> it reattaches to a running session, otherwise it starts a
+// new one named by ?name= on the target checked by TerminalAccess, sized
+// by ?cols= and ?rows=.
+// Disconnecting leaves the shell running.
 func TerminalHandler(c *websocket.Conn) {
-	var cmd *exec.Cmd
+	userID, _ := c.Locals("userID").(uint)
+	username, _ := c.Locals("username").(string)
+	ip, _ := c.Locals("ip").(string)
+	target, _ := c.Locals("terminalTarget").(terminal.Target)
 
-	// Determine shell based on OS
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("cmd.exe")
+	var sess *terminal.Session
+	if id := c.Query("session"); id != "" {
+		sess = terminal.Get(id)
+		if sess == nil || sess.Access(userID) == "" {
+			sendTerminalEvent(c, TerminalEvent{Type: "error", Message: "Terminal session not found"})
+			return
+		}
+		details := sess.Name
+		if sess.UserID != userID {
+			details = fmt.Sprintf("%s (shared by %s, %s)", sess.Name, sess.Username, sess.Access(userID))
+		}
+		activity.Log(userID, username, ip, "terminal.attach", sess.Target.String(), details)
 	} else {
-		cmd = exec.Command("bash")
-		// Fallback to sh if bash not found
-		if _, err := exec.LookPath("bash"); err != nil {
-			cmd = exec.Command("sh")
+		cols, _ := strconv.Atoi(c.Query("cols"))
+		rows, _ := strconv.Atoi(c.Query("rows"))
+		var err error
+		sess, err = terminal.Create(userID, username, ip, c.Query("name"), target, cols, rows)
+		if err != nil {
+			log.Printf("Terminal: failed to start session for %s: %v", username, err)
+			sendTerminalEvent(c, TerminalEvent{Type: "error", Message: "Failed to start terminal: " + err.Error()})
+			return
 		}
 	}
 
-	// Start PTY
-	ptmx, err := pty.Start(cmd)
+	client, scrollback, err := sess.Attach(userID, username)
 	if err != nil {
-		fmt.Printf("Terminal Error: Failed to start PTY: %v\n", err)
-		c.WriteMessage(websocket.TextMessage, []byte("Failed to start terminal: "+err.Error()))
+		sendTerminalEvent(c, TerminalEvent{Type: "error", Message: err.Error()})
 		return
 	}
-	defer func() {
-		fmt.Println("Terminal closing...")
-		_ = ptmx.Close()
-		_ = cmd.Process.Kill()
-	}()
+	defer sess.Detach(client)
 
-	fmt.Println("Terminal started successfully")
-
-	// Handle window resize
-	chResize := make(chan TerminalMessage)
-	go func() {
-		for msg := range chResize {
-			if err := pty.Setsize(ptmx, &pty.Winsize{
-				Rows: uint16(msg.Rows),
-				Cols: uint16(msg.Cols),
-			}); err != nil {
-				// Ignore resize errors
-			}
+	if err := sendTerminalEvent(c, TerminalEvent{
+		Type:  "session",
+		ID:    sess.ID,
+		Name:  sess.Name,
+		Owner: sess.Username,
+		Mode:  sess.Access(userID),
+	}); err != nil {
+		return
+	}
+	if len(scrollback) > 0 {
+		if err := c.WriteMessage(websocket.BinaryMessage, scrollback); err != nil {
+			return
 		}
-	}()
+	}
 
-	// Copy PTY output to Websocket
+	// Copy session output to Websocket
+	writerDone := make(chan struct{})
 	go func() {
-		buffer := make([]byte, 1024)
-		for {
-			n, err := ptmx.Read(buffer)
-			if err != nil {
-				if err != io.EOF {
-					// PTY closed
-				}
-				return
+		defer close(writerDone)
+		for frame := range client.Output() {
+			messageType := websocket.BinaryMessage
+			if frame.Event {
+				messageType = websocket.TextMessage
 			}
-			if err := c.WriteMessage(websocket.BinaryMessage, buffer[:n]); err != nil {
+			if err := c.WriteMessage(messageType, frame.Data); err != nil {
+				c.Close()
 				return
 			}
 		}
+		select {
+		case <-sess.Done():
+			sendTerminalEvent(c, TerminalEvent{Type: "exit", ID: sess.ID})
+		default:
+		}
+		c.Close()
 	}()
 
-	// Read from Websocket and write to PTY
+	// Read from Websocket and write to the session
 	for {
 		messageType, message, err := c.ReadMessage()
 		if err != nil {
@@ -90,18 +189,136 @@ func TerminalHandler(c *websocket.Conn) {
 			var msg TerminalMessage
 			if err := json.Unmarshal(message, &msg); err == nil {
 				if msg.Type == "resize" {
-					chResize <- msg
+					sess.Resize(client, msg.Cols, msg.Rows)
 					continue
 				}
 				if msg.Type == "input" {
-					ptmx.Write([]byte(msg.Data))
+					sess.Input(client, []byte(msg.Data))
 				}
 			} else {
 				// Raw input fallback
-				ptmx.Write(message)
+				sess.Input(client, message)
 			}
 		} else if messageType == websocket.BinaryMessage {
-			ptmx.Write(message)
+			sess.Input(client, message)
 		}
 	}
+
+	sess.Detach(client)
+	<-writerDone
+}
+
+func sendTerminalEvent(c *websocket.Conn, event TerminalEvent) error {
+	data, _ := json.Marshal(event)
+	return c.WriteMessage(websocket.TextMessage, data)
+}
+
+// GetTerminalSessions lists the current user's running terminal sessions
+func GetTerminalSessions(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(uint)
+	return c.JSON(terminal.List(userID))
+}
+
+// ownTerminalSession looks up a session owned by the current user
+func ownTerminalSession(c *fiber.Ctx) (*terminal.Session, error) {
+	userID, _ := c.Locals("userID").(uint)
+	sess := terminal.Get(c.Params("id"))
+	if sess == nil || sess.UserID != userID {
+		return nil, c.Status(404).JSON(fiber.Map{
+			"error": "Terminal session not found",
+		})
+	}
+	return sess, nil
+}
+
+// CloseTerminalSession kills one of the current user's terminal sessions
+func CloseTerminalSession(c *fiber.Ctx) error {
+	sess, err := ownTerminalSession(c)
+	if sess == nil {
+		return err
+	}
+
+	sess.Kill()
+	middleware.SetAudit(c, "terminal.close", sess.Target.String(), sess.Name)
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// ShareTerminalSession invites another panel user into one of the current
+// user's sessions, read-only or read-write
+func ShareTerminalSession(c *fiber.Ctx) error {
+	sess, err := ownTerminalSession(c)
+	if sess == nil {
+		return err
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Mode     string `json:"mode"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request",
+		})
+	}
+	if req.Mode == "" {
+		req.Mode = terminal.ModeRead
+	}
+	if req.Mode != terminal.ModeRead && req.Mode != terminal.ModeWrite {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Mode must be read or write",
+		})
+	}
+
+	var user models.User
+	if err := database.DB.Where("username = ?", req.Username).First(&user).Error; err != nil || user.Disabled {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if user.ID == sess.UserID {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "You already own this session",
+		})
+	}
+
+	// Typing into the shell is the same as opening it
+	if req.Mode == terminal.ModeWrite {
+		perms := rbac.Permissions(user.Role)
+		for _, perm := range terminalPermissions(sess.Target) {
+			if !rbac.Has(perms, perm) {
+				return c.Status(403).JSON(fiber.Map{
+					"error": fmt.Sprintf("%s lacks %s and can only be invited read-only", user.Username, perm),
+				})
+			}
+		}
+	}
+
+	sess.Share(user.ID, user.Username, req.Mode)
+	middleware.SetAudit(c, "terminal.share", sess.Target.String(), fmt.Sprintf("%s with %s (%s)", sess.Name, user.Username, req.Mode))
+	return c.JSON(sess.Shares())
+}
+
+// UnshareTerminalSession withdraws an invite and disconnects the user
+func UnshareTerminalSession(c *fiber.Ctx) error {
+	sess, err := ownTerminalSession(c)
+	if sess == nil {
+		return err
+	}
+
+	userID, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+	if !sess.Unshare(uint(userID)) {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "User is not invited to this session",
+		})
+	}
+
+	middleware.SetAudit(c, "terminal.unshare", sess.Target.String(), fmt.Sprintf("%s, user %d", sess.Name, userID))
+	return c.JSON(sess.Shares())
 }
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"vps-panel/internal/database"
+	"vps-panel/internal/middleware"
+	"vps-panel/internal/models"
+	"vps-panel/internal/services/rbac"
+	"vps-panel/internal/services/session"
+)
+
+var usernameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,50}$`)
+
+func validatePassword(password string) error {
+	if len(password) < 8 {
+		return fmt.Errorf("Password must be at least 8 characters")
+	}
+	// bcrypt only takes 72 bytes and refuses longer passwords
+	if len(password) > 72 {
+		return fmt.Errorf("Password must be at most 72 bytes")
+	}
+	if password == defaultAdminPassword {
+		return fmt.Errorf("Password is too common")
+	}
+	return nil
+}
+
+// activeAdmins counts enabled admin accounts
+func activeAdmins() int64 {
+	var count int64
+	database.DB.Model(&models.User{}).Where("role = ? AND disabled = ?", rbac.RoleAdmin, false).Count(&count)
+	return count
+}
+
+func findUser(c *fiber.Ctx) (*models.User, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, id).Error; err != nil {
+		return nil, c.Status(404).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	return &user, nil
+}
+
+// GetUsers lists panel users
+func GetUsers(c *fiber.Ctx) error {
+	var users []models.User
+	if err := database.DB.Order("id asc").Find(&users).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(users)
+}
+
+// GetUser returns a single panel user
+func GetUser(c *fiber.Ctx) error {
+	user, err := findUser(c)
+	if user == nil {
+		return err
+	}
+	return c.JSON(user)
+}
+
+// CreateUser adds a panel user. The password is temporary unless
+// must_change_password is explicitly false.
+func CreateUser(c *fiber.Ctx) error {
+	type Request struct {
+		Username           string `json:"username"`
+		Email              string `json:"email"`
+		Password           string `json:"password"`
+		Role               string `json:"role"`
+		MustChangePassword *bool  `json:"must_change_password"`
+	}
+
+	var req Request
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if !usernameRe.MatchString(req.Username) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Username must be 3-50 letters, digits, '_', '.' or '-'",
+		})
+	}
+	if req.Email == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Email is required",
+		})
+	}
+	if err := validatePassword(req.Password); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if req.Role == "" {
+		req.Role = rbac.RoleReadOnly
+	}
+	if !rbac.RoleExists(req.Role) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Unknown role '" + req.Role + "'",
+		})
+	}
+
+	user := models.User{
+		Username:           req.Username,
+		Email:              req.Email,
+		Role:               req.Role,
+		MustChangePassword: req.MustChangePassword == nil || *req.MustChangePassword,
+	}
+	if err := user.SetPassword(req.Password); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid password: " + err.Error(),
+		})
+	}
+
+	if err := database.DB.Create(&user).Error; err != nil {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "Username or email already exists",
+		})
+	}
+
+	middleware.SetAudit(c, "user.create", user.Username, "Role "+user.Role)
+
+	return c.JSON(user)
+}
+
+// UpdateUser changes a user's email or role, or resets their password. A
+// reset password must be changed at the next login.
+func UpdateUser(c *fiber.Ctx) error {
+	type Request struct {
+		Email    *string `json:"email"`
+		Role     *string `json:"role"`
+		Password *string `json:"password"`
+	}
+
+	user, err := findUser(c)
+	if user == nil {
+		return err
+	}
+
+	var req Request
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	var changes []string
+	revoke := false
+	if req.Email != nil && *req.Email != user.Email {
+		if *req.Email == "" {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Email is required",
+			})
+		}
+		user.Email = *req.Email
+		changes = append(changes, "email")
+	}
+	if req.Role != nil && *req.Role != user.Role {
+		if !rbac.RoleExists(*req.Role) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Unknown role '" + *req.Role + "'",
+			})
+		}
+		if user.Role == rbac.RoleAdmin && !user.Disabled && activeAdmins() <= 1 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Cannot demote the last admin",
+			})
+		}
+		changes = append(changes, fmt.Sprintf("role %s -> %s", user.Role, *req.Role))
+		user.Role = *req.Role
+		revoke = true
+	}
+	if req.Password != nil {
+		if err := validatePassword(*req.Password); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if err := user.SetPassword(*req.Password); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid password: " + err.Error(),
+			})
+		}
+		user.MustChangePassword = true
+		changes = append(changes, "password reset")
+		revoke = true
+	}
+
+	if err := database.DB.Save(user).Error; err != nil {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "Email already in use",
+		})
+	}
+
+	// Tokens carry the role's permissions, so make the user log in again
+	if revoke {
+		session.RevokeAll(user.ID, "")
+	}
+
+	middleware.SetAudit(c, "user.update", user.Username, strings.Join(changes, ", "))
+
+	return c.JSON(user)
+}
+
+// SetUserDisabled returns a handler that disables or re-enables an account
+func SetUserDisabled(disabled bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := findUser(c)
+		if user == nil {
+			return err
+		}
+
+		if disabled {
+			if user.ID == c.Locals("userID").(uint) {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "You cannot disable your own account",
+				})
+			}
+			if user.Role == rbac.RoleAdmin && !user.Disabled && activeAdmins() <= 1 {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Cannot disable the last admin",
+				})
+			}
+		}
+
+		if err := database.DB.Model(user).Update("disabled", disabled).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		action := "user.enable"
+		if disabled {
+			action = "user.disable"
+			session.RevokeAll(user.ID, "")
+		}
+		middleware.SetAudit(c, action, user.Username, "")
+
+		return c.JSON(user)
+	}
+}
+
+// DeleteUser removes a panel user
+func DeleteUser(c *fiber.Ctx) error {
+	user, err := findUser(c)
+	if user == nil {
+		return err
+	}
+
+	if user.ID == c.Locals("userID").(uint) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "You cannot delete your own account",
+		})
+	}
+	if user.Role == rbac.RoleAdmin && !user.Disabled && activeAdmins() <= 1 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot delete the last admin",
+		})
+	}
+
+	// Hard delete so the username and email can be reused
+	if err := database.DB.Unscoped().Delete(user).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	session.RevokeAll(user.ID, "")
+	middleware.SetAudit(c, "user.delete", user.Username, "")
+
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// GetUserSessions lists a user's active sessions
+func GetUserSessions(c *fiber.Ctx) error {
+	user, err := findUser(c)
+	if user == nil {
+		return err
+	}
+
+	sessions, err := session.List(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(sessions)
+}
+
+// RevokeUserSessions logs a user out everywhere
+func RevokeUserSessions(c *fiber.Ctx) error {
+	user, err := findUser(c)
+	if user == nil {
+		return err
+	}
+
+	count, err := session.RevokeAll(user.ID, "")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	middleware.SetAudit(c, "user.sessions_revoke", user.Username, fmt.Sprintf("Revoked %d sessions", count))
+
+	return c.JSON(fiber.Map{
+		"revoked": count,
+	})
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"fmt"
 	"path/filepath"
+	"vps-panel/internal/middleware"
 	"vps-panel/internal/services/appstore"
 	"vps-panel/internal/services/webserver"
 
@@ -52,6 +53,8 @@ func CreateSite(c *fiber.Ctx) error {
 		site.Root = filepath.Join(wwwDir, site.Name)
 	}
 
+	middleware.SetAudit(c, "site.create", site.Name, fmt.Sprintf("%s:%d -> %s", site.Domain, site.Port, site.Root))
+
 	if err := webserver.CreateSite(site); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": err.Error(),
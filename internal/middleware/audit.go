@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"vps-panel/internal/models"
+	"vps-panel/internal/services/activity"
+)
+
+// auditInfo is what handlers add to the audit entry of their request
+type auditInfo struct {
+	Action  string
+	Target  string
+	Details string
+}
+
+// SetAudit names the action and target recorded for the current request,
+// replacing the generic "METHOD /path" entry
+func SetAudit(c *fiber.Ctx, action, target, details string) {
+	c.Locals("audit", &auditInfo{Action: action, Target: target, Details: details})
+}
+
+// AuditLog records every mutating request after it has been handled,
+// including failed and refused ones. Mount it after AuthRequired.
+func AuditLog() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return c.Next()
+		}
+
+		// Copy the request before the handler runs; fasthttp reuses buffers
+		body := append([]byte(nil), c.Body()...)
+		query := string(c.Request().URI().QueryString())
+		contentType := string(c.Request().Header.ContentType())
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			}
+		}
+
+		entry := models.ActivityLog{
+			Action:  c.Method() + " " + c.Route().Path,
+			Target:  defaultTarget(c),
+			Method:  c.Method(),
+			Path:    c.Path(),
+			Status:  status,
+			Payload: activity.RedactPayload(contentType, body, query),
+			IP:      c.IP(),
+		}
+		if userID, ok := c.Locals("userID").(uint); ok {
+			entry.UserID = userID
+		}
+		if username, ok := c.Locals("username").(string); ok {
+			entry.Username = username
+		}
+		if info, ok := c.Locals("audit").(*auditInfo); ok {
+			entry.Action = info.Action
+			if info.Target != "" {
+				entry.Target = info.Target
+			}
+			entry.Details = info.Details
+		}
+
+		activity.Record(entry)
+		return err
+	}
+}
+
+// defaultTarget uses the route parameters, or a path query parameter as used
+// by the file manager
+func defaultTarget(c *fiber.Ctx) string {
+	params := c.AllParams()
+	if len(params) == 0 {
+		return c.Query("path")
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, params[k])
+	}
+	return strings.Join(parts, "/")
+}
@@ -1,29 +1,40 @@
 package middleware
 
 import (
+	"errors"
 	"strings"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"vps-panel/internal/config"
+	"vps-panel/internal/models"
+	"vps-panel/internal/services/rbac"
+	"vps-panel/internal/services/session"
 )
 
 type JWTClaims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID      uint     `json:"user_id"`
+	Username    string   `json:"username"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+	// Only the /api/auth endpoints are usable until the password is changed
+	MustChangePassword bool `json:"must_change_password,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID uint, username, role string) (string, error) {
+// GenerateToken issues a token for a session; the session's JTI lets
+// AuthRequired reject it once the session is revoked
+func GenerateToken(user *models.User, s *models.Session) (string, error) {
 	claims := JWTClaims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
+		UserID:             user.ID,
+		Username:           user.Username,
+		Role:               user.Role,
+		Permissions:        rbac.Permissions(user.Role),
+		MustChangePassword: user.MustChangePassword,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.AppConfig.JWT.Expiry)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        s.JTI,
+			ExpiresAt: jwt.NewNumericDate(s.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(s.CreatedAt),
 		},
 	}
 
@@ -31,6 +42,27 @@ func GenerateToken(userID uint, username, role string) (string, error) {
 	return token.SignedString([]byte(config.AppConfig.JWT.Secret))
 }
 
+// ParseToken verifies a token and the session behind it
+func ParseToken(tokenStr string) (*JWTClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.AppConfig.JWT.Secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+
+	if err != nil || !token.Valid {
+		return nil, errors.New("Invalid token")
+	}
+
+	claims, ok := token.Claims.(*JWTClaims)
+	if !ok {
+		return nil, errors.New("Invalid token claims")
+	}
+
+	if !session.Validate(claims.ID) {
+		return nil, errors.New("Session expired or revoked")
+	}
+	return claims, nil
+}
+
 func AuthRequired() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
@@ -47,20 +79,17 @@ func AuthRequired() fiber.Handler {
 			authHeader = strings.TrimPrefix(authHeader, "Bearer ")
 		}
 
-		token, err := jwt.ParseWithClaims(authHeader, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.AppConfig.JWT.Secret), nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := ParseToken(authHeader)
+		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid token",
+				"error": err.Error(),
 			})
 		}
 
-		claims, ok := token.Claims.(*JWTClaims)
-		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid token claims",
+		if claims.MustChangePassword && !strings.HasPrefix(c.Path(), "/api/auth/") {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":                "Password change required",
+				"must_change_password": true,
 			})
 		}
 
@@ -68,6 +97,8 @@ func AuthRequired() fiber.Handler {
 		c.Locals("userID", claims.UserID)
 		c.Locals("username", claims.Username)
 		c.Locals("role", claims.Role)
+		c.Locals("permissions", claims.Permissions)
+		c.Locals("jti", claims.ID)
 
 		return c.Next()
 	}
@@ -84,3 +115,38 @@ func AdminRequired() fiber.Handler {
 		return c.Next()
 	}
 }
+
+// RequirePermission rejects users whose token lacks the permission
+func RequirePermission(perm string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !HasPermission(c, perm) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Permission required: " + perm,
+			})
+		}
+		return c.Next()
+	}
+}
+
+// ModulePermission guards a route group: GET and HEAD requests need read,
+// everything else needs write
+func ModulePermission(read, write string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		perm := write
+		if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+			perm = read
+		}
+		if !HasPermission(c, perm) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Permission required: " + perm,
+			})
+		}
+		return c.Next()
+	}
+}
+
+// HasPermission reports whether the authenticated user holds perm
+func HasPermission(c *fiber.Ctx, perm string) bool {
+	perms, _ := c.Locals("permissions").([]string)
+	return rbac.Has(perms, perm)
+}
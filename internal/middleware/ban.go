@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"vps-panel/internal/services/ban"
+)
+
+// NotBanned rejects requests from banned IPs
+func NotBanned() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if ban.IsBanned(c.IP()) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Your IP is temporarily banned",
+			})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"vps-panel/internal/config"
+	"vps-panel/internal/services/ban"
+	"vps-panel/internal/services/prometheus"
+)
+
+// RequestMetrics records the latency of every request by route pattern
+func RequestMetrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+		// Requests no route matched report this middleware's own route
+		route := c.Route().Path
+		if status == fiber.StatusNotFound && route == "/" && c.Path() != "/" {
+			route = "unmatched"
+		}
+		prometheus.ObserveRequest(c.Method(), route, status, time.Since(start))
+		return err
+	}
+}
+
+// ScrapeToken guards /metrics with the bearer token from prometheus.token.
+// The endpoint doesn't exist while no token is configured.
+func ScrapeToken() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := config.AppConfig.Prometheus.Token
+		if token == "" {
+			return fiber.ErrNotFound
+		}
+
+		given := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			ban.RecordFailure(c.IP(), "", "metrics")
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid scrape token",
+			})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"vps-panel/internal/config"
+	"vps-panel/internal/services/session"
+)
+
+// WebSocketAuth authenticates WebSocket upgrades with the session cookie or
+// a one-time ticket from POST /api/ws/ticket, and rejects cross-site origins
+func WebSocketAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !originAllowed(c) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Origin not allowed",
+			})
+		}
+
+		if ticket := c.Query("ticket"); ticket != "" {
+			t, ok := session.RedeemTicket(ticket)
+			if !ok {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid or expired ticket",
+				})
+			}
+			c.Locals("userID", t.UserID)
+			c.Locals("username", t.Username)
+			c.Locals("role", t.Role)
+			c.Locals("permissions", t.Permissions)
+			c.Locals("jti", t.JTI)
+			return c.Next()
+		}
+
+		tokenStr := c.Cookies("token")
+		if tokenStr == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Missing authorization",
+			})
+		}
+
+		claims, err := ParseToken(tokenStr)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if claims.MustChangePassword {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":                "Password change required",
+				"must_change_password": true,
+			})
+		}
+
+		c.Locals("userID", claims.UserID)
+		c.Locals("username", claims.Username)
+		c.Locals("role", claims.Role)
+		c.Locals("permissions", claims.Permissions)
+		c.Locals("jti", claims.ID)
+		return c.Next()
+	}
+}
+
+// originAllowed accepts requests without an Origin (non-browser clients),
+// from the panel's own host, or from server.allowed_origins
+func originAllowed(c *fiber.Ctx) bool {
+	origin := c.Get(fiber.HeaderOrigin)
+	if origin == "" {
+		return true
+	}
+
+	for _, allowed := range config.AppConfig.Server.AllowedOrigins {
+		if strings.EqualFold(origin, strings.TrimSuffix(allowed, "/")) {
+			return true
+		}
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, c.Hostname())
+}
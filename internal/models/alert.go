@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+type AlertRule struct {
+	ID        uint     `gorm:"primaryKey" json:"id"`
+	Name      string   `gorm:"size:100;not null" json:"name"`
+	Kind      string   `gorm:"size:20;not null" json:"kind"`    // metric, service, cron, ssl
+	Metric    string   `gorm:"size:100" json:"metric"`          // For metric rules, e.g. disk.used_percent:/
+	Target    string   `gorm:"size:255" json:"target"`          // Service package[:version], cron job ID, or host[:port] / certificate file for ssl
+	Operator  string   `gorm:"size:2;not null" json:"operator"` // >, >=, <, <=
+	Threshold float64  `json:"threshold"`
+	Clear     *float64 `json:"clear"`    // Firing alerts resolve only once the value passes this; nil uses Threshold
+	Duration  int      `json:"duration"` // Seconds the condition must hold before firing
+	Channels  []uint   `gorm:"serializer:json" json:"channels"`
+	Enabled   bool     `json:"enabled"`
+
+	State     string     `gorm:"size:10;default:ok" json:"state"` // ok, pending, firing
+	StateAt   *time.Time `json:"state_at"`                        // When the current state began
+	LastValue *float64   `json:"last_value"`
+	LastError string     `gorm:"size:255" json:"last_error"` // Why the value couldn't be read
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type AlertChannel struct {
+	ID        uint              `gorm:"primaryKey" json:"id"`
+	Name      string            `gorm:"size:100;not null" json:"name"`
+	Type      string            `gorm:"size:20;not null" json:"type"` // smtp, webhook, slack, telegram
+	Config    map[string]string `gorm:"serializer:json" json:"config"`
+	Enabled   bool              `json:"enabled"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+type AlertEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	RuleID    uint      `gorm:"index" json:"rule_id"`
+	RuleName  string    `gorm:"size:100" json:"rule_name"`
+	State     string    `gorm:"size:10;index" json:"state"` // firing, resolved
+	Value     float64   `json:"value"`
+	Message   string    `gorm:"size:500" json:"message"`
+	Notified  string    `gorm:"size:500" json:"notified"` // Delivery result per channel
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+type Ban struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Kind      string    `gorm:"size:10;not null;index" json:"kind"` // ip, user
+	Value     string    `gorm:"size:100;not null;index" json:"value"`
+	Source    string    `gorm:"size:20" json:"source"` // panel, ssh, manual
+	Reason    string    `gorm:"size:255" json:"reason"`
+	Firewall  bool      `gorm:"default:false" json:"firewall"` // Enforced by a firewall rule
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BanWhitelist struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CIDR      string    `gorm:"uniqueIndex;size:50;not null" json:"cidr"`
+	Note      string    `gorm:"size:255" json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -7,12 +7,16 @@ import (
 )
 
 type FirewallRule struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	Name      string         `json:"name" gorm:"unique;not null"`
-	Protocol  string         `json:"protocol"`
-	Port      string         `json:"port"`
-	Action    string         `json:"action"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Name        string         `json:"name" gorm:"unique;not null"`
+	Direction   string         `json:"direction" gorm:"default:'in'"` // in, out
+	Protocol    string         `json:"protocol"`                      // tcp, udp, icmp, any
+	Port        string         `json:"port"`                          // 80, 8000-8100 or 80,443,8000-8100
+	Source      string         `json:"source"`                        // IP or CIDR, empty = any
+	Destination string         `json:"destination"`                   // IP or CIDR, empty = any
+	Action      string         `json:"action"`                        // allow, block
+	Priority    int            `json:"priority" gorm:"default:100"`   // Lower runs first
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 }
@@ -0,0 +1,14 @@
+package models
+
+// MetricSample is one point of a stored time series. Raw samples have
+// Resolution equal to the collection interval; coarser tiers hold the
+// average, minimum and maximum of the finer tier over each bucket.
+type MetricSample struct {
+	ID         uint    `gorm:"primaryKey" json:"-"`
+	Metric     string  `gorm:"size:100;not null;index:idx_metric_series,priority:1" json:"metric"`
+	Resolution int     `gorm:"not null;index:idx_metric_series,priority:2" json:"resolution"` // Seconds per sample
+	Timestamp  int64   `gorm:"not null;index:idx_metric_series,priority:3" json:"timestamp"`  // Unix seconds, start of the bucket
+	Value      float64 `json:"value"`
+	Min        float64 `json:"min"`
+	Max        float64 `json:"max"`
+}
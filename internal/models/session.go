@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a login. Its JTI is embedded in the JWT, so deleting the row
+// revokes the token.
+type Session struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	JTI        string    `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	UserID     uint      `gorm:"index;not null" json:"user_id"`
+	IP         string    `gorm:"size:45" json:"ip"`
+	UserAgent  string    `gorm:"size:255" json:"user_agent"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
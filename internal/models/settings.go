@@ -20,6 +20,8 @@ type InstalledPackage struct {
 	Version     string    `gorm:"size:50" json:"version"`
 	Category    string    `gorm:"size:50" json:"category"`
 	InstallPath string    `gorm:"size:500" json:"install_path"`
+	SHA256      string    `gorm:"size:64" json:"sha256"`   // Verified hash of the downloaded archive
+	Verified    string    `gorm:"size:20" json:"verified"` // What was checked: signature, checksum, or none
 	InstalledAt time.Time `json:"installed_at"`
 	Status      string    `gorm:"size:20;default:'installed'" json:"status"`
 }
@@ -27,8 +29,14 @@ type InstalledPackage struct {
 type ActivityLog struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	UserID    uint      `gorm:"index" json:"user_id"`
-	Action    string    `gorm:"size:100;not null" json:"action"`
+	Username  string    `gorm:"size:50;index" json:"username"`
+	Action    string    `gorm:"size:100;not null;index" json:"action"` // e.g. site.create, or "POST /api/..." for unhooked routes
+	Target    string    `gorm:"size:255;index" json:"target"`          // What was acted on: site name, file path, container ID...
 	Details   string    `gorm:"type:text" json:"details"`
+	Method    string    `gorm:"size:10" json:"method"`
+	Path      string    `gorm:"size:255" json:"path"`
+	Status    int       `json:"status"`
+	Payload   string    `gorm:"type:text" json:"payload"` // Request body and query, secrets redacted
 	IP        string    `gorm:"size:45" json:"ip"`
-	CreatedAt time.Time `json:"created_at"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
 }
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+type Task struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Type       string     `gorm:"size:50;index;not null" json:"type"` // portable.install, docker.pull, mysql.init
+	Title      string     `gorm:"size:255" json:"title"`
+	Target     string     `gorm:"size:255" json:"target"`               // What the task works on; one task per type and target runs at a time
+	Status     string     `gorm:"size:20;index;not null" json:"status"` // queued, running, success, failed, cancelled
+	Progress   float64    `json:"progress"`                             // 0-100
+	Message    string     `gorm:"size:500" json:"message"`              // Current step
+	Log        string     `gorm:"type:text" json:"log"`                 // Output, the last 64 KiB
+	Error      string     `gorm:"type:text" json:"error"`
+	UserID     uint       `gorm:"index" json:"user_id"`
+	Username   string     `gorm:"size:100" json:"username"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+type TerminalRecording struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	Username  string     `gorm:"size:50;index" json:"username"`
+	IP        string     `gorm:"size:45" json:"ip"`
+	Command   string     `gorm:"size:255" json:"command"`
+	File      string     `gorm:"size:255;not null" json:"-"` // Name inside the recording directory
+	Size      int64      `json:"size"`
+	Duration  float64    `json:"duration"` // Seconds
+	StartedAt time.Time  `gorm:"index" json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"` // Nil while the session is live
+}
@@ -8,16 +8,18 @@ import (
 )
 
 type User struct {
-	ID               uint           `gorm:"primaryKey" json:"id"`
-	Username         string         `gorm:"uniqueIndex;size:50;not null" json:"username"`
-	Email            string         `gorm:"uniqueIndex;size:100;not null" json:"email"`
-	Password         string         `gorm:"size:255;not null" json:"-"`
-	Role             string         `gorm:"size:20;default:'user'" json:"role"`
-	TwoFactorEnabled bool           `gorm:"default:false" json:"two_factor_enabled"`
-	TwoFactorSecret  string         `gorm:"size:100" json:"-"`
-	CreatedAt        time.Time      `json:"created_at"`
-	UpdatedAt        time.Time      `json:"updated_at"`
-	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                 uint           `gorm:"primaryKey" json:"id"`
+	Username           string         `gorm:"uniqueIndex;size:50;not null" json:"username"`
+	Email              string         `gorm:"uniqueIndex;size:100;not null" json:"email"`
+	Password           string         `gorm:"size:255;not null" json:"-"`
+	Role               string         `gorm:"size:20;default:'readonly'" json:"role"` // admin, operator, readonly or a custom role
+	TwoFactorEnabled   bool           `gorm:"default:false" json:"two_factor_enabled"`
+	TwoFactorSecret    string         `gorm:"size:100" json:"-"`
+	Disabled           bool           `gorm:"default:false" json:"disabled"`
+	MustChangePassword bool           `gorm:"default:false" json:"must_change_password"` // Set for new and reset accounts
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 func (u *User) SetPassword(password string) error {
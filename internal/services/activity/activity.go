@@ -0,0 +1,178 @@
+package activity
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"vps-panel/internal/database"
+	"vps-panel/internal/models"
+)
+
+// maxValueLen truncates long payload values such as file contents
+const maxValueLen = 256
+
+// sensitiveKeys are redacted from payloads when a key contains one of them
+var sensitiveKeys = []string{"password", "secret", "token", "totp", "code", "key", "ticket"}
+
+// Log records an action in the activity log
+func Log(userID uint, username, ip, action, target, details string) {
+	Record(models.ActivityLog{
+		UserID:   userID,
+		Username: username,
+		Action:   action,
+		Target:   target,
+		Details:  details,
+		IP:       ip,
+	})
+}
+
+// Record stores a prepared activity log entry
+func Record(entry models.ActivityLog) {
+	if err := database.DB.Create(&entry).Error; err != nil {
+		log.Printf("Failed to record activity %s: %v", entry.Action, err)
+	}
+}
+
+// Filter selects activity log entries. Zero values match everything.
+type Filter struct {
+	UserID   uint
+	Username string
+	Action   string // Prefix match, e.g. "firewall." or "user"
+	Target   string // Substring match
+	IP       string
+	From     time.Time
+	To       time.Time
+	Page     int
+	PageSize int // 0 returns every match
+}
+
+// Query returns the entries matching filter, newest first, and the total
+// number of matches
+func Query(filter Filter) ([]models.ActivityLog, int64, error) {
+	query := database.DB.Model(&models.ActivityLog{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Username != "" {
+		query = query.Where("username = ?", filter.Username)
+	}
+	if filter.Action != "" {
+		query = query.Where(`action LIKE ? ESCAPE '\'`, escapeLike(filter.Action)+"%")
+	}
+	if filter.Target != "" {
+		query = query.Where(`target LIKE ? ESCAPE '\'`, "%"+escapeLike(filter.Target)+"%")
+	}
+	if filter.IP != "" {
+		query = query.Where("ip = ?", filter.IP)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query = query.Order("created_at desc, id desc")
+	if filter.PageSize > 0 {
+		page := filter.Page
+		if page < 1 {
+			page = 1
+		}
+		query = query.Offset((page - 1) * filter.PageSize).Limit(filter.PageSize)
+	}
+
+	var entries []models.ActivityLog
+	err := query.Find(&entries).Error
+	return entries, total, err
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// RedactPayload renders a request body and query string for the log with
+// secrets masked and long values truncated
+func RedactPayload(contentType string, body []byte, query string) string {
+	payload := map[string]interface{}{}
+
+	if values, err := url.ParseQuery(query); err == nil && len(values) > 0 {
+		payload["query"] = redactValues(values)
+	}
+
+	if len(body) > 0 {
+		switch {
+		case strings.HasPrefix(contentType, "application/json"):
+			var data interface{}
+			if err := json.Unmarshal(body, &data); err == nil {
+				payload["body"] = redact(data)
+			} else {
+				payload["body"] = fmt.Sprintf("[invalid JSON, %d bytes]", len(body))
+			}
+		case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+			if values, err := url.ParseQuery(string(body)); err == nil {
+				payload["body"] = redactValues(values)
+			}
+		default:
+			payload["body"] = fmt.Sprintf("[%s, %d bytes]", contentType, len(body))
+		}
+	}
+
+	if len(payload) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(payload)
+	return string(data)
+}
+
+func redactValues(values url.Values) map[string]interface{} {
+	result := map[string]interface{}{}
+	for k, v := range values {
+		if len(v) == 1 {
+			result[k] = redactField(k, v[0])
+		} else {
+			result[k] = redactField(k, v)
+		}
+	}
+	return result
+}
+
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = redactField(k, item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redact(item)
+		}
+		return v
+	case string:
+		if len(v) > maxValueLen {
+			return fmt.Sprintf("%s... [%d bytes]", v[:maxValueLen], len(v))
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func redactField(key string, value interface{}) interface{} {
+	lower := strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(lower, s) {
+			return "[REDACTED]"
+		}
+	}
+	return redact(value)
+}
@@ -0,0 +1,512 @@
+package alert
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"vps-panel/internal/config"
+	"vps-panel/internal/database"
+	"vps-panel/internal/models"
+	"vps-panel/internal/services/events"
+)
+
+// Rule kinds
+const (
+	KindMetric  = "metric"  // A value from the system stats, e.g. cpu.usage_percent
+	KindService = "service" // 1 while running, 0 when down
+	KindCron    = "cron"    // 1 when the last run failed
+	KindSSL     = "ssl"     // Days until the certificate expires
+)
+
+// Rule states
+const (
+	StateOK      = "ok"
+	StatePending = "pending" // Breached, waiting for the duration to pass
+	StateFiring  = "firing"
+)
+
+// Event states
+const (
+	EventFiring   = "firing"
+	EventResolved = "resolved"
+)
+
+// evalMu serialises evaluation rounds with rule edits so that an edit isn't
+// overwritten by a round that loaded the old rule
+var evalMu sync.Mutex
+
+// sendTimeout bounds each channel's delivery of a notification
+const sendTimeout = 15 * time.Second
+
+// transition is a rule that fired or resolved in an evaluation round
+type transition struct {
+	rule  models.AlertRule
+	state string
+	value float64
+	at    time.Time
+}
+
+// Init starts evaluating rules
+func Init() {
+	interval := config.AppConfig.Alerts.Interval
+	if interval <= 0 {
+		log.Printf("🔔 Alerting disabled")
+		return
+	}
+
+	// Pending timers don't survive a restart; firing alerts stay firing
+	// until they clear, so they aren't announced twice
+	database.DB.Model(&models.AlertRule{}).Where("state = ?", StatePending).Update("state", StateOK)
+
+	go evaluateLoop(interval)
+	log.Printf("🔔 Alerting enabled (every %s)", interval)
+}
+
+func evaluateLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		Evaluate()
+	}
+}
+
+// Evaluate checks every enabled rule once. Notifications are sent after
+// the round, so slow channels don't hold up rule edits.
+func Evaluate() {
+	for _, t := range evaluateRules() {
+		notify(&t.rule, t.state, t.value, t.at)
+	}
+}
+
+func evaluateRules() []transition {
+	evalMu.Lock()
+	defer evalMu.Unlock()
+
+	var rules []models.AlertRule
+	if err := database.DB.Where("enabled = ?", true).Find(&rules).Error; err != nil {
+		log.Printf("Alerts: loading rules failed: %v", err)
+		return nil
+	}
+
+	src := &sources{}
+	var transitions []transition
+	for i := range rules {
+		if t := evaluateRule(&rules[i], src, time.Now()); t != nil {
+			transitions = append(transitions, *t)
+		}
+	}
+	return transitions
+}
+
+// evaluateRule advances a rule's state machine. A breach must hold for the
+// rule's duration before it fires, and a firing rule only resolves once the
+// value passes the clear threshold, so values hovering around the threshold
+// don't flap. It returns the transition to announce, if any.
+func evaluateRule(rule *models.AlertRule, src *sources, now time.Time) *transition {
+	value, err := src.value(rule)
+	if err != nil {
+		database.DB.Model(rule).Update("last_error", truncate(err.Error(), 255))
+		return nil
+	}
+
+	state := rule.State
+	switch rule.State {
+	case StateFiring:
+		clear := rule.Threshold
+		if rule.Clear != nil {
+			clear = *rule.Clear
+		}
+		if !compare(value, rule.Operator, clear) {
+			state = StateOK
+		}
+	case StatePending:
+		if !compare(value, rule.Operator, rule.Threshold) {
+			state = StateOK
+		} else if rule.StateAt == nil || now.Sub(*rule.StateAt) >= time.Duration(rule.Duration)*time.Second {
+			state = StateFiring
+		}
+	default:
+		if compare(value, rule.Operator, rule.Threshold) {
+			state = StatePending
+			if rule.Duration <= 0 {
+				state = StateFiring
+			}
+		}
+	}
+
+	previous := rule.State
+	updates := map[string]interface{}{
+		"last_value": value,
+		"last_error": "",
+	}
+	if state != previous {
+		updates["state"] = state
+		updates["state_at"] = now
+	}
+	database.DB.Model(rule).Updates(updates)
+
+	switch {
+	case state == StateFiring && previous != StateFiring:
+		return &transition{rule: *rule, state: EventFiring, value: value, at: now}
+	case state == StateOK && previous == StateFiring:
+		return &transition{rule: *rule, state: EventResolved, value: value, at: now}
+	}
+	return nil
+}
+
+func compare(value float64, op string, threshold float64) bool {
+	switch op {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	}
+	return false
+}
+
+// describe names what a rule watches
+func describe(rule *models.AlertRule) string {
+	switch rule.Kind {
+	case KindMetric:
+		return rule.Metric
+	case KindService:
+		return "service " + rule.Target + " running"
+	case KindCron:
+		return "cron job " + rule.Target + " failed"
+	case KindSSL:
+		return "days until the certificate of " + rule.Target + " expires"
+	}
+	return rule.Kind
+}
+
+// notify records an event and sends it to the rule's channels
+func notify(rule *models.AlertRule, state string, value float64, now time.Time) {
+	n := Notification{
+		RuleID: rule.ID,
+		Rule:   rule.Name,
+		State:  state,
+		Value:  value,
+		Time:   now,
+	}
+	if state == EventFiring {
+		n.Message = fmt.Sprintf("🔴 FIRING: %s: %s is %g (%s %g)", rule.Name, describe(rule), value, rule.Operator, rule.Threshold)
+	} else {
+		n.Message = fmt.Sprintf("✅ RESOLVED: %s: %s is %g", rule.Name, describe(rule), value)
+	}
+
+	event := models.AlertEvent{
+		RuleID:   rule.ID,
+		RuleName: rule.Name,
+		State:    state,
+		Value:    value,
+		Message:  truncate(n.Message, 500),
+		Notified: truncate(deliver(rule.Channels, n), 500),
+	}
+	if err := database.DB.Create(&event).Error; err != nil {
+		log.Printf("Alerts: recording event for %s failed: %v", rule.Name, err)
+	}
+	log.Printf("🔔 %s", n.Message)
+	events.Publish(events.TopicAlert, n)
+}
+
+// deliver sends a notification to each enabled channel and summarises the
+// results
+func deliver(channelIDs []uint, n Notification) string {
+	if len(channelIDs) == 0 {
+		return ""
+	}
+	var channels []models.AlertChannel
+	database.DB.Where("id IN ? AND enabled = ?", channelIDs, true).Find(&channels)
+
+	results := make([]string, 0, len(channels))
+	for _, ch := range channels {
+		err := send(ch, n)
+		if err != nil {
+			log.Printf("Alerts: channel %s failed: %v", ch.Name, err)
+			results = append(results, fmt.Sprintf("%s: %v", ch.Name, err))
+		} else {
+			results = append(results, ch.Name+": sent")
+		}
+	}
+	return strings.Join(results, "; ")
+}
+
+// send delivers through one channel, giving up after sendTimeout
+func send(ch models.AlertChannel, n Notification) error {
+	notifier, err := newNotifier(ch.Type, ch.Config)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- notifier.Send(n) }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(sendTimeout):
+		return fmt.Errorf("timed out after %s", sendTimeout)
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// ValidateRule checks a rule and fills in the natural operator and
+// threshold for service, cron and ssl rules
+func ValidateRule(rule *models.AlertRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	switch rule.Kind {
+	case KindMetric:
+		if rule.Metric == "" {
+			return fmt.Errorf("metric is required for metric rules")
+		}
+	case KindService:
+		if rule.Target == "" {
+			return fmt.Errorf("target (package ID, optionally :version) is required for service rules")
+		}
+		if rule.Operator == "" {
+			rule.Operator, rule.Threshold = "<", 1
+		}
+	case KindCron:
+		if rule.Target == "" {
+			return fmt.Errorf("target (cron job ID) is required for cron rules")
+		}
+		if rule.Operator == "" {
+			rule.Operator, rule.Threshold = ">=", 1
+		}
+	case KindSSL:
+		if rule.Target == "" {
+			return fmt.Errorf("target (host[:port] or certificate file) is required for ssl rules")
+		}
+		if rule.Operator == "" {
+			rule.Operator, rule.Threshold = "<", 14
+		}
+	default:
+		return fmt.Errorf("kind must be metric, service, cron or ssl")
+	}
+
+	switch rule.Operator {
+	case ">", ">=", "<", "<=":
+	default:
+		return fmt.Errorf("operator must be >, >=, < or <=")
+	}
+	if rule.Duration < 0 {
+		return fmt.Errorf("duration can't be negative")
+	}
+
+	// The clear threshold must sit on the healthy side of the threshold
+	if rule.Clear != nil {
+		above := rule.Operator == ">" || rule.Operator == ">="
+		if (above && *rule.Clear > rule.Threshold) || (!above && *rule.Clear < rule.Threshold) {
+			return fmt.Errorf("clear must be on the non-alerting side of threshold")
+		}
+	}
+
+	for _, id := range rule.Channels {
+		var count int64
+		database.DB.Model(&models.AlertChannel{}).Where("id = ?", id).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("channel %d not found", id)
+		}
+	}
+	return nil
+}
+
+// GetRules returns all rules with their current state
+func GetRules() ([]models.AlertRule, error) {
+	var rules []models.AlertRule
+	err := database.DB.Order("id asc").Find(&rules).Error
+	return rules, err
+}
+
+// GetRule returns one rule
+func GetRule(id uint) (*models.AlertRule, error) {
+	var rule models.AlertRule
+	if err := database.DB.First(&rule, id).Error; err != nil {
+		return nil, fmt.Errorf("alert rule not found")
+	}
+	return &rule, nil
+}
+
+// CreateRule adds a rule, starting in the ok state
+func CreateRule(rule *models.AlertRule) error {
+	if err := ValidateRule(rule); err != nil {
+		return err
+	}
+	rule.ID = 0
+	rule.State = StateOK
+	rule.StateAt = nil
+	rule.LastValue = nil
+	rule.LastError = ""
+
+	evalMu.Lock()
+	defer evalMu.Unlock()
+	return database.DB.Create(rule).Error
+}
+
+// UpdateRule replaces a rule's settings. Changing what it watches or how
+// resets its state; a firing alert that is reset is not announced as
+// resolved.
+func UpdateRule(id uint, rule *models.AlertRule) (*models.AlertRule, error) {
+	if err := ValidateRule(rule); err != nil {
+		return nil, err
+	}
+
+	evalMu.Lock()
+	defer evalMu.Unlock()
+
+	existing, err := GetRule(id)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := existing.Kind != rule.Kind || existing.Metric != rule.Metric || existing.Target != rule.Target ||
+		existing.Operator != rule.Operator || existing.Threshold != rule.Threshold
+	existing.Name = rule.Name
+	existing.Kind = rule.Kind
+	existing.Metric = rule.Metric
+	existing.Target = rule.Target
+	existing.Operator = rule.Operator
+	existing.Threshold = rule.Threshold
+	existing.Clear = rule.Clear
+	existing.Duration = rule.Duration
+	existing.Channels = rule.Channels
+	existing.Enabled = rule.Enabled
+	if changed || !rule.Enabled {
+		existing.State = StateOK
+		existing.StateAt = nil
+	}
+
+	if err := database.DB.Save(existing).Error; err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// DeleteRule removes a rule; its history is kept
+func DeleteRule(id uint) error {
+	evalMu.Lock()
+	defer evalMu.Unlock()
+
+	result := database.DB.Delete(&models.AlertRule{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("alert rule not found")
+	}
+	return nil
+}
+
+// ValidateChannel checks a channel's type and config
+func ValidateChannel(ch *models.AlertChannel) error {
+	ch.Name = strings.TrimSpace(ch.Name)
+	if ch.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	_, err := newNotifier(ch.Type, ch.Config)
+	return err
+}
+
+// GetChannels returns all notification channels
+func GetChannels() ([]models.AlertChannel, error) {
+	var channels []models.AlertChannel
+	err := database.DB.Order("id asc").Find(&channels).Error
+	return channels, err
+}
+
+// GetChannel returns one channel
+func GetChannel(id uint) (*models.AlertChannel, error) {
+	var ch models.AlertChannel
+	if err := database.DB.First(&ch, id).Error; err != nil {
+		return nil, fmt.Errorf("alert channel not found")
+	}
+	return &ch, nil
+}
+
+// CreateChannel adds a notification channel
+func CreateChannel(ch *models.AlertChannel) error {
+	if err := ValidateChannel(ch); err != nil {
+		return err
+	}
+	ch.ID = 0
+	return database.DB.Create(ch).Error
+}
+
+// UpdateChannel replaces a channel's settings
+func UpdateChannel(id uint, ch *models.AlertChannel) (*models.AlertChannel, error) {
+	if err := ValidateChannel(ch); err != nil {
+		return nil, err
+	}
+	existing, err := GetChannel(id)
+	if err != nil {
+		return nil, err
+	}
+	existing.Name = ch.Name
+	existing.Type = ch.Type
+	existing.Config = ch.Config
+	existing.Enabled = ch.Enabled
+	if err := database.DB.Save(existing).Error; err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// DeleteChannel removes a channel. Rules still listing it skip it.
+func DeleteChannel(id uint) error {
+	result := database.DB.Delete(&models.AlertChannel{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("alert channel not found")
+	}
+	return nil
+}
+
+// TestChannel sends a test notification through a channel
+func TestChannel(id uint) error {
+	ch, err := GetChannel(id)
+	if err != nil {
+		return err
+	}
+	return send(*ch, Notification{
+		Rule:    "Test",
+		State:   EventFiring,
+		Message: fmt.Sprintf("🔔 Test notification from VPS Panel channel %s", ch.Name),
+		Time:    time.Now(),
+	})
+}
+
+// GetHistory returns a page of alert events, newest first, optionally for
+// one rule
+func GetHistory(ruleID uint, page, pageSize int) ([]models.AlertEvent, int64, error) {
+	query := database.DB.Model(&models.AlertEvent{})
+	if ruleID > 0 {
+		query = query.Where("rule_id = ?", ruleID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []models.AlertEvent
+	err := query.Order("created_at desc, id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&events).Error
+	return events, total, err
+}
@@ -0,0 +1,64 @@
+package alert
+
+import (
+	"path/filepath"
+	"testing"
+
+	"vps-panel/internal/database"
+	"vps-panel/internal/models"
+)
+
+func openTestDB(t *testing.T) {
+	t.Helper()
+	if _, err := database.Connect(filepath.Join(t.TempDir(), "panel.db")); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if err := database.AutoMigrate(&models.AlertRule{}, &models.AlertChannel{}); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+}
+
+// A rule or channel created disabled must be stored disabled, not silently
+// enabled by a column default
+func TestCreateKeepsEnabled(t *testing.T) {
+	openTestDB(t)
+
+	for _, enabled := range []bool{false, true} {
+		ch := models.AlertChannel{
+			Name:    "hook",
+			Type:    "webhook",
+			Config:  map[string]string{"url": "https://example.com/hook"},
+			Enabled: enabled,
+		}
+		if err := CreateChannel(&ch); err != nil {
+			t.Fatalf("CreateChannel: %v", err)
+		}
+		stored, err := GetChannel(ch.ID)
+		if err != nil {
+			t.Fatalf("GetChannel: %v", err)
+		}
+		if stored.Enabled != enabled {
+			t.Errorf("channel created with enabled=%v stored as %v", enabled, stored.Enabled)
+		}
+
+		rule := models.AlertRule{
+			Name:      "cpu",
+			Kind:      KindMetric,
+			Metric:    "cpu.usage_percent",
+			Operator:  ">",
+			Threshold: 90,
+			Channels:  []uint{ch.ID},
+			Enabled:   enabled,
+		}
+		if err := CreateRule(&rule); err != nil {
+			t.Fatalf("CreateRule: %v", err)
+		}
+		storedRule, err := GetRule(rule.ID)
+		if err != nil {
+			t.Fatalf("GetRule: %v", err)
+		}
+		if storedRule.Enabled != enabled {
+			t.Errorf("rule created with enabled=%v stored as %v", enabled, storedRule.Enabled)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package alert
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"vps-panel/internal/config"
+)
+
+// Notification is what a channel delivers when an alert fires or resolves
+type Notification struct {
+	RuleID  uint      `json:"rule_id"`
+	Rule    string    `json:"rule"`
+	State   string    `json:"state"` // firing, resolved
+	Value   float64   `json:"value"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Notifier delivers notifications through one configured channel
+type Notifier interface {
+	Send(n Notification) error
+}
+
+// NotifierFactory builds a notifier from a channel's config, rejecting
+// missing or invalid settings
+type NotifierFactory func(cfg map[string]string) (Notifier, error)
+
+var notifiers = map[string]NotifierFactory{
+	"smtp":     newSMTPNotifier,
+	"webhook":  newWebhookNotifier,
+	"slack":    newSlackNotifier,
+	"telegram": newTelegramNotifier,
+}
+
+// RegisterNotifier adds a channel type
+func RegisterNotifier(typ string, factory NotifierFactory) {
+	notifiers[typ] = factory
+}
+
+// newNotifier builds the notifier for a channel type
+func newNotifier(typ string, cfg map[string]string) (Notifier, error) {
+	factory, ok := notifiers[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown channel type '%s'", typ)
+	}
+	if cfg == nil {
+		cfg = map[string]string{}
+	}
+	return factory(cfg)
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// postJSON sends a JSON payload and treats any non-2xx answer as a failure
+func postJSON(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return nil
+}
+
+func requireURL(cfg map[string]string) (string, error) {
+	url := cfg["url"]
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return "", fmt.Errorf("url must be an http(s) URL")
+	}
+	return url, nil
+}
+
+// webhookNotifier posts the Notification as JSON
+type webhookNotifier struct {
+	url string
+}
+
+func newWebhookNotifier(cfg map[string]string) (Notifier, error) {
+	url, err := requireURL(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &webhookNotifier{url: url}, nil
+}
+
+func (w *webhookNotifier) Send(n Notification) error {
+	return postJSON(w.url, n)
+}
+
+// slackNotifier posts a Slack incoming-webhook payload, which Mattermost,
+// Rocket.Chat and Discord's /slack endpoint also accept
+type slackNotifier struct {
+	url string
+}
+
+func newSlackNotifier(cfg map[string]string) (Notifier, error) {
+	url, err := requireURL(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &slackNotifier{url: url}, nil
+}
+
+func (s *slackNotifier) Send(n Notification) error {
+	return postJSON(s.url, map[string]string{"text": n.Message})
+}
+
+// telegramNotifier sends a message through the Telegram Bot API, or a
+// compatible gateway given as api_url
+type telegramNotifier struct {
+	url    string
+	chatID string
+}
+
+func newTelegramNotifier(cfg map[string]string) (Notifier, error) {
+	if cfg["bot_token"] == "" || cfg["chat_id"] == "" {
+		return nil, fmt.Errorf("bot_token and chat_id are required")
+	}
+	api := strings.TrimSuffix(cfg["api_url"], "/")
+	if api == "" {
+		api = "https://api.telegram.org"
+	}
+	return &telegramNotifier{
+		url:    fmt.Sprintf("%s/bot%s/sendMessage", api, cfg["bot_token"]),
+		chatID: cfg["chat_id"],
+	}, nil
+}
+
+func (t *telegramNotifier) Send(n Notification) error {
+	return postJSON(t.url, map[string]string{"chat_id": t.chatID, "text": n.Message})
+}
+
+// smtpNotifier mails the notification through the server in alerts.smtp
+type smtpNotifier struct {
+	to []string
+}
+
+func newSMTPNotifier(cfg map[string]string) (Notifier, error) {
+	var to []string
+	for _, addr := range strings.Split(cfg["to"], ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+	if len(to) == 0 {
+		return nil, fmt.Errorf("to is required")
+	}
+	if config.AppConfig.Alerts.SMTP.Host == "" {
+		return nil, fmt.Errorf("alerts.smtp.host is not configured")
+	}
+	return &smtpNotifier{to: to}, nil
+}
+
+func (s *smtpNotifier) Send(n Notification) error {
+	cfg := config.AppConfig.Alerts.SMTP
+	from := cfg.From
+	if from == "" {
+		from = cfg.Username
+	}
+
+	subject := fmt.Sprintf("[%s] %s", strings.ToUpper(n.State), n.Rule)
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		from, strings.Join(s.to, ", "), subject, n.Time.Format(time.RFC1123Z), n.Message)
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	if cfg.Port != 465 {
+		return smtp.SendMail(addr, auth, from, s.to, []byte(msg))
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", addr, &tls.Config{ServerName: cfg.Host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range s.to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
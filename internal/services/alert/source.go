@@ -0,0 +1,177 @@
+package alert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vps-panel/internal/database"
+	"vps-panel/internal/models"
+	"vps-panel/internal/services/appstore"
+	"vps-panel/internal/services/metrics"
+	"vps-panel/internal/services/monitor"
+)
+
+// sslCacheTTL limits how often certificates are fetched; expiry moves in days
+const sslCacheTTL = time.Hour
+
+var (
+	sslMu    sync.Mutex
+	sslCache = make(map[string]sslResult)
+)
+
+type sslResult struct {
+	days float64
+	err  error
+	at   time.Time
+}
+
+// sources reads rule values for one evaluation round; system stats are
+// sampled at most once per round
+type sources struct {
+	stats    map[string]float64
+	statsErr error
+}
+
+func (s *sources) value(rule *models.AlertRule) (float64, error) {
+	switch rule.Kind {
+	case KindMetric:
+		return s.metricValue(rule.Metric)
+	case KindService:
+		return serviceValue(rule.Target)
+	case KindCron:
+		return cronValue(rule.Target)
+	case KindSSL:
+		return sslValue(rule.Target)
+	}
+	return 0, fmt.Errorf("unknown rule kind '%s'", rule.Kind)
+}
+
+func (s *sources) metricValue(name string) (float64, error) {
+	if s.stats == nil && s.statsErr == nil {
+		stats, err := monitor.GetSystemStats()
+		if err != nil {
+			s.statsErr = err
+		} else {
+			s.stats = metrics.Sample(stats)
+		}
+	}
+	if s.statsErr != nil {
+		return 0, s.statsErr
+	}
+
+	v, ok := s.stats[name]
+	if !ok {
+		return 0, fmt.Errorf("metric %s is not available", name)
+	}
+	return v, nil
+}
+
+// serviceValue is 1 while the service runs and 0 when it's down. Without a
+// version any installed version running counts.
+func serviceValue(target string) (float64, error) {
+	pkgID, version, _ := strings.Cut(target, ":")
+	if version != "" {
+		status, err := appstore.GetServiceStatus(pkgID, version)
+		if err != nil {
+			return 0, err
+		}
+		return boolValue(status.Running), nil
+	}
+
+	installed := false
+	for _, inst := range appstore.GetInstalledPortablePackages() {
+		if inst["package_id"] != pkgID {
+			continue
+		}
+		installed = true
+		v, _ := inst["version"].(string)
+		if status, err := appstore.GetServiceStatus(pkgID, v); err == nil && status.Running {
+			return 1, nil
+		}
+	}
+	if !installed {
+		return 0, fmt.Errorf("package not installed: %s", pkgID)
+	}
+	return 0, nil
+}
+
+// cronValue is 1 when the job's last run failed and 0 otherwise
+func cronValue(target string) (float64, error) {
+	id, err := strconv.Atoi(target)
+	if err != nil {
+		return 0, fmt.Errorf("cron target must be a job ID")
+	}
+	var job models.CronJob
+	if err := database.DB.First(&job, id).Error; err != nil {
+		return 0, fmt.Errorf("cron job %d not found", id)
+	}
+	return boolValue(job.LastRun != nil && job.LastStatus == "error"), nil
+}
+
+// sslValue is the number of days until a certificate expires. The target is
+// a PEM file on disk or a host[:port] to connect to (default port 443).
+func sslValue(target string) (float64, error) {
+	sslMu.Lock()
+	cached, ok := sslCache[target]
+	sslMu.Unlock()
+	if ok && time.Since(cached.at) < sslCacheTTL {
+		return cached.days, cached.err
+	}
+
+	var notAfter time.Time
+	cert, err := fetchCertificate(target)
+	if err == nil {
+		notAfter = cert.NotAfter
+	}
+	result := sslResult{days: time.Until(notAfter).Hours() / 24, err: err, at: time.Now()}
+
+	sslMu.Lock()
+	sslCache[target] = result
+	sslMu.Unlock()
+	return result.days, result.err
+}
+
+func fetchCertificate(target string) (*x509.Certificate, error) {
+	if data, err := os.ReadFile(target); err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s is not a PEM certificate", target)
+		}
+		return x509.ParseCertificate(block.Bytes)
+	}
+
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		host, port = target, "443"
+	}
+	// Expiry is wanted even for self-signed or otherwise untrusted certificates
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", net.JoinHostPort(host, port), &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s sent no certificate", target)
+	}
+	return certs[0], nil
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
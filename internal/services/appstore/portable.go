@@ -4,6 +4,9 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,6 +18,7 @@ import (
 	"strings"
 	"time"
 
+	"vps-panel/internal/config"
 	"vps-panel/internal/database"
 	"vps-panel/internal/models"
 )
@@ -30,13 +34,16 @@ type PortablePackage struct {
 	Executable  map[string]string `json:"executable"`   // OS -> executable name
 	ConfigFile  string            `json:"config_file,omitempty"`
 	Ports       []int             `json:"ports,omitempty"`
+	SigningKey  string            `json:"signing_key,omitempty"` // minisign public key that Signatures are made with
 }
 
 type PortableVersion struct {
-	Version   string            `json:"version"`
-	Latest    bool              `json:"latest,omitempty"`
-	LTS       bool              `json:"lts,omitempty"`
-	Downloads map[string]string `json:"downloads"` // OS/arch -> download URL
+	Version    string            `json:"version"`
+	Latest     bool              `json:"latest,omitempty"`
+	LTS        bool              `json:"lts,omitempty"`
+	Downloads  map[string]string `json:"downloads"`            // OS/arch -> download URL
+	Checksums  map[string]string `json:"checksums,omitempty"`  // OS/arch -> SHA-256 of the download, hex
+	Signatures map[string]string `json:"signatures,omitempty"` // OS/arch -> URL of a detached minisign signature
 }
 
 // GetBaseDir returns the base directory for portable installations
@@ -297,8 +304,17 @@ func checkInstalledVersions(pkg PortablePackage) PortablePackage {
 	return pkg
 }
 
-// GetDownloadURL returns the download URL for current OS/arch
-func GetDownloadURL(pkg *PortablePackage, version string) (string, error) {
+// Download is what to fetch for one version on this platform and how to
+// verify it
+type Download struct {
+	URL          string
+	SHA256       string // Empty when none is pinned
+	SignatureURL string // Empty when the version is not signed
+	SigningKey   string
+}
+
+// GetDownload returns the download for the current OS/arch
+func GetDownload(pkg *PortablePackage, version string) (*Download, error) {
 	var targetVersion *PortableVersion
 	for _, v := range pkg.Versions {
 		if v.Version == version {
@@ -308,28 +324,42 @@ func GetDownloadURL(pkg *PortablePackage, version string) (string, error) {
 	}
 
 	if targetVersion == nil {
-		return "", fmt.Errorf("version %s not found", version)
+		return nil, fmt.Errorf("version %s not found", version)
 	}
 
-	// Check for "all" platform first
-	if url, ok := targetVersion.Downloads["all"]; ok {
-		return url, nil
+	// Check for "all" platform first, then the OS/arch key
+	key := "all"
+	if _, ok := targetVersion.Downloads[key]; !ok {
+		key = fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
 	}
-
-	// Build OS/arch key
-	key := fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
-	if url, ok := targetVersion.Downloads[key]; ok {
-		return url, nil
+	url, ok := targetVersion.Downloads[key]
+	if !ok {
+		return nil, fmt.Errorf("no download available for %s", key)
 	}
 
-	return "", fmt.Errorf("no download available for %s", key)
+	return &Download{
+		URL:          url,
+		SHA256:       strings.ToLower(targetVersion.Checksums[key]),
+		SignatureURL: targetVersion.Signatures[key],
+		SigningKey:   pkg.SigningKey,
+	}, nil
+}
+
+// GetDownloadURL returns the download URL for current OS/arch
+func GetDownloadURL(pkg *PortablePackage, version string) (string, error) {
+	download, err := GetDownload(pkg, version)
+	if err != nil {
+		return "", err
+	}
+	return download.URL, nil
 }
 
 // InstallProgress tracks installation progress
 type InstallProgress struct {
+	TaskID      uint    `json:"task_id,omitempty"`
 	PackageID   string  `json:"package_id"`
 	Version     string  `json:"version"`
-	Status      string  `json:"status"` // downloading, extracting, configuring, complete, error
+	Status      string  `json:"status"` // downloading, verifying, extracting, configuring, complete, error, cancelled
 	Progress    float64 `json:"progress"`
 	Message     string  `json:"message"`
 	InstallPath string  `json:"install_path,omitempty"`
@@ -339,25 +369,32 @@ type InstallProgress struct {
 // ProgressCallback is called during installation
 type ProgressCallback func(progress InstallProgress)
 
-// InstallPortablePackage downloads and installs a portable package
-func InstallPortablePackage(packageID, version string, callback ProgressCallback) (*InstallProgress, error) {
+// InstallPortablePackage downloads and installs a portable package. If ctx
+// is cancelled or the install fails, the downloaded archive and a partially
+// extracted install directory are removed.
+func InstallPortablePackage(ctx context.Context, packageID, version string, callback ProgressCallback) (*InstallProgress, error) {
 	pkg := GetPortablePackageByID(packageID)
 	if pkg == nil {
 		return nil, fmt.Errorf("package not found: %s", packageID)
 	}
 
 	// Get download URL
-	downloadURL, err := GetDownloadURL(pkg, version)
+	download, err := GetDownload(pkg, version)
 	if err != nil {
 		return nil, err
 	}
+	if download.SHA256 == "" && download.SignatureURL == "" && config.AppConfig.Portable.RequireChecksum {
+		return nil, fmt.Errorf("no checksum pinned for %s %s, refusing to install unverified files", packageID, version)
+	}
 
 	// Setup paths
 	baseDir := GetBaseDir()
 	installPath := filepath.Join(baseDir, pkg.InstallPath, version)
 	tempDir := filepath.Join(baseDir, ".temp")
 
-	// Create directories
+	// Create directories; one that already existed is never cleaned up
+	_, statErr := os.Stat(installPath)
+	newInstall := os.IsNotExist(statErr)
 	if err := os.MkdirAll(installPath, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create install directory: %w", err)
 	}
@@ -379,10 +416,28 @@ func InstallPortablePackage(packageID, version string, callback ProgressCallback
 	}
 
 	// Download file
-	fileName := filepath.Base(downloadURL)
+	fileName := filepath.Base(download.URL)
 	tempFile := filepath.Join(tempDir, fileName)
 
-	if err := downloadFile(downloadURL, tempFile, func(downloaded, total int64) {
+	fail := func(err error) (*InstallProgress, error) {
+		os.Remove(tempFile)
+		if newInstall {
+			os.RemoveAll(installPath)
+		}
+		progress.Status = "error"
+		if ctx.Err() != nil {
+			progress.Status = "cancelled"
+			progress.Message = "Installation cancelled"
+			err = ctx.Err()
+		}
+		progress.Error = err.Error()
+		if callback != nil {
+			callback(progress)
+		}
+		return &progress, err
+	}
+
+	sum, err := downloadFile(ctx, download.URL, tempFile, func(downloaded, total int64) {
 		if total > 0 {
 			progress.Progress = float64(downloaded) / float64(total) * 50 // 0-50% for download
 			progress.Message = fmt.Sprintf("Downloading... %.1f%%", progress.Progress*2)
@@ -390,10 +445,20 @@ func InstallPortablePackage(packageID, version string, callback ProgressCallback
 				callback(progress)
 			}
 		}
-	}); err != nil {
-		progress.Status = "error"
-		progress.Error = err.Error()
-		return &progress, err
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	// Nothing is unpacked before the download is verified
+	progress.Status = "verifying"
+	progress.Message = "Verifying download..."
+	if callback != nil {
+		callback(progress)
+	}
+	verified, err := verifyDownload(ctx, download, tempFile, sum)
+	if err != nil {
+		return fail(err)
 	}
 
 	progress.Status = "extracting"
@@ -404,15 +469,18 @@ func InstallPortablePackage(packageID, version string, callback ProgressCallback
 	}
 
 	// Extract based on file type
-	if err := extractArchive(tempFile, installPath); err != nil {
-		progress.Status = "error"
-		progress.Error = err.Error()
-		return &progress, err
+	if err := extractArchive(ctx, tempFile, installPath); err != nil {
+		return fail(err)
 	}
 
 	// Clean up temp file
 	os.Remove(tempFile)
 
+	// Past this point the package is complete and is kept
+	if ctx.Err() != nil {
+		return fail(ctx.Err())
+	}
+
 	progress.Status = "configuring"
 	progress.Progress = 90
 	progress.Message = "Configuring..."
@@ -432,6 +500,8 @@ func InstallPortablePackage(packageID, version string, callback ProgressCallback
 		Version:     version,
 		Category:    pkg.Category,
 		InstallPath: installPath,
+		SHA256:      sum,
+		Verified:    verified,
 		InstalledAt: time.Now(),
 		Status:      "installed",
 	}
@@ -447,24 +517,32 @@ func InstallPortablePackage(packageID, version string, callback ProgressCallback
 	return &progress, nil
 }
 
-// downloadFile downloads a file with progress tracking
-func downloadFile(url, destPath string, progressFn func(downloaded, total int64)) error {
-	resp, err := http.Get(url)
+// downloadFile downloads a file with progress tracking and returns its
+// SHA-256, hex encoded
+func downloadFile(ctx context.Context, url, destPath string, progressFn func(downloaded, total int64)) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return err
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed: %s", resp.Status)
+		return "", fmt.Errorf("download failed: %s", resp.Status)
 	}
 
 	out, err := os.Create(destPath)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer out.Close()
 
+	hash := sha256.New()
+	w := io.MultiWriter(out, hash)
+
 	total := resp.ContentLength
 	var downloaded int64 = 0
 	buf := make([]byte, 32*1024) // 32KB buffer
@@ -472,8 +550,8 @@ func downloadFile(url, destPath string, progressFn func(downloaded, total int64)
 	for {
 		n, err := resp.Body.Read(buf)
 		if n > 0 {
-			if _, writeErr := out.Write(buf[:n]); writeErr != nil {
-				return writeErr
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				return "", writeErr
 			}
 			downloaded += int64(n)
 			if progressFn != nil {
@@ -484,23 +562,23 @@ func downloadFile(url, destPath string, progressFn func(downloaded, total int64)
 			break
 		}
 		if err != nil {
-			return err
+			return "", err
 		}
 	}
 
-	return nil
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
 // extractArchive extracts zip, tar.gz, tar.xz files
-func extractArchive(archivePath, destPath string) error {
+func extractArchive(ctx context.Context, archivePath, destPath string) error {
 	lowerPath := strings.ToLower(archivePath)
 
 	if strings.HasSuffix(lowerPath, ".zip") {
-		return extractZip(archivePath, destPath)
+		return extractZip(ctx, archivePath, destPath)
 	} else if strings.HasSuffix(lowerPath, ".tar.gz") || strings.HasSuffix(lowerPath, ".tgz") {
-		return extractTarGz(archivePath, destPath)
+		return extractTarGz(ctx, archivePath, destPath)
 	} else if strings.HasSuffix(lowerPath, ".tar.xz") {
-		return extractTarXz(archivePath, destPath)
+		return extractTarXz(ctx, archivePath, destPath)
 	} else if strings.HasSuffix(lowerPath, ".phar") || strings.HasSuffix(lowerPath, ".php") {
 		// Single file, just copy
 		return copyFile(archivePath, filepath.Join(destPath, filepath.Base(archivePath)))
@@ -509,7 +587,7 @@ func extractArchive(archivePath, destPath string) error {
 	return fmt.Errorf("unsupported archive format: %s", archivePath)
 }
 
-func extractZip(src, dest string) error {
+func extractZip(ctx context.Context, src, dest string) error {
 	r, err := zip.OpenReader(src)
 	if err != nil {
 		return err
@@ -536,6 +614,9 @@ func extractZip(src, dest string) error {
 	}
 
 	for _, f := range r.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		fpath := f.Name
 
 		// Strip root directory if archive has one
@@ -582,7 +663,7 @@ func extractZip(src, dest string) error {
 	return nil
 }
 
-func extractTarGz(src, dest string) error {
+func extractTarGz(ctx context.Context, src, dest string) error {
 	file, err := os.Open(src)
 	if err != nil {
 		return err
@@ -595,19 +676,22 @@ func extractTarGz(src, dest string) error {
 	}
 	defer gzr.Close()
 
-	return extractTar(gzr, dest)
+	return extractTar(ctx, gzr, dest)
 }
 
-func extractTarXz(src, dest string) error {
+func extractTarXz(ctx context.Context, src, dest string) error {
 	// Use xz command for .tar.xz files
-	cmd := exec.Command("tar", "-xJf", src, "-C", dest, "--strip-components=1")
+	cmd := exec.CommandContext(ctx, "tar", "-xJf", src, "-C", dest, "--strip-components=1")
 	return cmd.Run()
 }
 
-func extractTar(r io.Reader, dest string) error {
+func extractTar(ctx context.Context, r io.Reader, dest string) error {
 	tr := tar.NewReader(r)
 
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		header, err := tr.Next()
 		if err == io.EOF {
 			break
@@ -730,6 +814,14 @@ func GetInstalledPortablePackages() []map[string]interface{} {
 	var installed []map[string]interface{}
 	baseDir := GetBaseDir()
 
+	// What was verified at install time, when the panel installed it
+	var records []models.InstalledPackage
+	database.DB.Find(&records)
+	recorded := make(map[string]models.InstalledPackage, len(records))
+	for _, r := range records {
+		recorded[r.PackageID+" "+r.Version] = r
+	}
+
 	for _, pkg := range PortableCatalog {
 		pkgPath := filepath.Join(baseDir, pkg.InstallPath)
 		if entries, err := os.ReadDir(pkgPath); err == nil {
@@ -737,6 +829,7 @@ func GetInstalledPortablePackages() []map[string]interface{} {
 				if entry.IsDir() {
 					versionPath := filepath.Join(pkgPath, entry.Name())
 					info, _ := entry.Info()
+					record := recorded[pkg.ID+" "+entry.Name()]
 					installed = append(installed, map[string]interface{}{
 						"package_id":   pkg.ID,
 						"name":         pkg.Name,
@@ -744,6 +837,8 @@ func GetInstalledPortablePackages() []map[string]interface{} {
 						"category":     pkg.Category,
 						"install_path": versionPath,
 						"installed_at": info.ModTime(),
+						"sha256":       record.SHA256,
+						"verified":     record.Verified,
 					})
 				}
 			}
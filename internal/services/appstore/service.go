@@ -1,13 +1,17 @@
 package appstore
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
+
+	"vps-panel/internal/services/events"
+	"vps-panel/internal/services/process"
 )
 
 // ServiceStatus represents the status of a service
@@ -90,51 +94,42 @@ func GetServiceStatus(packageID, version string) (*ServiceStatus, error) {
 	return status, nil
 }
 
-// getProcessPID returns the PID of a running process, or 0 if not running
+// getProcessPID returns the PID of the oldest process whose command line
+// contains processName, or 0 if not running
 func getProcessPID(processName string) int {
-	var cmd *exec.Cmd
+	return process.FindOldest(processName)
+}
 
-	switch runtime.GOOS {
-	case "windows":
-		// /NH = No Header, /FO CSV = CSV format
-		// Output: "imagename","pid",...
-		cmd = exec.Command("tasklist", "/FI", fmt.Sprintf("IMAGENAME eq %s*", processName), "/FO", "CSV", "/NH")
-	default:
-		// pgrep -f matches full command line
-		// -o returns only the oldest (parent) pid
-		cmd = exec.Command("pgrep", "-f", "-o", processName)
-	}
+// ServiceEvent is published on the service topic after a service action
+type ServiceEvent struct {
+	PackageID string `json:"package_id"`
+	Version   string `json:"version"`
+	Action    string `json:"action"` // start, stop, restart
+	Running   bool   `json:"running"`
+	Error     string `json:"error,omitempty"`
+}
 
-	outputBytes, err := cmd.Output()
+// publishServiceEvent reports the outcome of an action with the state the
+// service is left in
+func publishServiceEvent(packageID, version, action string, err error) {
+	event := ServiceEvent{PackageID: packageID, Version: version, Action: action}
 	if err != nil {
-		return 0
+		event.Error = err.Error()
 	}
-	output := strings.TrimSpace(string(outputBytes))
-
-	// Check for "No tasks are running" message in Windows
-	if output == "" || strings.Contains(output, "No tasks") {
-		return 0
+	if status, statusErr := GetServiceStatus(packageID, version); statusErr == nil {
+		event.Running = status.Running
 	}
-
-	if runtime.GOOS == "windows" {
-		// Output example: "nginx.exe","1234","Console","0","5,678 K"
-		parts := strings.Split(output, ",")
-		if len(parts) >= 2 {
-			pidStr := strings.Trim(parts[1], "\"")
-			pid, _ := strconv.Atoi(pidStr)
-			return pid
-		}
-	} else {
-		// Output example: 1234
-		pid, _ := strconv.Atoi(output)
-		return pid
-	}
-
-	return 0
+	events.Publish(events.TopicService, event)
 }
 
 // StartService starts a service
 func StartService(packageID, version string) error {
+	err := startService(packageID, version)
+	publishServiceEvent(packageID, version, "start", err)
+	return err
+}
+
+func startService(packageID, version string) error {
 	pkg := GetPortablePackageByID(packageID)
 	if pkg == nil {
 		return fmt.Errorf("package not found: %s", packageID)
@@ -172,7 +167,7 @@ func StartService(packageID, version string) error {
 		}
 	case "mysql", "mariadb":
 		// MySQL/MariaDB
-		dataDir := filepath.Join(installPath, "data")
+		dataDir, mysqldPath := mysqlPaths(installPath)
 		os.MkdirAll(dataDir, 0755)
 
 		// Create my.ini config if not exists
@@ -186,26 +181,9 @@ func StartService(packageID, version string) error {
 			os.WriteFile(configFile, []byte(configContent), 0644)
 		}
 
-		// Get mysqld path (add .exe on Windows)
-		mysqldPath := filepath.Join(installPath, "bin", "mysqld")
-		if runtime.GOOS == "windows" {
-			mysqldPath += ".exe"
-		}
-
-		// Initialize data dir if ibdata1 doesn't exist (better check than mysql folder)
-		ibdataFile := filepath.Join(dataDir, "ibdata1")
-		if _, err := os.Stat(ibdataFile); os.IsNotExist(err) {
-			// Clear data dir first
-			os.RemoveAll(dataDir)
-			os.MkdirAll(dataDir, 0755)
-
-			initCmd := exec.Command(mysqldPath,
-				"--initialize-insecure",
-				"--basedir="+installPath,
-				"--datadir="+dataDir,
-				"--console")
-			initCmd.Dir = installPath
-			initCmd.Run() // Wait for init to complete
+		// Callers normally run this as a task first; it can take minutes
+		if NeedsInitialize(packageID, version) {
+			InitializeDataDir(context.Background(), packageID, version, nil)
 		}
 
 		cmd = exec.Command(mysqldPath,
@@ -243,8 +221,73 @@ func StartService(packageID, version string) error {
 	return nil
 }
 
+// mysqlPaths returns the data directory and mysqld binary of an install
+func mysqlPaths(installPath string) (dataDir, mysqldPath string) {
+	dataDir = filepath.Join(installPath, "data")
+	mysqldPath = filepath.Join(installPath, "bin", "mysqld")
+	if runtime.GOOS == "windows" {
+		mysqldPath += ".exe"
+	}
+	return dataDir, mysqldPath
+}
+
+// NeedsInitialize reports whether a MySQL/MariaDB install has no data
+// directory yet. ibdata1 is a better check than the mysql folder, which a
+// failed initialization can leave behind.
+func NeedsInitialize(packageID, version string) bool {
+	if packageID != "mysql" && packageID != "mariadb" {
+		return false
+	}
+	pkg := GetPortablePackageByID(packageID)
+	if pkg == nil {
+		return false
+	}
+	dataDir, _ := mysqlPaths(filepath.Join(GetBaseDir(), pkg.InstallPath, version))
+	_, err := os.Stat(filepath.Join(dataDir, "ibdata1"))
+	return os.IsNotExist(err)
+}
+
+// InitializeDataDir creates a fresh MySQL/MariaDB data directory with a
+// passwordless root, writing mysqld's output to output when set
+func InitializeDataDir(ctx context.Context, packageID, version string, output io.Writer) error {
+	pkg := GetPortablePackageByID(packageID)
+	if pkg == nil {
+		return fmt.Errorf("package not found: %s", packageID)
+	}
+	installPath := filepath.Join(GetBaseDir(), pkg.InstallPath, version)
+	dataDir, mysqldPath := mysqlPaths(installPath)
+
+	// Clear what an earlier attempt left first
+	os.RemoveAll(dataDir)
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, mysqldPath,
+		"--initialize-insecure",
+		"--basedir="+installPath,
+		"--datadir="+dataDir,
+		"--console")
+	cmd.Dir = installPath
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("initialization failed: %w", err)
+	}
+	return nil
+}
+
 // StopService stops a running service
 func StopService(packageID, version string) error {
+	err := stopService(packageID, version)
+	publishServiceEvent(packageID, version, "stop", err)
+	return err
+}
+
+func stopService(packageID, version string) error {
 	pkg := GetPortablePackageByID(packageID)
 	if pkg == nil {
 		return fmt.Errorf("package not found: %s", packageID)
@@ -304,8 +347,10 @@ func StopService(packageID, version string) error {
 
 // RestartService restarts a service
 func RestartService(packageID, version string) error {
-	StopService(packageID, version)
-	return StartService(packageID, version)
+	stopService(packageID, version)
+	err := startService(packageID, version)
+	publishServiceEvent(packageID, version, "restart", err)
+	return err
 }
 
 // killProcess kills a process by name
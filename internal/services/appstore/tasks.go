@@ -0,0 +1,143 @@
+package appstore
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vps-panel/internal/models"
+	"vps-panel/internal/services/events"
+	"vps-panel/internal/services/task"
+)
+
+// InstallTaskType is the task type of package installs
+const InstallTaskType = "portable.install"
+
+// jobRetention is how long the detailed progress of finished installs is
+// kept for InstallJob
+const jobRetention = time.Hour
+
+// InstallJob is an install task in the shape /api/portable/jobs has
+// always returned
+type InstallJob struct {
+	ID         string          `json:"id"`
+	PackageID  string          `json:"package_id"`
+	Version    string          `json:"version"`
+	Username   string          `json:"username"`
+	Progress   InstallProgress `json:"progress"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+type jobProgress struct {
+	progress InstallProgress
+	updated  time.Time
+}
+
+var (
+	jobsMu sync.Mutex
+	jobs   = make(map[uint]jobProgress) // Latest progress by task ID
+)
+
+func recordJobProgress(progress InstallProgress) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	now := time.Now()
+	for id, job := range jobs {
+		if now.Sub(job.updated) > jobRetention {
+			delete(jobs, id)
+		}
+	}
+	jobs[progress.TaskID] = jobProgress{progress: progress, updated: now}
+}
+
+// JobFromTask describes an install task as an InstallJob. Detailed
+// progress comes from the install itself while it is remembered, otherwise
+// it is derived from the task.
+func JobFromTask(t *models.Task) InstallJob {
+	packageID, version, _ := strings.Cut(t.Target, " ")
+	job := InstallJob{
+		ID:         strconv.FormatUint(uint64(t.ID), 10),
+		PackageID:  packageID,
+		Version:    version,
+		Username:   t.Username,
+		StartedAt:  t.CreatedAt,
+		FinishedAt: t.FinishedAt,
+	}
+
+	jobsMu.Lock()
+	recorded, ok := jobs[t.ID]
+	jobsMu.Unlock()
+	if ok {
+		job.Progress = recorded.progress
+		return job
+	}
+
+	status := map[string]string{
+		task.StatusQueued:    "queued",
+		task.StatusRunning:   "downloading",
+		task.StatusSuccess:   "complete",
+		task.StatusFailed:    "error",
+		task.StatusCancelled: "cancelled",
+	}[t.Status]
+	job.Progress = InstallProgress{
+		TaskID:    t.ID,
+		PackageID: packageID,
+		Version:   version,
+		Status:    status,
+		Progress:  t.Progress,
+		Message:   t.Message,
+		Error:     t.Error,
+	}
+	return job
+}
+
+// InstallTask returns the work of a "portable.install" task. Progress goes
+// to the task and, tagged with the task's ID, to the install topic.
+func InstallTask(packageID, version string) task.Func {
+	return func(ctx context.Context, t *task.Handle) error {
+		// Download progress is published once per whole percent
+		lastStatus, lastPercent := "", -1
+		report := func(progress InstallProgress) {
+			progress.TaskID = t.ID()
+			recordJobProgress(progress)
+			t.Progress(progress.Progress, progress.Message)
+
+			if percent := int(progress.Progress); progress.Status != lastStatus || percent != lastPercent {
+				lastStatus, lastPercent = progress.Status, percent
+				events.Publish(events.TopicInstall, progress)
+			}
+		}
+
+		result, err := InstallPortablePackage(ctx, packageID, version, report)
+		if err != nil && result == nil {
+			// Failed before anything was reported
+			report(InstallProgress{
+				PackageID: packageID,
+				Version:   version,
+				Status:    "error",
+				Error:     err.Error(),
+			})
+		}
+		return err
+	}
+}
+
+// InitializeTask returns the work of a "mysql.init" task: a fresh data
+// directory is created, then the service is started or restarted
+func InitializeTask(packageID, version, action string) task.Func {
+	return func(ctx context.Context, t *task.Handle) error {
+		t.Progress(0, "Initializing data directory...")
+		if err := InitializeDataDir(ctx, packageID, version, t); err != nil {
+			return err
+		}
+
+		t.Progress(90, "Starting service...")
+		if action == "restart" {
+			return RestartService(packageID, version)
+		}
+		return StartService(packageID, version)
+	}
+}
@@ -0,0 +1,208 @@
+package appstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test vectors made with fixed ed25519 keys in minisign's format: the
+// signature is a prehashed ("ED") signature of testArchive by testKey.
+const (
+	testArchive = "vps-panel test archive\n"
+
+	testKey = `untrusted comment: minisign public key 1234569ABCDEF0
+RWQSNFZ4mrze8IqI4910CfGV/VLbLTy6XXLKZwm/HZQSG/N0iAG0D29c`
+
+	// Same algorithm, different key and key ID
+	otherKey = "RWQSNFZ4mrze8YE5dw6ofRdfVqNUZsNMfszLjYqRtO43ol32D1uPybOU"
+
+	testSignature = `untrusted comment: signature from minisign secret key
+RUQSNFZ4mrze8G+f/BxOmKbzC9ZSy5kFLAPmPao6psPhMKetfHyh4in5pCb8NAwrevJ62QLcYOVDHlGDPkiI4W0jBEED+e9F5gs=
+trusted comment: timestamp:1767225600	file:test.tar.gz	hashed
+0yTNzNVwmtFloAgUafKwFmuhzaKN/38Pq46jUJKlCDuTMdkfgBolfqWweYhkKXQ2LKndaFv4YDI+ppepCCBWCw==
+`
+)
+
+func writeArchive(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.tar.gz")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		sig     string
+		archive string
+		wantErr string
+	}{
+		{
+			name:    "good signature",
+			key:     testKey,
+			sig:     testSignature,
+			archive: testArchive,
+		},
+		{
+			name:    "bare key",
+			key:     strings.Split(testKey, "\n")[1],
+			sig:     testSignature,
+			archive: testArchive,
+		},
+		{
+			name:    "tampered file",
+			key:     testKey,
+			sig:     testSignature,
+			archive: testArchive + "appended\n",
+			wantErr: "invalid signature",
+		},
+		{
+			name:    "other key",
+			key:     otherKey,
+			sig:     testSignature,
+			archive: testArchive,
+			wantErr: "signed with key 123456789ABCDEF0, expected 123456789ABCDEF1",
+		},
+		{
+			name:    "edited trusted comment",
+			key:     testKey,
+			sig:     strings.Replace(testSignature, "file:test.tar.gz", "file:other.tar.gz", 1),
+			archive: testArchive,
+			wantErr: "invalid trusted comment signature",
+		},
+		{
+			name:    "legacy unhashed algorithm",
+			key:     testKey,
+			sig:     strings.Replace(testSignature, "\nRUQS", "\nRWQS", 1), // "ED" -> "Ed"
+			archive: testArchive,
+			wantErr: `unsupported signature algorithm "Ed"`,
+		},
+		{
+			name:    "truncated signature file",
+			key:     testKey,
+			sig:     strings.Join(strings.Split(testSignature, "\n")[:2], "\n"),
+			archive: testArchive,
+			wantErr: "malformed signature file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyMinisign(tt.key, []byte(tt.sig), writeArchive(t, tt.archive))
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("verifyMinisign: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("verifyMinisign error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/test.tar.gz.minisig" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testSignature))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		download Download
+		archive  string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "nothing pinned",
+			download: Download{URL: server.URL + "/test.tar.gz"},
+			archive:  testArchive,
+			want:     VerifiedNone,
+		},
+		{
+			name:     "checksum",
+			download: Download{URL: server.URL + "/test.tar.gz", SHA256: sha256Hex(testArchive)},
+			archive:  testArchive,
+			want:     VerifiedChecksum,
+		},
+		{
+			name:     "checksum mismatch",
+			download: Download{URL: server.URL + "/test.tar.gz", SHA256: sha256Hex(testArchive)},
+			archive:  "something else\n",
+			wantErr:  "checksum mismatch",
+		},
+		{
+			name: "checksum and signature",
+			download: Download{
+				URL:          server.URL + "/test.tar.gz",
+				SHA256:       sha256Hex(testArchive),
+				SignatureURL: server.URL + "/test.tar.gz.minisig",
+				SigningKey:   testKey,
+			},
+			archive: testArchive,
+			want:    VerifiedSignature,
+		},
+		{
+			name: "signature from another key",
+			download: Download{
+				URL:          server.URL + "/test.tar.gz",
+				SignatureURL: server.URL + "/test.tar.gz.minisig",
+				SigningKey:   otherKey,
+			},
+			archive: testArchive,
+			wantErr: "signature verification failed",
+		},
+		{
+			name: "signature not published",
+			download: Download{
+				URL:          server.URL + "/test.tar.gz",
+				SignatureURL: server.URL + "/missing.minisig",
+				SigningKey:   testKey,
+			},
+			archive: testArchive,
+			wantErr: "signature download failed: 404 Not Found",
+		},
+		{
+			name:     "signature without a key",
+			download: Download{URL: server.URL + "/test.tar.gz", SignatureURL: server.URL + "/test.tar.gz.minisig"},
+			archive:  testArchive,
+			wantErr:  "no signing key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifyDownload(context.Background(), &tt.download, writeArchive(t, tt.archive), sha256Hex(tt.archive))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("verifyDownload error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyDownload: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("verifyDownload = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
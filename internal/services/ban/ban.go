@@ -0,0 +1,296 @@
+package ban
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"vps-panel/internal/config"
+	"vps-panel/internal/database"
+	"vps-panel/internal/models"
+	"vps-panel/internal/services/firewall"
+)
+
+var (
+	failures map[string][]time.Time // "ip:1.2.3.4" / "user:bob" -> failure times
+	active   map[string]models.Ban  // Same keys -> active ban
+	mutex    sync.Mutex
+)
+
+// Init loads active bans and starts expiry and the SSH log watcher
+func Init() {
+	failures = make(map[string][]time.Time)
+	active = make(map[string]models.Ban)
+
+	var bans []models.Ban
+	database.DB.Where("expires_at > ?", time.Now()).Find(&bans)
+	for _, b := range bans {
+		active[key(b.Kind, b.Value)] = b
+	}
+
+	go expireLoop()
+	watchSSHLog(config.AppConfig.Ban.SSHLog)
+
+	log.Printf("🛡️  Brute-force protection enabled (%d active bans)", len(bans))
+}
+
+func key(kind, value string) string {
+	return kind + ":" + value
+}
+
+// IsBanned reports whether an IP has an active ban
+func IsBanned(ip string) bool {
+	return isActive("ip", ip)
+}
+
+// IsLocked reports whether a username is temporarily locked
+func IsLocked(username string) bool {
+	return isActive("user", strings.ToLower(username))
+}
+
+func isActive(kind, value string) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	b, ok := active[key(kind, value)]
+	return ok && time.Now().Before(b.ExpiresAt)
+}
+
+// RecordFailure counts a failed login and bans the IP or locks the username
+// once it reaches the configured number of retries
+func RecordFailure(ip, username, source string) {
+	if ip != "" && !IsWhitelisted(ip) {
+		if countFailure(key("ip", ip)) {
+			reason := fmt.Sprintf("%d failed %s logins", config.AppConfig.Ban.MaxRetries, source)
+			if _, err := Ban("ip", ip, source, reason, config.AppConfig.Ban.BanTime); err != nil {
+				log.Printf("Ban: failed to ban %s: %v", ip, err)
+			}
+		}
+	}
+
+	if username != "" && source == "panel" {
+		username = strings.ToLower(username)
+		if countFailure(key("user", username)) {
+			reason := fmt.Sprintf("%d failed logins", config.AppConfig.Ban.MaxRetries)
+			if _, err := Ban("user", username, source, reason, config.AppConfig.Ban.BanTime); err != nil {
+				log.Printf("Ban: failed to lock %s: %v", username, err)
+			}
+		}
+	}
+}
+
+// countFailure records a failure and reports whether the threshold was reached
+func countFailure(k string) bool {
+	cfg := config.AppConfig.Ban
+	if cfg.MaxRetries <= 0 {
+		return false
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	now := time.Now()
+	recent := failures[k][:0]
+	for _, t := range failures[k] {
+		if now.Sub(t) < cfg.FindTime {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+
+	if len(recent) >= cfg.MaxRetries {
+		delete(failures, k)
+		return true
+	}
+	failures[k] = recent
+	return false
+}
+
+// Reset clears failure counters after a successful login
+func Reset(ip, username string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	delete(failures, key("ip", ip))
+	delete(failures, key("user", strings.ToLower(username)))
+}
+
+// Ban bans an IP or locks a username for the given duration
+func Ban(kind, value, source, reason string, duration time.Duration) (*models.Ban, error) {
+	switch kind {
+	case "ip":
+		if net.ParseIP(value) == nil {
+			return nil, fmt.Errorf("invalid IP address '%s'", value)
+		}
+		if IsWhitelisted(value) {
+			return nil, fmt.Errorf("%s is whitelisted", value)
+		}
+	case "user":
+	default:
+		return nil, fmt.Errorf("invalid ban kind '%s'", kind)
+	}
+
+	b := models.Ban{
+		Kind:      kind,
+		Value:     value,
+		Source:    source,
+		Reason:    reason,
+		ExpiresAt: time.Now().Add(duration),
+	}
+
+	// Replace any earlier ban for the same target, keeping its firewall rule
+	var previous models.Ban
+	if database.DB.Where("kind = ? AND value = ?", kind, value).First(&previous).Error == nil {
+		b.Firewall = previous.Firewall
+		database.DB.Where("kind = ? AND value = ?", kind, value).Delete(&models.Ban{})
+	}
+
+	if kind == "ip" && !b.Firewall && config.AppConfig.Ban.UseFirewall {
+		if err := addFirewallBlock(value); err != nil {
+			log.Printf("Ban: firewall block for %s failed: %v", value, err)
+		} else {
+			b.Firewall = true
+		}
+	}
+
+	if err := database.DB.Create(&b).Error; err != nil {
+		return nil, err
+	}
+
+	mutex.Lock()
+	active[key(kind, value)] = b
+	mutex.Unlock()
+
+	log.Printf("🛡️  Banned %s %s until %s (%s)", kind, value, b.ExpiresAt.Format(time.RFC3339), reason)
+	return &b, nil
+}
+
+// GetBans returns all active bans
+func GetBans() ([]models.Ban, error) {
+	var bans []models.Ban
+	err := database.DB.Where("expires_at > ?", time.Now()).Order("created_at desc").Find(&bans).Error
+	return bans, err
+}
+
+// Unban lifts a ban before it expires
+func Unban(id uint) error {
+	var b models.Ban
+	if err := database.DB.First(&b, id).Error; err != nil {
+		return fmt.Errorf("ban not found")
+	}
+	return lift(b)
+}
+
+func lift(b models.Ban) error {
+	if b.Firewall {
+		if err := firewall.DeleteRule(firewallRuleName(b.Value)); err != nil {
+			log.Printf("Ban: removing firewall block for %s failed: %v", b.Value, err)
+		}
+	}
+
+	mutex.Lock()
+	delete(active, key(b.Kind, b.Value))
+	mutex.Unlock()
+
+	return database.DB.Delete(&models.Ban{}, b.ID).Error
+}
+
+func expireLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var expired []models.Ban
+		database.DB.Where("expires_at <= ?", time.Now()).Find(&expired)
+		for _, b := range expired {
+			if err := lift(b); err != nil {
+				log.Printf("Ban: failed to expire ban %d: %v", b.ID, err)
+			}
+		}
+	}
+}
+
+// firewallRuleName maps an IP to a valid firewall rule name
+func firewallRuleName(ip string) string {
+	return "ban-" + strings.ReplaceAll(ip, ":", "-")
+}
+
+func addFirewallBlock(ip string) error {
+	rule := models.FirewallRule{
+		Name:     firewallRuleName(ip),
+		Protocol: "any",
+		Source:   ip,
+		Action:   "block",
+		Priority: 1,
+	}
+	if err := firewall.ValidateRule(&rule); err != nil {
+		return err
+	}
+	return firewall.AddRule(rule)
+}
+
+// IsWhitelisted reports whether an IP is covered by the config or DB whitelist
+func IsWhitelisted(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	entries := append([]string{}, config.AppConfig.Ban.Whitelist...)
+	var rows []models.BanWhitelist
+	database.DB.Find(&rows)
+	for _, row := range rows {
+		entries = append(entries, row.CIDR)
+	}
+
+	for _, entry := range entries {
+		if entryIP := net.ParseIP(entry); entryIP != nil {
+			if entryIP.Equal(addr) {
+				return true
+			}
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetWhitelist returns the whitelist entries managed through the API
+func GetWhitelist() ([]models.BanWhitelist, error) {
+	var rows []models.BanWhitelist
+	err := database.DB.Order("created_at desc").Find(&rows).Error
+	return rows, err
+}
+
+// AddWhitelist whitelists an IP or CIDR and lifts any active ban it covers
+func AddWhitelist(cidr, note string) (*models.BanWhitelist, error) {
+	cidr = strings.TrimSpace(cidr)
+	if net.ParseIP(cidr) == nil {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return nil, fmt.Errorf("'%s' is not an IP address or CIDR", cidr)
+		}
+	}
+
+	row := models.BanWhitelist{CIDR: cidr, Note: note}
+	if err := database.DB.Create(&row).Error; err != nil {
+		return nil, err
+	}
+
+	bans, _ := GetBans()
+	for _, b := range bans {
+		if b.Kind == "ip" && IsWhitelisted(b.Value) {
+			lift(b)
+		}
+	}
+	return &row, nil
+}
+
+// RemoveWhitelist deletes a whitelist entry
+func RemoveWhitelist(id uint) error {
+	return database.DB.Delete(&models.BanWhitelist{}, id).Error
+}
@@ -0,0 +1,102 @@
+package ban
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"runtime"
+	"time"
+)
+
+// sshFailureRe matches one failed authentication attempt. sshd also logs
+// "Invalid user X from IP" ahead of the "Failed ... for invalid user X"
+// line of the same attempt, so that line is not matched; counting both
+// would ban at half of max_retries.
+var sshFailureRe = regexp.MustCompile(`Failed (?:password|publickey|keyboard-interactive/pam) for (?:invalid user )?(\S+) from (\S+)`)
+
+// watchSSHLog tails the auth log and records SSH login failures. An empty
+// path auto-detects the distro's log; "off" disables the watcher.
+func watchSSHLog(path string) {
+	if path == "off" || runtime.GOOS == "windows" {
+		return
+	}
+
+	if path == "" {
+		for _, candidate := range []string{"/var/log/auth.log", "/var/log/secure"} {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+		if path == "" {
+			return
+		}
+	}
+
+	log.Printf("🛡️  Watching %s for SSH login failures", path)
+	go tailLog(path)
+}
+
+// tailLog polls the file for appended lines, starting at its current end and
+// reopening it when it is rotated or truncated
+func tailLog(path string) {
+	var offset int64 = -1
+
+	for {
+		offset = readNewLines(path, offset)
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func readNewLines(path string, offset int64) int64 {
+	file, err := os.Open(path)
+	if err != nil {
+		return offset
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return offset
+	}
+
+	// First run: skip history. Shrunk file: rotated, start over.
+	if offset < 0 {
+		return info.Size()
+	}
+	if info.Size() < offset {
+		offset = 0
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return offset
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// Leave a partial last line for the next poll
+			return offset
+		}
+		offset += int64(len(line))
+		parseSSHLine(line)
+	}
+}
+
+func parseSSHLine(line string) {
+	if ip, username, ok := matchSSHFailure(line); ok {
+		RecordFailure(ip, username, "ssh")
+	}
+}
+
+// matchSSHFailure extracts the client IP and username of a failed login
+func matchSSHFailure(line string) (ip, username string, ok bool) {
+	m := sshFailureRe.FindStringSubmatch(line)
+	if m == nil {
+		return "", "", false
+	}
+	return m[2], m[1], true
+}
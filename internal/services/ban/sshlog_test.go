@@ -0,0 +1,50 @@
+package ban
+
+import (
+	"strings"
+	"testing"
+)
+
+// An auth.log excerpt from a Debian host: two attempts on an unknown user,
+// one wrong password for root, keyboard-interactive and publickey failures,
+// and noise that must not count
+const authLog = `Mar  3 10:15:01 web1 sshd[20311]: Invalid user oracle from 203.0.113.7 port 51022
+Mar  3 10:15:03 web1 sshd[20311]: pam_unix(sshd:auth): check pass; user unknown
+Mar  3 10:15:03 web1 sshd[20311]: pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=203.0.113.7
+Mar  3 10:15:05 web1 sshd[20311]: Failed password for invalid user oracle from 203.0.113.7 port 51022 ssh2
+Mar  3 10:15:08 web1 sshd[20311]: Failed password for invalid user oracle from 203.0.113.7 port 51022 ssh2
+Mar  3 10:15:09 web1 sshd[20311]: Connection closed by invalid user oracle 203.0.113.7 port 51022 [preauth]
+Mar  3 10:16:40 web1 sshd[20402]: Failed password for root from 198.51.100.23 port 40110 ssh2
+Mar  3 10:16:44 web1 sshd[20402]: Accepted password for root from 198.51.100.23 port 40110 ssh2
+Mar  3 10:16:44 web1 sshd[20402]: pam_unix(sshd:session): session opened for user root(uid=0) by (uid=0)
+Mar  3 10:18:12 web1 sshd[20455]: Failed keyboard-interactive/pam for invalid user admin from 2001:db8::5 port 60021 ssh2
+Mar  3 10:19:30 web1 sshd[20490]: Failed publickey for deploy from 192.0.2.44 port 33912 ssh2
+Mar  3 10:19:31 web1 sshd[20490]: Received disconnect from 192.0.2.44 port 33912:11: Bye Bye [preauth]
+`
+
+func TestMatchSSHFailure(t *testing.T) {
+	type failure struct{ ip, username string }
+	want := []failure{
+		{"203.0.113.7", "oracle"},
+		{"203.0.113.7", "oracle"},
+		{"198.51.100.23", "root"},
+		{"2001:db8::5", "admin"},
+		{"192.0.2.44", "deploy"},
+	}
+
+	var got []failure
+	for _, line := range strings.Split(authLog, "\n") {
+		if ip, username, ok := matchSSHFailure(line); ok {
+			got = append(got, failure{ip, username})
+		}
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("matched %d failures, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("failure %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
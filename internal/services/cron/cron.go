@@ -9,6 +9,7 @@ import (
 
 	"vps-panel/internal/database"
 	"vps-panel/internal/models"
+	"vps-panel/internal/services/events"
 
 	"github.com/robfig/cron/v3"
 )
@@ -118,8 +119,21 @@ func addJobToScheduler(job models.CronJob) {
 	mutex.Unlock()
 }
 
+// RunEvent is published on the cron topic when a job starts and finishes
+type RunEvent struct {
+	JobID    uint    `json:"job_id"`
+	Command  string  `json:"command"`
+	Status   string  `json:"status"`             // running, success, error
+	Duration float64 `json:"duration,omitempty"` // Seconds
+	Output   string  `json:"output,omitempty"`   // Last 4 KiB
+}
+
+// maxEventOutput caps the output sent with a finished run
+const maxEventOutput = 4096
+
 func runJob(id uint, command string) {
 	log.Printf("Running cron job %d: %s", id, command)
+	events.Publish(events.TopicCron, RunEvent{JobID: id, Command: command, Status: "running"})
 
 	var cmd *exec.Cmd
 	if runtime.GOOS == "windows" {
@@ -128,7 +142,9 @@ func runJob(id uint, command string) {
 		cmd = exec.Command("sh", "-c", command)
 	}
 
+	started := time.Now()
 	output, err := cmd.CombinedOutput()
+	duration := time.Since(started).Seconds()
 	status := "success"
 	result := string(output)
 
@@ -137,13 +153,20 @@ func runJob(id uint, command string) {
 		result += "\nError: " + err.Error()
 	}
 
+	tail := result
+	if len(tail) > maxEventOutput {
+		tail = tail[len(tail)-maxEventOutput:]
+	}
+	events.Publish(events.TopicCron, RunEvent{JobID: id, Command: command, Status: status, Duration: duration, Output: tail})
+
 	// Update DB (in a separate goroutine to not block)
 	go func() {
 		now := time.Now()
 		database.DB.Model(&models.CronJob{}).Where("id = ?", id).Updates(map[string]interface{}{
-			"last_run":    now,
-			"last_status": status,
-			"last_result": result,
+			"last_run":      now,
+			"last_status":   status,
+			"last_result":   result,
+			"last_duration": duration,
 		})
 	}()
 }
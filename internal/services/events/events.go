@@ -0,0 +1,75 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Topics published by the panel
+const (
+	TopicStats     = "stats"     // monitor.SystemStats after every sample
+	TopicInstall   = "install"   // Package installation progress
+	TopicCron      = "cron"      // Cron job started or finished
+	TopicService   = "service"   // Service started, stopped or restarted
+	TopicContainer = "container" // Container started, stopped, removed or created
+	TopicAlert     = "alert"     // Alert rule fired or resolved
+	TopicFiles     = "files"     // File created, changed, renamed or deleted
+	TopicTask      = "task"      // Background task queued, progressed or finished
+)
+
+// Topics lists every known topic
+var Topics = []string{
+	TopicStats, TopicInstall, TopicCron, TopicService,
+	TopicContainer, TopicAlert, TopicFiles, TopicTask,
+}
+
+// Event is one published message
+type Event struct {
+	Topic string      `json:"topic"`
+	Time  time.Time   `json:"time"`
+	Data  interface{} `json:"data"`
+}
+
+var (
+	mutex       sync.RWMutex
+	subscribers = make(map[int]func(Event))
+	nextID      int
+)
+
+// Known reports whether topic is one of Topics
+func Known(topic string) bool {
+	for _, t := range Topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish hands an event to every subscriber. It runs subscribers on the
+// caller's goroutine, so they must not block.
+func Publish(topic string, data interface{}) {
+	event := Event{Topic: topic, Time: time.Now(), Data: data}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+	for _, fn := range subscribers {
+		fn(event)
+	}
+}
+
+// Subscribe registers fn for every published event and returns a function
+// that removes it. fn must not block.
+func Subscribe(fn func(Event)) func() {
+	mutex.Lock()
+	id := nextID
+	nextID++
+	subscribers[id] = fn
+	mutex.Unlock()
+
+	return func() {
+		mutex.Lock()
+		delete(subscribers, id)
+		mutex.Unlock()
+	}
+}
@@ -0,0 +1,138 @@
+package firewall
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"vps-panel/internal/models"
+)
+
+// ruleComment tags every rule the panel creates so it can be found again
+const ruleComment = "vps-panel:"
+
+// Backend translates panel rules into OS firewall commands. AddRule receives
+// the managed rules of the same direction that must be evaluated before it,
+// so backends with ordered chains can insert at the right position.
+type Backend interface {
+	Name() string
+	Available() bool
+	AddRule(rule models.FirewallRule, preceding []models.FirewallRule) error
+	DeleteRule(rule models.FirewallRule) error
+	ListRules() ([]LiveRule, error)
+	DeleteLive(live LiveRule) error
+	// RestoreLive re-creates a rule removed with DeleteLive, where the
+	// backend can tell, at its old position
+	RestoreLive(live LiveRule) error
+}
+
+// LiveRule is a rule read back from the OS firewall
+type LiveRule struct {
+	Rule    models.FirewallRule `json:"rule"`
+	Managed bool                `json:"managed"` // Tagged with the panel comment
+	Builtin bool                `json:"builtin"` // In a chain the panel doesn't own, e.g. the iptables INPUT chain
+	Ref     string              `json:"ref"`     // Backend-specific identity used to delete it
+
+	position int // 1-based place in its chain when listed, 0 if unknown
+}
+
+// BackendInfo describes a detected firewall backend
+type BackendInfo struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	Active    bool   `json:"active"`
+}
+
+// CommandRunner executes external commands. It can be replaced with a fake
+// so rule translation can be exercised without root.
+type CommandRunner interface {
+	Run(name string, args ...string) ([]byte, error)
+	LookPath(file string) (string, error)
+}
+
+type execRunner struct{}
+
+func (execRunner) Run(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+func (execRunner) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+var runner CommandRunner = execRunner{}
+
+// SetRunner replaces the command runner used by all backends
+func SetRunner(r CommandRunner) {
+	runner = r
+}
+
+// allBackends returns the backends for the current OS in order of preference
+func allBackends() []Backend {
+	switch runtime.GOOS {
+	case "windows":
+		return []Backend{&netshBackend{}}
+	case "linux":
+		return []Backend{&ufwBackend{}, &nftablesBackend{}, &iptablesBackend{}}
+	}
+	return nil
+}
+
+// detectBackend returns the first available backend, or nil if none
+func detectBackend() Backend {
+	for _, b := range allBackends() {
+		if b.Available() {
+			return b
+		}
+	}
+	return nil
+}
+
+func hasCommand(name string) bool {
+	_, err := runner.LookPath(name)
+	return err == nil
+}
+
+// managedName returns the rule name from a panel comment tag
+func managedName(comment string) (string, bool) {
+	comment = strings.Trim(comment, "\"'")
+	if !strings.HasPrefix(comment, ruleComment) {
+		return "", false
+	}
+	return strings.TrimPrefix(comment, ruleComment), true
+}
+
+// splitArgs splits a command line on whitespace, keeping quoted strings together
+func splitArgs(line string) []string {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArg := false
+
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args
+}
@@ -0,0 +1,544 @@
+package firewall
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"vps-panel/internal/models"
+)
+
+// fakeRunner records commands instead of running them. Commands are answered
+// from results by their full command line; anything else succeeds with no
+// output.
+type fakeRunner struct {
+	commands []string // Installed commands
+	results  map[string]fakeResult
+	calls    []string
+}
+
+type fakeResult struct {
+	output string
+	err    error
+}
+
+var errExit = errors.New("exit status 1")
+
+func (f *fakeRunner) Run(name string, args ...string) ([]byte, error) {
+	line := strings.Join(append([]string{name}, args...), " ")
+	f.calls = append(f.calls, line)
+	r := f.results[line]
+	return []byte(r.output), r.err
+}
+
+func (f *fakeRunner) LookPath(file string) (string, error) {
+	for _, c := range f.commands {
+		if c == file {
+			return "/usr/sbin/" + file, nil
+		}
+	}
+	return "", exec.ErrNotFound
+}
+
+func useFakeRunner(t *testing.T, f *fakeRunner) {
+	t.Helper()
+	SetRunner(f)
+	t.Cleanup(func() { SetRunner(execRunner{}) })
+}
+
+// nftInputListing is "nft -a list chain inet vps_panel input" with two panel
+// rules and one added by hand
+const nftInputListing = `table inet vps_panel {
+	chain input { # handle 1
+		type filter hook input priority filter; policy accept;
+		tcp dport 22 accept comment "vps-panel:ssh" # handle 4
+		iifname "lo" accept # handle 5
+		tcp dport 3306 drop comment "vps-panel:mysql" # handle 7
+	}
+}
+`
+
+func TestBackendAddRule(t *testing.T) {
+	ssh := models.FirewallRule{Name: "ssh", Direction: "in", Action: "allow", Protocol: "tcp", Port: "22"}
+	web := models.FirewallRule{Name: "web", Direction: "in", Action: "allow", Protocol: "tcp", Port: "80,8000-8080", Source: "10.0.0.0/8"}
+	ping := models.FirewallRule{Name: "ping", Direction: "out", Action: "block", Protocol: "icmp", Destination: "2001:db8::/32"}
+
+	tests := []struct {
+		name      string
+		backend   Backend
+		rule      models.FirewallRule
+		preceding []models.FirewallRule
+		commands  []string
+		results   map[string]fakeResult
+		want      []string
+		wantErr   string
+	}{
+		{
+			name:     "iptables existing chain, both families",
+			backend:  &iptablesBackend{},
+			rule:     ssh,
+			commands: []string{"iptables", "ip6tables"},
+			want: []string{
+				"iptables -n -L VPS_PANEL_INPUT",
+				"iptables -C INPUT -j VPS_PANEL_INPUT",
+				"iptables -I VPS_PANEL_INPUT 1 -p tcp --dport 22 -m comment --comment vps-panel:ssh -j ACCEPT",
+				"ip6tables -n -L VPS_PANEL_INPUT",
+				"ip6tables -C INPUT -j VPS_PANEL_INPUT",
+				"ip6tables -I VPS_PANEL_INPUT 1 -p tcp --dport 22 -m comment --comment vps-panel:ssh -j ACCEPT",
+			},
+		},
+		{
+			name:      "iptables creates and hooks the chain, skips other-family preceding rules",
+			backend:   &iptablesBackend{},
+			rule:      web,
+			preceding: []models.FirewallRule{ssh, ping},
+			commands:  []string{"iptables"},
+			results: map[string]fakeResult{
+				"iptables -n -L VPS_PANEL_INPUT":       {err: errExit},
+				"iptables -C INPUT -j VPS_PANEL_INPUT": {err: errExit},
+			},
+			want: []string{
+				"iptables -n -L VPS_PANEL_INPUT",
+				"iptables -N VPS_PANEL_INPUT",
+				"iptables -C INPUT -j VPS_PANEL_INPUT",
+				"iptables -I INPUT -j VPS_PANEL_INPUT",
+				"iptables -I VPS_PANEL_INPUT 2 -s 10.0.0.0/8 -p tcp -m multiport --dports 80,8000:8080 -m comment --comment vps-panel:web -j ACCEPT",
+			},
+		},
+		{
+			name:     "iptables chain creation fails",
+			backend:  &iptablesBackend{},
+			rule:     web,
+			commands: []string{"iptables"},
+			results: map[string]fakeResult{
+				"iptables -n -L VPS_PANEL_INPUT": {err: errExit},
+				"iptables -N VPS_PANEL_INPUT":    {output: "Permission denied", err: errExit},
+			},
+			want: []string{
+				"iptables -n -L VPS_PANEL_INPUT",
+				"iptables -N VPS_PANEL_INPUT",
+			},
+			wantErr: "failed to create iptables chain: exit status 1: Permission denied",
+		},
+		{
+			name:     "iptables insert fails",
+			backend:  &iptablesBackend{},
+			rule:     web,
+			commands: []string{"iptables"},
+			results: map[string]fakeResult{
+				"iptables -I VPS_PANEL_INPUT 1 -s 10.0.0.0/8 -p tcp -m multiport --dports 80,8000:8080 -m comment --comment vps-panel:web -j ACCEPT": {output: "Bad argument", err: errExit},
+			},
+			want: []string{
+				"iptables -n -L VPS_PANEL_INPUT",
+				"iptables -C INPUT -j VPS_PANEL_INPUT",
+				"iptables -I VPS_PANEL_INPUT 1 -s 10.0.0.0/8 -p tcp -m multiport --dports 80,8000:8080 -m comment --comment vps-panel:web -j ACCEPT",
+			},
+			wantErr: "failed to add rule: exit status 1: Bad argument",
+		},
+		{
+			name:    "nftables first rule is inserted",
+			backend: &nftablesBackend{},
+			rule:    ssh,
+			want: []string{
+				"nft add table inet vps_panel",
+				"nft add chain inet vps_panel input { type filter hook input priority 0 ; policy accept ; }",
+				"nft -a list chain inet vps_panel input",
+				`nft insert rule inet vps_panel input tcp dport 22 accept comment "vps-panel:ssh"`,
+			},
+		},
+		{
+			name:      "nftables rule goes after the last preceding rule in the live chain",
+			backend:   &nftablesBackend{},
+			rule:      web,
+			preceding: []models.FirewallRule{ssh, {Name: "mysql", Direction: "in"}},
+			results: map[string]fakeResult{
+				"nft -a list chain inet vps_panel input": {output: nftInputListing},
+			},
+			want: []string{
+				"nft add table inet vps_panel",
+				"nft add chain inet vps_panel input { type filter hook input priority 0 ; policy accept ; }",
+				"nft -a list chain inet vps_panel input",
+				`nft add rule inet vps_panel input position 7 ip saddr 10.0.0.0/8 tcp dport { 80, 8000-8080 } accept comment "vps-panel:web"`,
+			},
+		},
+		{
+			name:      "nftables preceding rules missing after drift",
+			backend:   &nftablesBackend{},
+			rule:      web,
+			preceding: []models.FirewallRule{{Name: "dns", Direction: "in"}},
+			results: map[string]fakeResult{
+				"nft -a list chain inet vps_panel input": {output: nftInputListing},
+			},
+			want: []string{
+				"nft add table inet vps_panel",
+				"nft add chain inet vps_panel input { type filter hook input priority 0 ; policy accept ; }",
+				"nft -a list chain inet vps_panel input",
+				`nft insert rule inet vps_panel input ip saddr 10.0.0.0/8 tcp dport { 80, 8000-8080 } accept comment "vps-panel:web"`,
+			},
+		},
+		{
+			name:    "nftables ipv6 icmp block",
+			backend: &nftablesBackend{},
+			rule:    ping,
+			want: []string{
+				"nft add table inet vps_panel",
+				"nft add chain inet vps_panel output { type filter hook output priority 0 ; policy accept ; }",
+				"nft -a list chain inet vps_panel output",
+				`nft insert rule inet vps_panel output ip6 daddr 2001:db8::/32 meta l4proto ipv6-icmp drop comment "vps-panel:ping"`,
+			},
+		},
+		{
+			name:    "nftables table creation fails",
+			backend: &nftablesBackend{},
+			rule:    ssh,
+			results: map[string]fakeResult{
+				"nft add table inet vps_panel": {output: "Operation not permitted", err: errExit},
+			},
+			want:    []string{"nft add table inet vps_panel"},
+			wantErr: "failed to create nftables table: exit status 1: Operation not permitted",
+		},
+		{
+			name:    "ufw appends when no later managed rule exists",
+			backend: &ufwBackend{},
+			rule:    ssh,
+			want: []string{
+				"ufw status numbered",
+				"ufw allow in proto tcp from any to any port 22 comment vps-panel:ssh",
+			},
+		},
+		{
+			name:      "ufw inserts before the next managed rule",
+			backend:   &ufwBackend{},
+			rule:      web,
+			preceding: []models.FirewallRule{ssh},
+			results: map[string]fakeResult{
+				"ufw status numbered": {output: `Status: active
+
+     To                         Action      From
+     --                         ------      ----
+[ 1] 22/tcp                     ALLOW IN    Anywhere                   # vps-panel:ssh
+[ 2] 3306/tcp                   DENY IN     Anywhere                   # vps-panel:mysql
+[ 3] 22/tcp (v6)                ALLOW IN    Anywhere (v6)              # vps-panel:ssh
+`},
+			},
+			want: []string{
+				"ufw status numbered",
+				"ufw insert 2 allow in proto tcp from 10.0.0.0/8 to any port 80,8000:8080 comment vps-panel:web",
+			},
+		},
+		{
+			name:    "ufw rejects icmp without running anything",
+			backend: &ufwBackend{},
+			rule:    ping,
+			wantErr: "ufw does not support ICMP rules",
+		},
+		{
+			name:    "netsh outbound rule uses remote address and port",
+			backend: &netshBackend{},
+			rule:    models.FirewallRule{Name: "smtp", Direction: "out", Action: "block", Protocol: "tcp", Port: "25", Source: "192.0.2.10"},
+			want: []string{
+				"netsh advfirewall firewall add rule name=smtp description=vps-panel:smtp dir=out action=block protocol=tcp localip=192.0.2.10 remoteport=25",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeRunner{commands: tt.commands, results: tt.results}
+			useFakeRunner(t, f)
+
+			err := tt.backend.AddRule(tt.rule, tt.preceding)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("AddRule: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("AddRule error = %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(f.calls, tt.want) {
+				t.Errorf("commands:\n%s\nwant:\n%s", strings.Join(f.calls, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestBackendDeleteRule(t *testing.T) {
+	ssh := models.FirewallRule{Name: "ssh", Direction: "in", Action: "allow", Protocol: "tcp", Port: "22"}
+
+	tests := []struct {
+		name     string
+		backend  Backend
+		rule     models.FirewallRule
+		commands []string
+		results  map[string]fakeResult
+		want     []string
+		wantErr  string
+	}{
+		{
+			name:     "iptables deletes by rule spec",
+			backend:  &iptablesBackend{},
+			rule:     ssh,
+			commands: []string{"iptables"},
+			want: []string{
+				"iptables -D VPS_PANEL_INPUT -p tcp --dport 22 -m comment --comment vps-panel:ssh -j ACCEPT",
+			},
+		},
+		{
+			name:    "nftables deletes by handle",
+			backend: &nftablesBackend{},
+			rule:    ssh,
+			results: map[string]fakeResult{
+				"nft -a list chain inet vps_panel input": {output: nftInputListing},
+			},
+			want: []string{
+				"nft -a list chain inet vps_panel input",
+				"nft delete rule inet vps_panel input handle 4",
+			},
+		},
+		{
+			name:    "nftables rule missing from the chain",
+			backend: &nftablesBackend{},
+			rule:    models.FirewallRule{Name: "web", Direction: "in", Action: "allow", Protocol: "tcp", Port: "80"},
+			results: map[string]fakeResult{
+				"nft -a list chain inet vps_panel input": {output: nftInputListing},
+			},
+			want:    []string{"nft -a list chain inet vps_panel input"},
+			wantErr: "rule 'web' not found in nftables",
+		},
+		{
+			name:    "nftables listing fails",
+			backend: &nftablesBackend{},
+			rule:    ssh,
+			results: map[string]fakeResult{
+				"nft -a list chain inet vps_panel input": {output: "No such file or directory", err: errExit},
+			},
+			want:    []string{"nft -a list chain inet vps_panel input"},
+			wantErr: "failed to list rules: exit status 1: No such file or directory",
+		},
+		{
+			name:    "ufw deletes by rule spec",
+			backend: &ufwBackend{},
+			rule:    ssh,
+			want:    []string{"ufw delete allow in proto tcp from any to any port 22"},
+		},
+		{
+			name:    "ufw delete fails",
+			backend: &ufwBackend{},
+			rule:    ssh,
+			results: map[string]fakeResult{
+				"ufw delete allow in proto tcp from any to any port 22": {output: "Could not delete non-existent rule", err: errExit},
+			},
+			want:    []string{"ufw delete allow in proto tcp from any to any port 22"},
+			wantErr: "failed to delete rule: exit status 1: Could not delete non-existent rule",
+		},
+		{
+			name:    "netsh deletes by name",
+			backend: &netshBackend{},
+			rule:    ssh,
+			want:    []string{"netsh advfirewall firewall delete rule name=ssh"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeRunner{commands: tt.commands, results: tt.results}
+			useFakeRunner(t, f)
+
+			err := tt.backend.DeleteRule(tt.rule)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("DeleteRule: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("DeleteRule error = %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(f.calls, tt.want) {
+				t.Errorf("commands:\n%s\nwant:\n%s", strings.Join(f.calls, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestBackendAvailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		backend  Backend
+		commands []string
+		results  map[string]fakeResult
+		want     bool
+	}{
+		{"ufw not installed", &ufwBackend{}, nil, nil, false},
+		{"ufw inactive", &ufwBackend{}, []string{"ufw"}, map[string]fakeResult{
+			"ufw status": {output: "Status: inactive\n"},
+		}, false},
+		{"ufw active", &ufwBackend{}, []string{"ufw"}, map[string]fakeResult{
+			"ufw status": {output: "Status: active\n"},
+		}, true},
+		{"nft without kernel support", &nftablesBackend{}, []string{"nft"}, map[string]fakeResult{
+			"nft list tables": {err: errExit},
+		}, false},
+		{"nft", &nftablesBackend{}, []string{"nft"}, nil, true},
+		{"iptables", &iptablesBackend{}, []string{"iptables"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeRunner(t, &fakeRunner{commands: tt.commands, results: tt.results})
+			if got := tt.backend.Available(); got != tt.want {
+				t.Errorf("Available() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackendListRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend Backend
+		results map[string]fakeResult
+		want    []LiveRule
+		wantErr string
+	}{
+		{
+			name:    "ufw keeps expressible rules",
+			backend: &ufwBackend{},
+			results: map[string]fakeResult{
+				"ufw show added": {output: `Added user rules (see 'ufw status' for running firewall):
+ufw allow 22/tcp comment 'vps-panel:ssh'
+ufw deny in proto tcp from 203.0.113.0/24 to any port 3306
+ufw limit 2222/tcp
+`},
+			},
+			want: []LiveRule{
+				{
+					Rule:    models.FirewallRule{Name: "ssh", Direction: "in", Action: "allow", Protocol: "tcp", Port: "22"},
+					Managed: true,
+					Ref:     "allow 22/tcp",
+				},
+				{
+					Rule: models.FirewallRule{Direction: "in", Action: "block", Protocol: "tcp", Port: "3306", Source: "203.0.113.0/24"},
+					Ref:  "deny in proto tcp from 203.0.113.0/24 to any port 3306",
+				},
+			},
+		},
+		{
+			name:    "ufw listing fails",
+			backend: &ufwBackend{},
+			results: map[string]fakeResult{
+				"ufw show added": {output: "ERROR: You need to be root to run this script", err: errExit},
+			},
+			wantErr: "failed to list rules: exit status 1: ERROR: You need to be root to run this script",
+		},
+		{
+			name:    "nftables skips chains that don't exist yet",
+			backend: &nftablesBackend{},
+			results: map[string]fakeResult{
+				"nft -a list chain inet vps_panel input": {output: `table inet vps_panel {
+	chain input { # handle 1
+		type filter hook input priority filter; policy accept;
+		tcp dport { 80, 443 } accept comment "vps-panel:web" # handle 5
+		iifname "lo" accept # handle 6
+	}
+}
+`},
+				"nft -a list chain inet vps_panel output": {err: errExit},
+			},
+			want: []LiveRule{
+				{
+					Rule:     models.FirewallRule{Name: "web", Direction: "in", Action: "allow", Protocol: "tcp", Port: "80,443"},
+					Managed:  true,
+					Ref:      "input:5",
+					position: 1,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeRunner(t, &fakeRunner{results: tt.results})
+
+			got, err := tt.backend.ListRules()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("ListRules: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("ListRules error = %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListRules() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackendRestoreLive(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend Backend
+		live    LiveRule
+		results map[string]fakeResult
+		want    []string
+	}{
+		{
+			name:    "iptables at its old position",
+			backend: &iptablesBackend{},
+			live:    LiveRule{Ref: "iptables|INPUT|-p tcp -m tcp --dport 8443 -j ACCEPT", position: 5},
+			want:    []string{"iptables -I INPUT 5 -p tcp -m tcp --dport 8443 -j ACCEPT"},
+		},
+		{
+			name:    "nftables after the rule now before its position",
+			backend: &nftablesBackend{},
+			live: LiveRule{
+				Rule:     models.FirewallRule{Direction: "in", Action: "allow", Protocol: "tcp", Port: "8080"},
+				Ref:      "input:9",
+				position: 3,
+			},
+			results: map[string]fakeResult{
+				"nft -a list chain inet vps_panel input": {output: nftInputListing},
+			},
+			want: []string{
+				"nft -a list chain inet vps_panel input",
+				"nft add rule inet vps_panel input position 5 tcp dport 8080 accept",
+			},
+		},
+		{
+			name:    "nftables first rule",
+			backend: &nftablesBackend{},
+			live: LiveRule{
+				Rule:     models.FirewallRule{Name: "ssh", Direction: "in", Action: "allow", Protocol: "tcp", Port: "22"},
+				Managed:  true,
+				Ref:      "input:4",
+				position: 1,
+			},
+			want: []string{
+				"nft -a list chain inet vps_panel input",
+				`nft insert rule inet vps_panel input tcp dport 22 accept comment "vps-panel:ssh"`,
+			},
+		},
+		{
+			name:    "ufw keeps the panel tag",
+			backend: &ufwBackend{},
+			live: LiveRule{
+				Rule:    models.FirewallRule{Name: "ssh"},
+				Managed: true,
+				Ref:     "allow 22/tcp",
+			},
+			want: []string{"ufw allow 22/tcp comment vps-panel:ssh"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeRunner{results: tt.results}
+			useFakeRunner(t, f)
+
+			if err := tt.backend.RestoreLive(tt.live); err != nil {
+				t.Fatalf("RestoreLive: %v", err)
+			}
+			if !reflect.DeepEqual(f.calls, tt.want) {
+				t.Errorf("commands:\n%s\nwant:\n%s", strings.Join(f.calls, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
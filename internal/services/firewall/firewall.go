@@ -2,68 +2,179 @@ package firewall
 
 import (
 	"fmt"
-	"os/exec"
-	"runtime"
+	"log"
+	"strings"
+	"sync"
 
+	"vps-panel/internal/config"
 	"vps-panel/internal/database"
 	"vps-panel/internal/models"
 )
 
-// GetRules returns list of firewall rules from DB
+var (
+	activeBackend Backend
+	mu            sync.Mutex
+)
+
+// Init detects the firewall backend available on this host and reconciles
+// the panel rules with the live ruleset
+func Init() {
+	activeBackend = detectBackend()
+	if activeBackend == nil {
+		log.Println("🔥 Firewall: no supported backend found")
+		return
+	}
+	log.Printf("🔥 Firewall backend: %s", activeBackend.Name())
+
+	reconcileOnBoot(config.AppConfig.Firewall.ReconcileOnBoot)
+}
+
+func reconcileOnBoot(mode string) {
+	if mode == "off" {
+		return
+	}
+
+	var drift *Drift
+	if mode == "report" {
+		d, err := DetectDrift()
+		if err != nil {
+			log.Printf("Firewall: drift check failed: %v", err)
+			return
+		}
+		drift = d
+	} else {
+		// The rules were confirmed when they were made, so nothing is kept
+		// pending here
+		mu.Lock()
+		result, err := reconcile(&PendingChange{}, ActionReapply, nil, func(models.FirewallRule) error { return nil })
+		mu.Unlock()
+		if err != nil {
+			log.Printf("Firewall: reconcile failed: %v", err)
+			return
+		}
+		if len(result.Applied) > 0 {
+			log.Printf("🔥 Firewall: re-applied %d missing rule(s)", len(result.Applied))
+		}
+		for _, e := range result.Errors {
+			log.Printf("Firewall: %s", e)
+		}
+		drift = result.Drift
+	}
+
+	if !drift.InSync {
+		log.Printf("Firewall: drift detected (%d missing, %d stray, %d unmanaged)",
+			len(drift.Missing), len(drift.Stray), len(drift.Unmanaged))
+	}
+}
+
+// BackendName returns the name of the active backend, or "none"
+func BackendName() string {
+	if activeBackend == nil {
+		return "none"
+	}
+	return activeBackend.Name()
+}
+
+// GetBackends reports every backend known for this OS and which one is active
+func GetBackends() []BackendInfo {
+	var infos []BackendInfo
+	for _, b := range allBackends() {
+		infos = append(infos, BackendInfo{
+			Name:      b.Name(),
+			Available: b.Available(),
+			Active:    activeBackend != nil && activeBackend.Name() == b.Name(),
+		})
+	}
+	return infos
+}
+
+// GetRules returns list of firewall rules from DB in evaluation order
 func GetRules() ([]models.FirewallRule, error) {
 	var rules []models.FirewallRule
-	err := database.DB.Order("created_at desc").Find(&rules).Error
+	err := database.DB.Order("priority asc, id asc").Find(&rules).Error
 	return rules, err
 }
 
-// AddRule adds a firewall rule
-func AddRule(name, port, protocol, action string) error {
-	if runtime.GOOS != "windows" {
-		return fmt.Errorf("platform not supported")
+// AddRule applies a validated firewall rule and records it
+func AddRule(rule models.FirewallRule) error {
+	mu.Lock()
+	defer mu.Unlock()
+	return addRule(rule)
+}
+
+func addRule(rule models.FirewallRule) error {
+	if activeBackend == nil {
+		return fmt.Errorf("no supported firewall backend found")
 	}
 
 	// Check if exists in DB
 	var count int64
-	database.DB.Model(&models.FirewallRule{}).Where("name = ?", name).Count(&count)
+	database.DB.Model(&models.FirewallRule{}).Where("name = ?", rule.Name).Count(&count)
 	if count > 0 {
-		return fmt.Errorf("rule with name '%s' already exists", name)
+		return fmt.Errorf("rule with name '%s' already exists", rule.Name)
 	}
 
-	// netsh advfirewall firewall add rule name="Open Port 80" dir=in action=allow protocol=TCP localport=80
-	cmd := exec.Command("netsh", "advfirewall", "firewall", "add", "rule",
-		fmt.Sprintf("name=%s", name),
-		"dir=in",
-		fmt.Sprintf("action=%s", action),
-		fmt.Sprintf("protocol=%s", protocol),
-		fmt.Sprintf("localport=%s", port),
-	)
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to add rule: %v", err)
+	preceding, err := precedingRules(rule)
+	if err != nil {
+		return err
 	}
 
-	// Save to DB
-	rule := models.FirewallRule{
-		Name:     name,
-		Port:     port,
-		Protocol: protocol,
-		Action:   action,
+	if err := activeBackend.AddRule(rule, preceding); err != nil {
+		return err
 	}
+
+	// Save to DB
 	return database.DB.Create(&rule).Error
 }
 
+// precedingRules returns the managed rules evaluated before the given one.
+// Rules of equal priority keep their creation order.
+func precedingRules(rule models.FirewallRule) ([]models.FirewallRule, error) {
+	query := database.DB.Where("direction = ?", rule.Direction)
+	if rule.ID == 0 {
+		query = query.Where("priority <= ?", rule.Priority)
+	} else {
+		query = query.Where("priority < ? OR (priority = ? AND id < ?)", rule.Priority, rule.Priority, rule.ID)
+	}
+
+	var rules []models.FirewallRule
+	err := query.Order("priority asc, id asc").Find(&rules).Error
+	return rules, err
+}
+
 // DeleteRule deletes a firewall rule
 func DeleteRule(name string) error {
-	if runtime.GOOS != "windows" {
-		return fmt.Errorf("platform not supported")
+	mu.Lock()
+	defer mu.Unlock()
+	return deleteRule(name)
+}
+
+func deleteRule(name string) error {
+	if activeBackend == nil {
+		return fmt.Errorf("no supported firewall backend found")
 	}
 
-	// netsh advfirewall firewall delete rule name="Open Port 80"
-	cmd := exec.Command("netsh", "advfirewall", "firewall", "delete", "rule", fmt.Sprintf("name=%s", name))
-	if err := cmd.Run(); err != nil {
-		// Even if it fails (e.g. not found in netsh), we should remove from DB if it exists there
-		// But maybe better to return error? Let's proceed to delete from DB anyway to keep sync.
+	var rule models.FirewallRule
+	if err := database.DB.Where("name = ?", name).First(&rule).Error; err != nil {
+		return fmt.Errorf("rule '%s' not found", name)
 	}
+	// Rules created before validation existed may use upper-case protocols
+	rule.Protocol = strings.ToLower(rule.Protocol)
 
-	return database.DB.Where("name = ?", name).Delete(&models.FirewallRule{}).Error
+	if err := activeBackend.DeleteRule(rule); err != nil {
+		// Even if it fails (e.g. not found in the OS), we should remove from DB if it exists there
+		// to keep sync.
+		log.Printf("Firewall: %v", err)
+	}
+
+	// Hard delete so the unique name can be reused
+	return database.DB.Unscoped().Where("name = ?", name).Delete(&models.FirewallRule{}).Error
+}
+
+func isAllow(action string) bool {
+	switch strings.ToLower(action) {
+	case "allow", "accept":
+		return true
+	}
+	return false
 }
@@ -0,0 +1,280 @@
+package firewall
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"vps-panel/internal/models"
+)
+
+// iptablesBackend manages rules in dedicated VPS_PANEL_INPUT/OUTPUT chains via
+// iptables and, for IPv6, ip6tables
+type iptablesBackend struct{}
+
+func (b *iptablesBackend) Name() string {
+	return "iptables"
+}
+
+func (b *iptablesBackend) Available() bool {
+	return hasCommand("iptables")
+}
+
+func iptablesChain(direction string) (chain, parent string) {
+	if direction == "out" {
+		return "VPS_PANEL_OUTPUT", "OUTPUT"
+	}
+	return "VPS_PANEL_INPUT", "INPUT"
+}
+
+type ipTool struct {
+	family  string
+	command string
+}
+
+// tools returns the commands a rule must be applied with, by address family
+func (b *iptablesBackend) tools(rule models.FirewallRule) []ipTool {
+	var tools []ipTool
+	family := ruleFamily(rule)
+	if family != "ipv6" {
+		tools = append(tools, ipTool{"ipv4", "iptables"})
+	}
+	if family != "ipv4" && hasCommand("ip6tables") {
+		tools = append(tools, ipTool{"ipv6", "ip6tables"})
+	}
+	return tools
+}
+
+// ensureChain creates the panel chain and the jump to it if they don't exist
+func (b *iptablesBackend) ensureChain(tool, chain, parent string) error {
+	if _, err := runner.Run(tool, "-n", "-L", chain); err != nil {
+		if output, err := runner.Run(tool, "-N", chain); err != nil {
+			return fmt.Errorf("failed to create %s chain: %v: %s", tool, err, output)
+		}
+	}
+	if _, err := runner.Run(tool, "-C", parent, "-j", chain); err != nil {
+		if output, err := runner.Run(tool, "-I", parent, "-j", chain); err != nil {
+			return fmt.Errorf("failed to hook %s chain: %v: %s", tool, err, output)
+		}
+	}
+	return nil
+}
+
+// ruleSpec builds the match/target part shared by -I and -D
+func (b *iptablesBackend) ruleSpec(rule models.FirewallRule, family string) []string {
+	var spec []string
+
+	if rule.Source != "" {
+		spec = append(spec, "-s", rule.Source)
+	}
+	if rule.Destination != "" {
+		spec = append(spec, "-d", rule.Destination)
+	}
+
+	switch rule.Protocol {
+	case "tcp", "udp":
+		spec = append(spec, "-p", rule.Protocol)
+		if ports := strings.Split(rule.Port, ","); len(ports) > 1 {
+			for i, p := range ports {
+				ports[i] = strings.Replace(p, "-", ":", 1)
+			}
+			spec = append(spec, "-m", "multiport", "--dports", strings.Join(ports, ","))
+		} else if rule.Port != "" {
+			spec = append(spec, "--dport", strings.Replace(rule.Port, "-", ":", 1))
+		}
+	case "icmp":
+		if family == "ipv6" {
+			spec = append(spec, "-p", "ipv6-icmp")
+		} else {
+			spec = append(spec, "-p", "icmp")
+		}
+	}
+
+	target := "DROP"
+	if isAllow(rule.Action) {
+		target = "ACCEPT"
+	}
+	return append(spec, "-m", "comment", "--comment", ruleComment+rule.Name, "-j", target)
+}
+
+func (b *iptablesBackend) AddRule(rule models.FirewallRule, preceding []models.FirewallRule) error {
+	chain, parent := iptablesChain(rule.Direction)
+
+	for _, tool := range b.tools(rule) {
+		if err := b.ensureChain(tool.command, chain, parent); err != nil {
+			return err
+		}
+
+		// Only rules that were applied with this tool occupy positions in its chain
+		position := 1
+		for _, p := range preceding {
+			if f := ruleFamily(p); f == "" || f == tool.family {
+				position++
+			}
+		}
+
+		args := append([]string{"-I", chain, strconv.Itoa(position)}, b.ruleSpec(rule, tool.family)...)
+		output, err := runner.Run(tool.command, args...)
+		if err != nil {
+			return fmt.Errorf("failed to add rule: %v: %s", err, output)
+		}
+	}
+	return nil
+}
+
+func (b *iptablesBackend) DeleteRule(rule models.FirewallRule) error {
+	chain, _ := iptablesChain(rule.Direction)
+
+	for _, tool := range b.tools(rule) {
+		args := append([]string{"-D", chain}, b.ruleSpec(rule, tool.family)...)
+		output, err := runner.Run(tool.command, args...)
+		if err != nil {
+			return fmt.Errorf("failed to delete rule: %v: %s", err, output)
+		}
+	}
+	return nil
+}
+
+// ListRules reads the panel chains and the built-in INPUT/OUTPUT chains
+func (b *iptablesBackend) ListRules() ([]LiveRule, error) {
+	var rules []LiveRule
+	for _, tool := range b.tools(models.FirewallRule{}) {
+		for _, direction := range []string{"in", "out"} {
+			chain, parent := iptablesChain(direction)
+			for _, c := range []string{chain, parent} {
+				output, err := runner.Run(tool.command, "-S", c)
+				if err != nil {
+					continue
+				}
+				// Rules the parser skips still take up positions
+				position := 0
+				for _, line := range strings.Split(string(output), "\n") {
+					line = strings.TrimSpace(line)
+					if !strings.HasPrefix(line, "-A ") {
+						continue
+					}
+					position++
+					if live, ok := parseIptablesRule(tool.command, line, direction); ok {
+						live.Builtin = c == parent
+						live.position = position
+						rules = append(rules, live)
+					}
+				}
+			}
+		}
+	}
+	return rules, nil
+}
+
+func (b *iptablesBackend) DeleteLive(live LiveRule) error {
+	parts := strings.SplitN(live.Ref, "|", 3)
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid iptables rule reference '%s'", live.Ref)
+	}
+
+	args := append([]string{"-D", parts[1]}, splitArgs(parts[2])...)
+	output, err := runner.Run(parts[0], args...)
+	if err != nil {
+		return fmt.Errorf("failed to delete rule: %v: %s", err, output)
+	}
+	return nil
+}
+
+// RestoreLive re-inserts a deleted rule at the position it was listed at
+func (b *iptablesBackend) RestoreLive(live LiveRule) error {
+	parts := strings.SplitN(live.Ref, "|", 3)
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid iptables rule reference '%s'", live.Ref)
+	}
+
+	args := []string{"-A", parts[1]}
+	if live.position > 0 {
+		args = []string{"-I", parts[1], strconv.Itoa(live.position)}
+	}
+	output, err := runner.Run(parts[0], append(args, splitArgs(parts[2])...)...)
+	if err != nil {
+		return fmt.Errorf("failed to restore rule: %v: %s", err, output)
+	}
+	return nil
+}
+
+// parseIptablesRule reads a "-A CHAIN ..." line from "iptables -S" output.
+// Rules using matches or targets the panel can't express are skipped.
+func parseIptablesRule(tool, line, direction string) (LiveRule, bool) {
+	tokens := splitArgs(line)
+	if len(tokens) < 2 || tokens[0] != "-A" {
+		return LiveRule{}, false
+	}
+
+	rule := models.FirewallRule{Direction: direction, Protocol: "any"}
+	live := LiveRule{}
+
+	for i := 2; i < len(tokens); i++ {
+		if i+1 >= len(tokens) {
+			return LiveRule{}, false
+		}
+		value := tokens[i+1]
+
+		switch tokens[i] {
+		case "-s":
+			rule.Source, _ = normalizeAddress(value)
+		case "-d":
+			rule.Destination, _ = normalizeAddress(value)
+		case "-p":
+			switch value {
+			case "tcp", "udp":
+				rule.Protocol = value
+			case "icmp", "ipv6-icmp", "icmpv6":
+				rule.Protocol = "icmp"
+			case "all":
+			default:
+				return LiveRule{}, false
+			}
+		case "-m":
+			switch value {
+			case "tcp", "udp", "multiport", "comment":
+			default:
+				return LiveRule{}, false
+			}
+		case "--dport", "--dports":
+			rule.Port = strings.ReplaceAll(value, ":", "-")
+		case "--comment":
+			if name, ok := managedName(value); ok {
+				rule.Name = name
+				live.Managed = true
+			}
+		case "-j":
+			switch value {
+			case "ACCEPT":
+				rule.Action = "allow"
+			case "DROP", "REJECT":
+				rule.Action = "block"
+			default:
+				return LiveRule{}, false
+			}
+		default:
+			return LiveRule{}, false
+		}
+		i++
+	}
+
+	if rule.Action == "" {
+		return LiveRule{}, false
+	}
+
+	live.Rule = rule
+	live.Ref = tool + "|" + tokens[1] + "|" + strings.Join(quoteArgs(tokens[2:]), " ")
+	return live, true
+}
+
+// quoteArgs quotes arguments containing spaces so splitArgs can restore them
+func quoteArgs(args []string) []string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if strings.ContainsAny(arg, " \t") {
+			arg = "\"" + arg + "\""
+		}
+		quoted[i] = arg
+	}
+	return quoted
+}
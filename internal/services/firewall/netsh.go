@@ -0,0 +1,165 @@
+package firewall
+
+import (
+	"fmt"
+	"strings"
+
+	"vps-panel/internal/models"
+)
+
+// netshBackend manages Windows Firewall rules via netsh. Windows evaluates
+// block rules before allow rules, so priority is not applied here.
+type netshBackend struct{}
+
+func (b *netshBackend) Name() string {
+	return "netsh"
+}
+
+func (b *netshBackend) Available() bool {
+	return hasCommand("netsh")
+}
+
+func (b *netshBackend) ruleArgs(rule models.FirewallRule) []string {
+	args := []string{
+		fmt.Sprintf("name=%s", rule.Name),
+		fmt.Sprintf("description=%s%s", ruleComment, rule.Name),
+		fmt.Sprintf("dir=%s", rule.Direction),
+	}
+
+	action := "block"
+	if isAllow(rule.Action) {
+		action = "allow"
+	}
+	args = append(args, fmt.Sprintf("action=%s", action))
+
+	switch rule.Protocol {
+	case "icmp":
+		if ruleFamily(rule) == "ipv6" {
+			args = append(args, "protocol=icmpv6")
+		} else {
+			args = append(args, "protocol=icmpv4")
+		}
+	default:
+		args = append(args, fmt.Sprintf("protocol=%s", rule.Protocol))
+	}
+
+	// For inbound rules the remote side is the source, for outbound the destination
+	local, remote := rule.Destination, rule.Source
+	portKey := "localport"
+	if rule.Direction == "out" {
+		local, remote = rule.Source, rule.Destination
+		portKey = "remoteport"
+	}
+	if local != "" {
+		args = append(args, fmt.Sprintf("localip=%s", local))
+	}
+	if remote != "" {
+		args = append(args, fmt.Sprintf("remoteip=%s", remote))
+	}
+	if rule.Port != "" {
+		args = append(args, fmt.Sprintf("%s=%s", portKey, rule.Port))
+	}
+
+	return args
+}
+
+func (b *netshBackend) AddRule(rule models.FirewallRule, preceding []models.FirewallRule) error {
+	// netsh advfirewall firewall add rule name="Open Port 80" dir=in action=allow protocol=TCP localport=80
+	args := append([]string{"advfirewall", "firewall", "add", "rule"}, b.ruleArgs(rule)...)
+	output, err := runner.Run("netsh", args...)
+	if err != nil {
+		return fmt.Errorf("failed to add rule: %v: %s", err, output)
+	}
+	return nil
+}
+
+func (b *netshBackend) DeleteRule(rule models.FirewallRule) error {
+	// netsh advfirewall firewall delete rule name="Open Port 80"
+	output, err := runner.Run("netsh", "advfirewall", "firewall", "delete", "rule", fmt.Sprintf("name=%s", rule.Name))
+	if err != nil {
+		return fmt.Errorf("failed to delete rule: %v: %s", err, output)
+	}
+	return nil
+}
+
+// ListRules reads panel-tagged rules from "show rule name=all verbose". Windows
+// ships hundreds of built-in rules, so untagged rules are not reported.
+func (b *netshBackend) ListRules() ([]LiveRule, error) {
+	output, err := runner.Run("netsh", "advfirewall", "firewall", "show", "rule", "name=all", "verbose")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules: %v: %s", err, output)
+	}
+
+	var rules []LiveRule
+	fields := map[string]string{}
+	flush := func() {
+		if live, ok := parseNetshRule(fields); ok {
+			rules = append(rules, live)
+		}
+		fields = map[string]string{}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(string(output), "\r", ""), "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if key == "Rule Name" {
+			flush()
+		}
+		fields[key] = strings.TrimSpace(value)
+	}
+	flush()
+
+	return rules, nil
+}
+
+func (b *netshBackend) DeleteLive(live LiveRule) error {
+	return b.DeleteRule(models.FirewallRule{Name: live.Ref})
+}
+
+// RestoreLive re-adds a deleted rule; Windows doesn't order rules
+func (b *netshBackend) RestoreLive(live LiveRule) error {
+	return b.AddRule(live.Rule, nil)
+}
+
+func parseNetshRule(fields map[string]string) (LiveRule, bool) {
+	name, ok := managedName(fields["Description"])
+	if !ok {
+		return LiveRule{}, false
+	}
+
+	rule := models.FirewallRule{
+		Name:      name,
+		Direction: strings.ToLower(fields["Direction"]),
+		Protocol:  strings.ToLower(fields["Protocol"]),
+		Action:    strings.ToLower(fields["Action"]),
+	}
+	if strings.HasPrefix(rule.Protocol, "icmp") {
+		rule.Protocol = "icmp"
+	}
+
+	local, remote, port := fields["LocalIP"], fields["RemoteIP"], fields["LocalPort"]
+	if rule.Direction == "out" {
+		port = fields["RemotePort"]
+	}
+	if strings.EqualFold(port, "any") {
+		port = ""
+	}
+	rule.Port = port
+
+	for _, addr := range []*string{&local, &remote} {
+		if strings.EqualFold(*addr, "any") {
+			*addr = ""
+		}
+		*addr, _ = normalizeAddress(*addr)
+	}
+	if rule.Direction == "out" {
+		rule.Source, rule.Destination = local, remote
+	} else {
+		rule.Source, rule.Destination = remote, local
+	}
+
+	return LiveRule{Rule: rule, Managed: true, Ref: fields["Rule Name"]}, true
+}
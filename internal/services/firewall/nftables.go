@@ -0,0 +1,366 @@
+package firewall
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"vps-panel/internal/models"
+)
+
+const nftTable = "vps_panel"
+
+var nftHandleRe = regexp.MustCompile(`# handle (\d+)`)
+
+// nftablesBackend manages rules in a dedicated "inet vps_panel" table with
+// one chain per direction, so rule order inside the chains is ours to control
+type nftablesBackend struct{}
+
+func (b *nftablesBackend) Name() string {
+	return "nftables"
+}
+
+func (b *nftablesBackend) Available() bool {
+	if !hasCommand("nft") {
+		return false
+	}
+	_, err := runner.Run("nft", "list", "tables")
+	return err == nil
+}
+
+func nftChain(direction string) string {
+	if direction == "out" {
+		return "output"
+	}
+	return "input"
+}
+
+// ensureChain creates the panel table and direction chain if they don't exist
+func (b *nftablesBackend) ensureChain(chain string) error {
+	if output, err := runner.Run("nft", "add", "table", "inet", nftTable); err != nil {
+		return fmt.Errorf("failed to create nftables table: %v: %s", err, output)
+	}
+	output, err := runner.Run("nft", "add", "chain", "inet", nftTable, chain,
+		"{", "type", "filter", "hook", chain, "priority", "0", ";", "policy", "accept", ";", "}")
+	if err != nil {
+		return fmt.Errorf("failed to create nftables chain: %v: %s", err, output)
+	}
+	return nil
+}
+
+// ruleExpr translates a rule into nft match expressions and verdict
+func (b *nftablesBackend) ruleExpr(rule models.FirewallRule) []string {
+	var expr []string
+
+	if rule.Source != "" {
+		expr = append(expr, nftAddrFamily(rule.Source), "saddr", rule.Source)
+	}
+	if rule.Destination != "" {
+		expr = append(expr, nftAddrFamily(rule.Destination), "daddr", rule.Destination)
+	}
+
+	switch rule.Protocol {
+	case "tcp", "udp":
+		if rule.Port != "" {
+			expr = append(expr, rule.Protocol, "dport", nftSet(strings.Split(rule.Port, ",")))
+		} else {
+			expr = append(expr, "meta", "l4proto", rule.Protocol)
+		}
+	case "icmp":
+		switch ruleFamily(rule) {
+		case "ipv4":
+			expr = append(expr, "meta", "l4proto", "icmp")
+		case "ipv6":
+			expr = append(expr, "meta", "l4proto", "ipv6-icmp")
+		default:
+			expr = append(expr, "meta", "l4proto", nftSet([]string{"icmp", "ipv6-icmp"}))
+		}
+	}
+
+	verdict := "drop"
+	if isAllow(rule.Action) {
+		verdict = "accept"
+	}
+	expr = append(expr, verdict)
+	// Untagged rules are only re-created when restoring one that was deleted
+	if rule.Name != "" {
+		expr = append(expr, "comment", fmt.Sprintf("\"%s%s\"", ruleComment, rule.Name))
+	}
+	return expr
+}
+
+func (b *nftablesBackend) AddRule(rule models.FirewallRule, preceding []models.FirewallRule) error {
+	chain := nftChain(rule.Direction)
+	if err := b.ensureChain(chain); err != nil {
+		return err
+	}
+
+	// Place the rule after the last preceding rule actually in the chain;
+	// after drift the stored rules don't match the live positions
+	output, err := runner.Run("nft", "-a", "list", "chain", "inet", nftTable, chain)
+	if err != nil {
+		return fmt.Errorf("failed to list rules: %v: %s", err, output)
+	}
+	before := map[string]bool{}
+	for _, p := range preceding {
+		before[p.Name] = true
+	}
+	after := ""
+	for _, r := range nftChainRules(string(output)) {
+		if r.name != "" && before[r.name] {
+			after = r.handle
+		}
+	}
+
+	// "insert" prepends; "add ... position H" places the rule after handle H
+	args := []string{"insert", "rule", "inet", nftTable, chain}
+	if after != "" {
+		args = []string{"add", "rule", "inet", nftTable, chain, "position", after}
+	}
+
+	output, err = runner.Run("nft", append(args, b.ruleExpr(rule)...)...)
+	if err != nil {
+		return fmt.Errorf("failed to add rule: %v: %s", err, output)
+	}
+	return nil
+}
+
+func (b *nftablesBackend) DeleteRule(rule models.FirewallRule) error {
+	chain := nftChain(rule.Direction)
+	output, err := runner.Run("nft", "-a", "list", "chain", "inet", nftTable, chain)
+	if err != nil {
+		return fmt.Errorf("failed to list rules: %v: %s", err, output)
+	}
+
+	handle := findNftHandle(string(output), rule.Name)
+	if handle == "" {
+		return fmt.Errorf("rule '%s' not found in nftables", rule.Name)
+	}
+
+	output, err = runner.Run("nft", "delete", "rule", "inet", nftTable, chain, "handle", handle)
+	if err != nil {
+		return fmt.Errorf("failed to delete rule: %v: %s", err, output)
+	}
+	return nil
+}
+
+// nftListedRule is a rule line of an "nft -a list chain" listing
+type nftListedRule struct {
+	handle string
+	name   string // Panel rule name, empty for untagged rules
+}
+
+// nftChainRules returns the rules of a chain listing in chain order
+func nftChainRules(listing string) []nftListedRule {
+	tag := "comment \"" + ruleComment
+	var rules []nftListedRule
+	for _, line := range strings.Split(listing, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "table ") || strings.HasPrefix(line, "chain ") {
+			continue
+		}
+		m := nftHandleRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		r := nftListedRule{handle: m[1]}
+		if idx := strings.Index(line, tag); idx >= 0 {
+			name := line[idx+len(tag):]
+			r.name, _, _ = strings.Cut(name, "\"")
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// findNftHandle returns the handle of the rule tagged with the given name
+func findNftHandle(listing, name string) string {
+	for _, r := range nftChainRules(listing) {
+		if r.name == name {
+			return r.handle
+		}
+	}
+	return ""
+}
+
+func nftAddrFamily(cidr string) string {
+	if addressFamily(cidr) == "ipv6" {
+		return "ip6"
+	}
+	return "ip"
+}
+
+// nftSet renders a single value as-is and several values as an anonymous set
+func nftSet(items []string) string {
+	if len(items) == 1 {
+		return items[0]
+	}
+	return "{ " + strings.Join(items, ", ") + " }"
+}
+
+func (b *nftablesBackend) ListRules() ([]LiveRule, error) {
+	var rules []LiveRule
+	for _, direction := range []string{"in", "out"} {
+		chain := nftChain(direction)
+		output, err := runner.Run("nft", "-a", "list", "chain", "inet", nftTable, chain)
+		if err != nil {
+			// The chain is only created with the first rule
+			continue
+		}
+
+		positions := map[string]int{}
+		for i, r := range nftChainRules(string(output)) {
+			positions[r.handle] = i + 1
+		}
+		for _, line := range strings.Split(string(output), "\n") {
+			if live, ok := parseNftRule(strings.TrimSpace(line), direction); ok {
+				live.position = positions[strings.TrimPrefix(live.Ref, chain+":")]
+				rules = append(rules, live)
+			}
+		}
+	}
+	return rules, nil
+}
+
+func (b *nftablesBackend) DeleteLive(live LiveRule) error {
+	parts := strings.SplitN(live.Ref, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid nftables rule reference '%s'", live.Ref)
+	}
+
+	output, err := runner.Run("nft", "delete", "rule", "inet", nftTable, parts[0], "handle", parts[1])
+	if err != nil {
+		return fmt.Errorf("failed to delete rule: %v: %s", err, output)
+	}
+	return nil
+}
+
+// RestoreLive re-adds a deleted rule after the rule that now holds the
+// position before it
+func (b *nftablesBackend) RestoreLive(live LiveRule) error {
+	chain, _, found := strings.Cut(live.Ref, ":")
+	if !found {
+		return fmt.Errorf("invalid nftables rule reference '%s'", live.Ref)
+	}
+	output, err := runner.Run("nft", "-a", "list", "chain", "inet", nftTable, chain)
+	if err != nil {
+		return fmt.Errorf("failed to list rules: %v: %s", err, output)
+	}
+
+	args := []string{"insert", "rule", "inet", nftTable, chain}
+	if rules := nftChainRules(string(output)); live.position > 1 && len(rules) > 0 {
+		args = []string{"add", "rule", "inet", nftTable, chain}
+		if live.position-2 < len(rules) {
+			args = append(args, "position", rules[live.position-2].handle)
+		}
+	}
+
+	output, err = runner.Run("nft", append(args, b.ruleExpr(live.Rule)...)...)
+	if err != nil {
+		return fmt.Errorf("failed to restore rule: %v: %s", err, output)
+	}
+	return nil
+}
+
+// parseNftRule reads a rule line from "nft -a list chain" output. Rules using
+// matches the panel can't express are skipped.
+func parseNftRule(line, direction string) (LiveRule, bool) {
+	if !strings.Contains(line, "# handle") || strings.HasPrefix(line, "type ") {
+		return LiveRule{}, false
+	}
+
+	tokens := nftTokens(line)
+	rule := models.FirewallRule{Direction: direction, Protocol: "any"}
+	live := LiveRule{}
+	var handle string
+
+	for i := 0; i < len(tokens); i++ {
+		next := ""
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+		}
+
+		switch tokens[i] {
+		case "ip", "ip6":
+			if i+2 >= len(tokens) {
+				return LiveRule{}, false
+			}
+			switch next {
+			case "saddr":
+				rule.Source, _ = normalizeAddress(tokens[i+2])
+			case "daddr":
+				rule.Destination, _ = normalizeAddress(tokens[i+2])
+			default:
+				return LiveRule{}, false
+			}
+			i += 2
+		case "tcp", "udp":
+			if next != "dport" || i+2 >= len(tokens) {
+				return LiveRule{}, false
+			}
+			rule.Protocol = tokens[i]
+			rule.Port = tokens[i+2]
+			i += 2
+		case "meta":
+			if next != "l4proto" || i+2 >= len(tokens) {
+				return LiveRule{}, false
+			}
+			switch proto := tokens[i+2]; proto {
+			case "tcp", "udp":
+				rule.Protocol = proto
+			case "icmp", "ipv6-icmp", "icmp,ipv6-icmp":
+				rule.Protocol = "icmp"
+			default:
+				return LiveRule{}, false
+			}
+			i += 2
+		case "accept":
+			rule.Action = "allow"
+		case "drop", "reject":
+			rule.Action = "block"
+		case "comment":
+			if name, ok := managedName(next); ok {
+				rule.Name = name
+				live.Managed = true
+			}
+			i++
+		case "#":
+			if next == "handle" && i+2 < len(tokens) {
+				handle = tokens[i+2]
+			}
+			i = len(tokens)
+		default:
+			return LiveRule{}, false
+		}
+	}
+
+	if rule.Action == "" || handle == "" {
+		return LiveRule{}, false
+	}
+
+	live.Rule = rule
+	live.Ref = nftChain(direction) + ":" + handle
+	return live, true
+}
+
+// nftTokens splits an nft rule, collapsing "{ a, b }" sets into "a,b"
+func nftTokens(line string) []string {
+	var tokens []string
+	var set []string
+	inSet := false
+
+	for _, tok := range splitArgs(line) {
+		switch {
+		case tok == "{":
+			inSet, set = true, nil
+		case tok == "}":
+			inSet = false
+			tokens = append(tokens, strings.Join(set, ","))
+		case inSet:
+			set = append(set, strings.TrimSuffix(tok, ","))
+		default:
+			tokens = append(tokens, tok)
+		}
+	}
+	return tokens
+}
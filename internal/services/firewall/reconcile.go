@@ -0,0 +1,301 @@
+package firewall
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+
+	"vps-panel/internal/database"
+	"vps-panel/internal/models"
+)
+
+// Reconcile actions
+const (
+	ActionReapply = "reapply" // Re-apply panel rules missing from the OS
+	ActionAdopt   = "adopt"   // Record stray, or selected unmanaged, OS rules in the panel
+	ActionDelete  = "delete"  // Remove stray rules from the OS
+)
+
+// Drift is the difference between panel rules and the live OS ruleset
+type Drift struct {
+	Backend   string                `json:"backend"`
+	InSync    bool                  `json:"in_sync"`
+	Missing   []models.FirewallRule `json:"missing"`   // In the panel but not in the OS
+	Stray     []LiveRule            `json:"stray"`     // Tagged by the panel but not in the DB
+	Unmanaged []LiveRule            `json:"unmanaged"` // Created outside the panel
+}
+
+// ReconcileResult reports what a reconcile run changed
+type ReconcileResult struct {
+	Action  string         `json:"action"`
+	Applied []string       `json:"applied"`
+	Errors  []string       `json:"errors,omitempty"`
+	Drift   *Drift         `json:"drift"`
+	Pending *PendingChange `json:"pending"` // Set when the changes await confirmation
+}
+
+// DetectDrift compares the DB rules with the live ruleset
+func DetectDrift() (*Drift, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return detectDrift()
+}
+
+func detectDrift() (*Drift, error) {
+	if activeBackend == nil {
+		return nil, fmt.Errorf("no supported firewall backend found")
+	}
+
+	rules, err := GetRules()
+	if err != nil {
+		return nil, err
+	}
+	live, err := activeBackend.ListRules()
+	if err != nil {
+		return nil, err
+	}
+
+	drift := &Drift{
+		Backend:   activeBackend.Name(),
+		Missing:   []models.FirewallRule{},
+		Stray:     []LiveRule{},
+		Unmanaged: []LiveRule{},
+	}
+
+	known := map[string]bool{}
+	for _, rule := range rules {
+		known[rule.Name] = true
+	}
+
+	present := map[string]bool{}
+	for _, l := range live {
+		switch {
+		case !l.Managed:
+			drift.Unmanaged = append(drift.Unmanaged, l)
+		case known[l.Rule.Name]:
+			present[l.Rule.Name] = true
+		default:
+			drift.Stray = append(drift.Stray, l)
+		}
+	}
+
+	for _, rule := range rules {
+		if !present[rule.Name] {
+			drift.Missing = append(drift.Missing, rule)
+		}
+	}
+
+	drift.InSync = len(drift.Missing) == 0 && len(drift.Stray) == 0 && len(drift.Unmanaged) == 0
+	return drift, nil
+}
+
+// Reconcile applies one action to the drift items identified by refs: rule
+// names for reapply, live rule refs for adopt and delete. Without refs,
+// reapply covers all missing rules and adopt and delete cover stray rules;
+// unmanaged rules are only touched when selected. Rules that would lock out
+// clientIP are skipped unless forced, and the changes roll back unless
+// confirmed like any other firewall change.
+func Reconcile(action string, refs []string, clientIP string, force bool) (*ReconcileResult, error) {
+	switch action {
+	case ActionReapply, ActionAdopt, ActionDelete:
+	default:
+		return nil, fmt.Errorf("invalid action '%s' (use %s, %s or %s)", action, ActionReapply, ActionAdopt, ActionDelete)
+	}
+
+	check := func(rule models.FirewallRule) error {
+		if force {
+			return nil
+		}
+		if err := CheckLockout(rule, clientIP); err != nil {
+			return fmt.Errorf("%v (set force to apply anyway)", err)
+		}
+		return nil
+	}
+
+	var result *ReconcileResult
+	p, err := applyWithConfirm(func(p *PendingChange) error {
+		var err error
+		result, err = reconcile(p, action, refs, check)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Pending = p
+	return result, nil
+}
+
+// reconcile does the work of Reconcile, recording undo steps in p. The
+// caller must hold mu.
+func reconcile(p *PendingChange, action string, refs []string, check func(models.FirewallRule) error) (*ReconcileResult, error) {
+	drift, err := detectDrift()
+	if err != nil {
+		return nil, err
+	}
+
+	selected := func(ref string) bool {
+		if len(refs) == 0 {
+			return true
+		}
+		for _, r := range refs {
+			if r == ref {
+				return true
+			}
+		}
+		return false
+	}
+
+	result := &ReconcileResult{Action: action, Applied: []string{}}
+	record := func(ref string, err error) {
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", ref, err))
+		} else {
+			result.Applied = append(result.Applied, ref)
+		}
+	}
+
+	switch action {
+	case ActionReapply:
+		pending := map[string]bool{}
+		for _, rule := range drift.Missing {
+			pending[rule.Name] = true
+		}
+		// Missing rules come in priority order, so each one is positioned
+		// after the rules re-applied before it
+		for _, rule := range drift.Missing {
+			if !selected(rule.Name) {
+				continue
+			}
+			if err := check(rule); err != nil {
+				record(rule.Name, err)
+				continue
+			}
+			err := reapplyRule(p, rule, pending)
+			if err == nil {
+				delete(pending, rule.Name)
+			}
+			record(rule.Name, err)
+		}
+	case ActionAdopt:
+		for _, l := range drift.Stray {
+			if selected(l.Ref) {
+				record(l.Ref, adoptRule(p, l, check))
+			}
+		}
+		// Unmanaged rules are only adopted when asked for explicitly
+		if len(refs) > 0 {
+			for _, l := range drift.Unmanaged {
+				if selected(l.Ref) {
+					record(l.Ref, adoptRule(p, l, check))
+				}
+			}
+		}
+	case ActionDelete:
+		for _, l := range drift.Stray {
+			if selected(l.Ref) {
+				record(l.Ref, deleteLive(p, l))
+			}
+		}
+		// Unmanaged rules are only deleted when asked for explicitly
+		if len(refs) > 0 {
+			for _, l := range drift.Unmanaged {
+				if selected(l.Ref) {
+					record(l.Ref, deleteLive(p, l))
+				}
+			}
+		}
+	}
+
+	if result.Drift, err = detectDrift(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// deleteLive removes a live rule, restoring it on rollback
+func deleteLive(p *PendingChange, live LiveRule) error {
+	if err := activeBackend.DeleteLive(live); err != nil {
+		return err
+	}
+	p.onUndo(func() error { return activeBackend.RestoreLive(live) })
+	return nil
+}
+
+// reapplyRule adds a missing rule back, positioned only relative to rules
+// that are actually present in the OS. A rollback takes it out of the OS
+// again; the panel keeps it either way.
+func reapplyRule(p *PendingChange, rule models.FirewallRule, pending map[string]bool) error {
+	all, err := precedingRules(rule)
+	if err != nil {
+		return err
+	}
+
+	var preceding []models.FirewallRule
+	for _, r := range all {
+		if !pending[r.Name] {
+			preceding = append(preceding, r)
+		}
+	}
+
+	// Clear any partial leftovers (e.g. one address family) before re-adding
+	activeBackend.DeleteRule(rule)
+	if err := activeBackend.AddRule(rule, preceding); err != nil {
+		return err
+	}
+	p.onUndo(func() error { return activeBackend.DeleteRule(rule) })
+	return nil
+}
+
+// adoptRule records a live rule in the DB. Unmanaged rules are re-created
+// with the panel tag and the original is removed, so later diffs recognize
+// them. Their name is derived from the rule itself, so the IPv4 and IPv6
+// copies of the same iptables rule adopt into one panel rule.
+//
+// Block rules from chains the panel doesn't own are refused: they sit
+// behind rules the panel can't read, such as loopback and established
+// connection accepts, and moving them ahead of those would lock the host out.
+func adoptRule(p *PendingChange, live LiveRule, check func(models.FirewallRule) error) error {
+	rule := live.Rule
+	if live.Builtin && !isAllow(rule.Action) {
+		return fmt.Errorf("block rules in a built-in chain can't be adopted; moving them into the panel chain would put them ahead of rules the panel can't read")
+	}
+	if !live.Managed {
+		sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%s|%s|%s|%s",
+			rule.Direction, rule.Protocol, rule.Port, rule.Source, rule.Destination, rule.Action)))
+		rule.Name = "adopted-" + hex.EncodeToString(sum[:4])
+	}
+
+	if err := ValidateRule(&rule); err != nil {
+		return err
+	}
+
+	var count int64
+	database.DB.Model(&models.FirewallRule{}).Where("name = ?", rule.Name).Count(&count)
+	exists := count > 0
+
+	if live.Managed {
+		if exists {
+			return nil
+		}
+		if err := database.DB.Create(&rule).Error; err != nil {
+			return err
+		}
+		name := rule.Name
+		p.onUndo(func() error {
+			return database.DB.Unscoped().Where("name = ?", name).Delete(&models.FirewallRule{}).Error
+		})
+		return nil
+	}
+
+	if !exists {
+		if err := check(rule); err != nil {
+			return err
+		}
+		if err := addRule(rule); err != nil {
+			return err
+		}
+		name := rule.Name
+		p.onUndo(func() error { return deleteRule(name) })
+	}
+	return deleteLive(p, live)
+}
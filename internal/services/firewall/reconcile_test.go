@@ -0,0 +1,155 @@
+package firewall
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"vps-panel/internal/config"
+	"vps-panel/internal/database"
+	"vps-panel/internal/models"
+)
+
+// iptablesInput is "iptables -S INPUT" on a host with a hand-written
+// ruleset ending in a default deny. Only the port rules and the DROP are
+// expressible as panel rules.
+const iptablesInput = `-P INPUT ACCEPT
+-A INPUT -j VPS_PANEL_INPUT
+-A INPUT -i lo -j ACCEPT
+-A INPUT -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+-A INPUT -p tcp -m tcp --dport 22 -j ACCEPT
+-A INPUT -p tcp -m tcp --dport 8443 -j ACCEPT
+-A INPUT -j DROP
+`
+
+const (
+	refDrop  = "iptables|INPUT|-j DROP"
+	refHTTPS = "iptables|INPUT|-p tcp -m tcp --dport 8443 -j ACCEPT"
+)
+
+// setupReconcile runs the iptables backend against the ruleset above with
+// commit-confirm enabled
+func setupReconcile(t *testing.T) *fakeRunner {
+	t.Helper()
+	if _, err := database.Connect(filepath.Join(t.TempDir(), "panel.db")); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if err := database.AutoMigrate(&models.FirewallRule{}); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+
+	previous := config.AppConfig
+	config.AppConfig = &config.Config{}
+	config.AppConfig.Server.Port = 8080
+	config.AppConfig.Firewall.ConfirmTimeout = time.Minute
+	config.AppConfig.Firewall.ProtectedPorts = []int{22}
+
+	activeBackend = &iptablesBackend{}
+	f := &fakeRunner{
+		commands: []string{"iptables"},
+		results:  map[string]fakeResult{"iptables -S INPUT": {output: iptablesInput}},
+	}
+	useFakeRunner(t, f)
+
+	t.Cleanup(func() {
+		if p := GetPendingChange(); p != nil {
+			RollbackChange(p.ID)
+		}
+		activeBackend = nil
+		config.AppConfig = previous
+	})
+	return f
+}
+
+// changes returns the commands that add or delete rules
+func changes(f *fakeRunner) []string {
+	var out []string
+	for _, call := range f.calls {
+		if strings.Contains(call, " -I ") || strings.Contains(call, " -D ") || strings.Contains(call, " -A ") {
+			out = append(out, call)
+		}
+	}
+	return out
+}
+
+func TestReconcileAdoptNeedsRefsForUnmanaged(t *testing.T) {
+	f := setupReconcile(t)
+
+	result, err := Reconcile(ActionAdopt, nil, "203.0.113.9", false)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(result.Applied) != 0 || result.Pending != nil {
+		t.Errorf("adopt without refs applied %v, pending %v", result.Applied, result.Pending)
+	}
+	if got := changes(f); len(got) != 0 {
+		t.Errorf("adopt without refs changed the firewall: %v", got)
+	}
+}
+
+func TestReconcileRefusesBuiltinDefaultDeny(t *testing.T) {
+	f := setupReconcile(t)
+
+	result, err := Reconcile(ActionAdopt, []string{refDrop}, "203.0.113.9", true)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(result.Applied) != 0 || len(result.Errors) != 1 || !strings.Contains(result.Errors[0], "built-in chain") {
+		t.Errorf("applied %v, errors %v; want the DROP refused", result.Applied, result.Errors)
+	}
+	if got := changes(f); len(got) != 0 {
+		t.Errorf("refused adoption changed the firewall: %v", got)
+	}
+}
+
+func TestReconcileAdoptRollsBack(t *testing.T) {
+	f := setupReconcile(t)
+
+	result, err := Reconcile(ActionAdopt, []string{refHTTPS}, "203.0.113.9", false)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(result.Applied) != 1 || result.Pending == nil {
+		t.Fatalf("applied %v, errors %v, pending %v; want one pending adoption", result.Applied, result.Errors, result.Pending)
+	}
+	applied := changes(f)
+	if len(applied) != 2 ||
+		!strings.HasPrefix(applied[0], "iptables -I VPS_PANEL_INPUT 1 -p tcp --dport 8443 -m comment --comment vps-panel:adopted-") ||
+		applied[1] != "iptables -D INPUT -p tcp -m tcp --dport 8443 -j ACCEPT" {
+		t.Fatalf("adopt commands = %v", applied)
+	}
+
+	f.calls = nil
+	if err := RollbackChange(result.Pending.ID); err != nil {
+		t.Fatalf("RollbackChange: %v", err)
+	}
+	reverted := changes(f)
+	if len(reverted) != 2 ||
+		reverted[0] != "iptables -I INPUT 5 -p tcp -m tcp --dport 8443 -j ACCEPT" ||
+		!strings.HasPrefix(reverted[1], "iptables -D VPS_PANEL_INPUT -p tcp --dport 8443 -m comment --comment vps-panel:adopted-") {
+		t.Errorf("rollback commands = %v", reverted)
+	}
+
+	var count int64
+	database.DB.Model(&models.FirewallRule{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d rules left in the panel after rollback", count)
+	}
+}
+
+func TestReconcileReapplyChecksLockout(t *testing.T) {
+	f := setupReconcile(t)
+	database.DB.Create(&models.FirewallRule{Name: "no-ssh", Direction: "in", Action: "block", Protocol: "tcp", Port: "22", Priority: 100})
+
+	result, err := Reconcile(ActionReapply, nil, "203.0.113.9", false)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(result.Applied) != 0 || len(result.Errors) != 1 || !strings.Contains(result.Errors[0], "would block port 22") {
+		t.Errorf("applied %v, errors %v; want the rule skipped", result.Applied, result.Errors)
+	}
+	if got := changes(f); len(got) != 0 {
+		t.Errorf("skipped rule changed the firewall: %v", got)
+	}
+}
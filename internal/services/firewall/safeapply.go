@@ -0,0 +1,227 @@
+package firewall
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vps-panel/internal/config"
+	"vps-panel/internal/database"
+	"vps-panel/internal/models"
+)
+
+// Change is one firewall edit: a rule to add or the name of one to delete
+type Change struct {
+	Add    *models.FirewallRule
+	Delete string
+}
+
+// PendingChange is a firewall change that rolls back unless confirmed in time
+type PendingChange struct {
+	ID        string         `json:"id"`
+	ExpiresAt time.Time      `json:"expires_at"`
+	undo      []func() error // Steps reverting what the change did, in the order it did them
+	timer     *time.Timer
+}
+
+var (
+	pending *PendingChange
+	applyMu sync.Mutex // Serializes ApplyWithConfirm calls
+)
+
+// onUndo records how to revert a step the change made
+func (p *PendingChange) onUndo(fn func() error) {
+	p.undo = append(p.undo, fn)
+}
+
+// apply makes the change and records what it did so a rollback undoes
+// exactly that. The caller must hold mu.
+func (c Change) apply(p *PendingChange) error {
+	if c.Add != nil {
+		if err := addRule(*c.Add); err != nil {
+			return err
+		}
+		name := c.Add.Name
+		p.onUndo(func() error { return deleteRule(name) })
+	}
+	if c.Delete != "" {
+		var rule models.FirewallRule
+		if err := database.DB.Where("name = ?", c.Delete).First(&rule).Error; err != nil {
+			return fmt.Errorf("rule '%s' not found", c.Delete)
+		}
+		if err := deleteRule(c.Delete); err != nil {
+			return err
+		}
+		rule.ID = 0
+		p.onUndo(func() error { return addRule(rule) })
+	}
+	return nil
+}
+
+// ApplyWithConfirm applies a change. When a confirm timeout is configured
+// the change is kept pending and rolled back automatically unless
+// ConfirmChange is called before it expires; rules changed by anything else
+// in the meantime, such as bans, are left alone. It returns nil when
+// confirmation is disabled.
+func ApplyWithConfirm(change Change) (*PendingChange, error) {
+	return applyWithConfirm(change.apply)
+}
+
+// applyWithConfirm runs apply under mu and keeps what it recorded pending.
+// Nothing is kept pending when apply changed nothing.
+func applyWithConfirm(apply func(p *PendingChange) error) (*PendingChange, error) {
+	timeout := config.AppConfig.Firewall.ConfirmTimeout
+	if timeout <= 0 {
+		mu.Lock()
+		defer mu.Unlock()
+		return nil, apply(&PendingChange{})
+	}
+
+	applyMu.Lock()
+	defer applyMu.Unlock()
+
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate change id: %w", err)
+	}
+	p := &PendingChange{
+		ID:        hex.EncodeToString(buf),
+		ExpiresAt: time.Now().Add(timeout),
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if pending != nil {
+		return nil, fmt.Errorf("another firewall change is awaiting confirmation")
+	}
+	if err := apply(p); err != nil {
+		// Don't leave half a change behind
+		if rerr := p.revert(); rerr != nil {
+			log.Printf("Firewall: %v", rerr)
+		}
+		return nil, err
+	}
+	if len(p.undo) == 0 {
+		return nil, nil
+	}
+
+	pending = p
+	p.timer = time.AfterFunc(timeout, func() {
+		if err := RollbackChange(p.ID); err == nil {
+			log.Printf("🔥 Firewall: change %s not confirmed, rolled back", p.ID)
+		}
+	})
+	return p, nil
+}
+
+// GetPendingChange returns the change awaiting confirmation, if any
+func GetPendingChange() *PendingChange {
+	mu.Lock()
+	defer mu.Unlock()
+	return pending
+}
+
+// ConfirmChange keeps a pending change
+func ConfirmChange(id string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if pending == nil || pending.ID != id {
+		return fmt.Errorf("no pending change with id '%s'", id)
+	}
+	pending.timer.Stop()
+	pending = nil
+	return nil
+}
+
+// RollbackChange undoes a pending change
+func RollbackChange(id string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if pending == nil || pending.ID != id {
+		return fmt.Errorf("no pending change with id '%s'", id)
+	}
+	pending.timer.Stop()
+	change := pending
+	pending = nil
+
+	return change.revert()
+}
+
+// revert undoes the change's steps, last first. The caller must hold mu.
+func (p *PendingChange) revert() error {
+	var errs []string
+	for i := len(p.undo) - 1; i >= 0; i-- {
+		if err := p.undo[i](); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("rollback incomplete: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// CheckLockout refuses rules that would block the panel port, a protected
+// port such as SSH, or the client making the change
+func CheckLockout(rule models.FirewallRule, clientIP string) error {
+	if isAllow(rule.Action) || rule.Protocol == "udp" || rule.Protocol == "icmp" {
+		return nil
+	}
+
+	client := net.ParseIP(clientIP)
+	covers := func(cidr string) bool {
+		if cidr == "" {
+			return true
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		return err == nil && client != nil && network.Contains(client)
+	}
+
+	if rule.Direction == "out" {
+		// Replies go to the client's ephemeral port, so only port-less rules matter
+		if rule.Port == "" && covers(rule.Destination) {
+			return fmt.Errorf("rule would block replies to your IP %s", clientIP)
+		}
+		return nil
+	}
+
+	if !covers(rule.Source) {
+		return nil
+	}
+
+	ports := append([]int{config.AppConfig.Server.Port}, config.AppConfig.Firewall.ProtectedPorts...)
+	for _, port := range ports {
+		if portMatches(rule.Port, port) {
+			return fmt.Errorf("rule would block port %d for your IP %s", port, clientIP)
+		}
+	}
+	return nil
+}
+
+// portMatches reports whether a port spec (empty = all ports) includes port
+func portMatches(spec string, port int) bool {
+	if spec == "" {
+		return true
+	}
+	for _, item := range strings.Split(spec, ",") {
+		low, high, isRange := strings.Cut(item, "-")
+		lo, _ := strconv.Atoi(low)
+		hi := lo
+		if isRange {
+			hi, _ = strconv.Atoi(high)
+		}
+		if port >= lo && port <= hi {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,251 @@
+package firewall
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"vps-panel/internal/models"
+)
+
+var ufwNumberRe = regexp.MustCompile(`^\[\s*(\d+)\]`)
+
+// ufwBackend manages rules through ufw when it is installed and active
+type ufwBackend struct{}
+
+func (b *ufwBackend) Name() string {
+	return "ufw"
+}
+
+func (b *ufwBackend) Available() bool {
+	if !hasCommand("ufw") {
+		return false
+	}
+	output, err := runner.Run("ufw", "status")
+	return err == nil && strings.Contains(string(output), "Status: active")
+}
+
+// ruleSpec builds "allow in proto tcp from X to Y port 80,443" arguments
+// shared by add and delete
+func (b *ufwBackend) ruleSpec(rule models.FirewallRule) ([]string, error) {
+	if rule.Protocol == "icmp" {
+		return nil, fmt.Errorf("ufw does not support ICMP rules")
+	}
+
+	action := "deny"
+	if isAllow(rule.Action) {
+		action = "allow"
+	}
+	spec := []string{action, rule.Direction}
+
+	if rule.Protocol != "any" {
+		spec = append(spec, "proto", rule.Protocol)
+	}
+
+	from, to := "any", "any"
+	if rule.Source != "" {
+		from = rule.Source
+	}
+	if rule.Destination != "" {
+		to = rule.Destination
+	}
+	spec = append(spec, "from", from, "to", to)
+
+	if rule.Port != "" {
+		spec = append(spec, "port", strings.ReplaceAll(rule.Port, "-", ":"))
+	}
+	return spec, nil
+}
+
+// insertPosition returns the ufw rule number the new rule should be inserted
+// at, or 0 to append
+func (b *ufwBackend) insertPosition(rule models.FirewallRule, preceding []models.FirewallRule) int {
+	if ruleFamily(rule) == "ipv6" {
+		return 0
+	}
+
+	output, err := runner.Run("ufw", "status", "numbered")
+	if err != nil {
+		return 0
+	}
+
+	before := map[string]bool{}
+	for _, p := range preceding {
+		before[p.Name] = true
+	}
+
+	// Insert before the first managed rule that follows the last preceding
+	// one; if there is none, appending keeps the order
+	position := 0
+	for _, line := range strings.Split(string(output), "\n") {
+		m := ufwNumberRe.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil || strings.Contains(line, "(v6)") {
+			continue
+		}
+		idx := strings.Index(line, "# "+ruleComment)
+		if idx < 0 {
+			continue
+		}
+		name := strings.TrimSpace(line[idx+len("# "+ruleComment):])
+		if before[name] {
+			position = 0
+		} else if position == 0 {
+			position, _ = strconv.Atoi(m[1])
+		}
+	}
+	return position
+}
+
+func (b *ufwBackend) AddRule(rule models.FirewallRule, preceding []models.FirewallRule) error {
+	spec, err := b.ruleSpec(rule)
+	if err != nil {
+		return err
+	}
+
+	args := spec
+	if pos := b.insertPosition(rule, preceding); pos > 0 {
+		args = append([]string{"insert", strconv.Itoa(pos)}, spec...)
+	}
+	args = append(args, "comment", ruleComment+rule.Name)
+
+	output, err := runner.Run("ufw", args...)
+	if err != nil {
+		return fmt.Errorf("failed to add rule: %v: %s", err, output)
+	}
+	return nil
+}
+
+func (b *ufwBackend) DeleteRule(rule models.FirewallRule) error {
+	spec, err := b.ruleSpec(rule)
+	if err != nil {
+		return err
+	}
+
+	output, err := runner.Run("ufw", append([]string{"delete"}, spec...)...)
+	if err != nil {
+		return fmt.Errorf("failed to delete rule: %v: %s", err, output)
+	}
+	return nil
+}
+
+// ListRules reads user rules from "ufw show added", which prints them back
+// as ufw commands
+func (b *ufwBackend) ListRules() ([]LiveRule, error) {
+	output, err := runner.Run("ufw", "show", "added")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules: %v: %s", err, output)
+	}
+
+	var rules []LiveRule
+	for _, line := range strings.Split(string(output), "\n") {
+		if live, ok := parseUfwRule(strings.TrimSpace(line)); ok {
+			rules = append(rules, live)
+		}
+	}
+	return rules, nil
+}
+
+func (b *ufwBackend) DeleteLive(live LiveRule) error {
+	output, err := runner.Run("ufw", append([]string{"delete"}, splitArgs(live.Ref)...)...)
+	if err != nil {
+		return fmt.Errorf("failed to delete rule: %v: %s", err, output)
+	}
+	return nil
+}
+
+// RestoreLive re-adds a deleted rule. ufw numbers IPv4 and IPv6 rules
+// apart from the order "show added" lists them in, so it is appended.
+func (b *ufwBackend) RestoreLive(live LiveRule) error {
+	args := splitArgs(live.Ref)
+	if live.Managed {
+		args = append(args, "comment", ruleComment+live.Rule.Name)
+	}
+	output, err := runner.Run("ufw", args...)
+	if err != nil {
+		return fmt.Errorf("failed to restore rule: %v: %s", err, output)
+	}
+	return nil
+}
+
+// parseUfwRule reads one "ufw allow ..." line. Rules using features the panel
+// can't express (route, limit, app profiles, interfaces) are skipped.
+func parseUfwRule(line string) (LiveRule, bool) {
+	tokens := splitArgs(line)
+	if len(tokens) < 3 || tokens[0] != "ufw" {
+		return LiveRule{}, false
+	}
+	tokens = tokens[1:]
+
+	rule := models.FirewallRule{Direction: "in", Protocol: "any"}
+	live := LiveRule{}
+
+	switch tokens[0] {
+	case "allow":
+		rule.Action = "allow"
+	case "deny", "reject":
+		rule.Action = "block"
+	default:
+		return LiveRule{}, false
+	}
+
+	// The reference is the rule without its comment, as "ufw delete" expects
+	ref := tokens
+	for i, tok := range tokens {
+		if tok == "comment" {
+			ref = tokens[:i]
+			if i+1 < len(tokens) {
+				if name, ok := managedName(tokens[i+1]); ok {
+					rule.Name = name
+					live.Managed = true
+				}
+			}
+			break
+		}
+	}
+
+	args := ref[1:]
+	if len(args) > 0 && (args[0] == "in" || args[0] == "out") {
+		rule.Direction = args[0]
+		args = args[1:]
+	}
+
+	if len(args) == 1 {
+		// Simple syntax: "22", "22/tcp" or "80,443/tcp"
+		port, proto, _ := strings.Cut(args[0], "/")
+		if proto != "" {
+			rule.Protocol = proto
+		}
+		rule.Port = strings.ReplaceAll(port, ":", "-")
+		if _, err := parsePorts(rule.Port); err != nil {
+			return LiveRule{}, false
+		}
+	} else {
+		for i := 0; i < len(args); i += 2 {
+			if i+1 >= len(args) {
+				return LiveRule{}, false
+			}
+			value := args[i+1]
+			switch args[i] {
+			case "proto":
+				rule.Protocol = value
+			case "from":
+				if value != "any" {
+					rule.Source, _ = normalizeAddress(value)
+				}
+			case "to":
+				if value != "any" {
+					rule.Destination, _ = normalizeAddress(value)
+				}
+			case "port":
+				rule.Port = strings.ReplaceAll(value, ":", "-")
+			default:
+				return LiveRule{}, false
+			}
+		}
+	}
+
+	live.Rule = rule
+	live.Ref = strings.Join(quoteArgs(ref), " ")
+	return live, true
+}
@@ -0,0 +1,160 @@
+package firewall
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"vps-panel/internal/models"
+)
+
+const defaultPriority = 100
+
+// maxPorts is what iptables multiport and ufw accept in one rule; a range
+// counts as two
+const maxPorts = 15
+
+// Rule names end up in OS rule comments, so keep them shell and quote safe
+var ruleNameRe = regexp.MustCompile(`^[A-Za-z0-9 _.-]{1,64}$`)
+
+// ValidateRule checks a rule and normalizes its fields in place
+func ValidateRule(rule *models.FirewallRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if !ruleNameRe.MatchString(rule.Name) {
+		return fmt.Errorf("rule name may only contain letters, digits, spaces, '.', '_' and '-' (max 64)")
+	}
+
+	rule.Direction = strings.ToLower(strings.TrimSpace(rule.Direction))
+	switch rule.Direction {
+	case "":
+		rule.Direction = "in"
+	case "in", "out":
+	default:
+		return fmt.Errorf("invalid direction '%s' (use in or out)", rule.Direction)
+	}
+
+	rule.Protocol = strings.ToLower(strings.TrimSpace(rule.Protocol))
+	switch rule.Protocol {
+	case "":
+		rule.Protocol = "tcp"
+	case "tcp", "udp", "icmp", "any":
+	default:
+		return fmt.Errorf("invalid protocol '%s' (use tcp, udp, icmp or any)", rule.Protocol)
+	}
+
+	rule.Action = strings.ToLower(strings.TrimSpace(rule.Action))
+	switch rule.Action {
+	case "":
+		rule.Action = "allow"
+	case "allow", "block":
+	default:
+		return fmt.Errorf("invalid action '%s' (use allow or block)", rule.Action)
+	}
+
+	rule.Port = strings.ReplaceAll(rule.Port, " ", "")
+	if rule.Port != "" {
+		if rule.Protocol != "tcp" && rule.Protocol != "udp" {
+			return fmt.Errorf("ports can only be used with tcp or udp")
+		}
+		if _, err := parsePorts(rule.Port); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if rule.Source, err = normalizeAddress(rule.Source); err != nil {
+		return fmt.Errorf("invalid source: %v", err)
+	}
+	if rule.Destination, err = normalizeAddress(rule.Destination); err != nil {
+		return fmt.Errorf("invalid destination: %v", err)
+	}
+	if rule.Source != "" && rule.Destination != "" && addressFamily(rule.Source) != addressFamily(rule.Destination) {
+		return fmt.Errorf("source and destination must both be IPv4 or both be IPv6")
+	}
+
+	if rule.Priority == 0 {
+		rule.Priority = defaultPriority
+	}
+	if rule.Priority < 1 || rule.Priority > 1000 {
+		return fmt.Errorf("priority must be between 1 and 1000")
+	}
+
+	return nil
+}
+
+// parsePorts splits "80,443,8000-8100" into its items and checks each one
+func parsePorts(ports string) ([]string, error) {
+	items := strings.Split(ports, ",")
+	count := 0
+	for _, item := range items {
+		bounds := strings.SplitN(item, "-", 2)
+		count += len(bounds)
+		if count > maxPorts {
+			return nil, fmt.Errorf("too many ports (max %d, a range counts as two)", maxPorts)
+		}
+		low, err := parsePort(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(bounds) == 2 {
+			high, err := parsePort(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+			if high <= low {
+				return nil, fmt.Errorf("invalid port range '%s'", item)
+			}
+		}
+	}
+	return items, nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port '%s'", s)
+	}
+	return port, nil
+}
+
+// normalizeAddress accepts an IP or CIDR and returns it in CIDR form
+func normalizeAddress(addr string) (string, error) {
+	addr = strings.TrimSpace(addr)
+	if addr == "" || addr == "any" {
+		return "", nil
+	}
+
+	if ip := net.ParseIP(addr); ip != nil {
+		if ip.To4() != nil {
+			return ip.String() + "/32", nil
+		}
+		return ip.String() + "/128", nil
+	}
+
+	_, network, err := net.ParseCIDR(addr)
+	if err != nil {
+		return "", fmt.Errorf("'%s' is not an IP address or CIDR", addr)
+	}
+	return network.String(), nil
+}
+
+// addressFamily returns "ipv4" or "ipv6" for a normalized CIDR
+func addressFamily(cidr string) string {
+	if strings.Contains(cidr, ":") {
+		return "ipv6"
+	}
+	return "ipv4"
+}
+
+// ruleFamily returns the address family a rule is limited to, or "" for both
+func ruleFamily(rule models.FirewallRule) string {
+	if rule.Source != "" {
+		return addressFamily(rule.Source)
+	}
+	if rule.Destination != "" {
+		return addressFamily(rule.Destination)
+	}
+	return ""
+}
@@ -0,0 +1,28 @@
+package firewall
+
+import "testing"
+
+func TestParsePorts(t *testing.T) {
+	tests := []struct {
+		ports   string
+		wantErr bool
+	}{
+		{"22", false},
+		{"80,443,8000-8100", false},
+		{"1,2,3,4,5,6,7,8,9,10,11,12,13,14,15", false},
+		{"1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16", true},
+		{"1-2,3-4,5-6,7-8,9-10,11-12,13-14,15", false},
+		{"1-2,3-4,5-6,7-8,9-10,11-12,13-14,15-16", true},
+		{"0", true},
+		{"65536", true},
+		{"100-90", true},
+		{"http", true},
+	}
+
+	for _, tt := range tests {
+		_, err := parsePorts(tt.ports)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePorts(%q) error = %v, want error %v", tt.ports, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"vps-panel/internal/config"
+	"vps-panel/internal/database"
+	"vps-panel/internal/models"
+	"vps-panel/internal/services/monitor"
+)
+
+// maxPoints caps the points returned by a query; the step is widened to fit
+const maxPoints = 1000
+
+// tier is one resolution of stored samples
+type tier struct {
+	resolution int64 // Seconds
+	retention  time.Duration
+	rolledTo   int64 // Start of the next bucket to downsample into this tier
+}
+
+var (
+	mutex   sync.Mutex
+	tiers   []*tier
+	enabled bool
+)
+
+// Point is one bucket of a queried series
+type Point struct {
+	Time  int64   `json:"time"` // Unix seconds, start of the bucket
+	Value float64 `json:"value"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+// Series is the result of a query
+type Series struct {
+	Metric     string  `json:"metric"`
+	From       int64   `json:"from"`
+	To         int64   `json:"to"`
+	Step       int64   `json:"step"`       // Seconds per point
+	Resolution int64   `json:"resolution"` // Seconds per stored sample the points were built from
+	Points     []Point `json:"points"`
+}
+
+// Init sets up the retention tiers and starts collecting
+func Init() {
+	cfg := config.AppConfig.Metrics
+	if !cfg.Enabled || cfg.Interval <= 0 || len(cfg.Tiers) == 0 {
+		log.Printf("📈 Metrics history disabled")
+		return
+	}
+
+	interval := int64(cfg.Interval / time.Second)
+	if interval < 1 {
+		interval = 1
+	}
+	for i, t := range cfg.Tiers {
+		res := interval
+		if i > 0 {
+			res = int64(t.Resolution / time.Second)
+			prev := tiers[len(tiers)-1].resolution
+			if res <= prev || res%prev != 0 {
+				log.Printf("Metrics: tier %s must be a multiple of %ds, ignoring it and coarser tiers", t.Resolution, prev)
+				break
+			}
+		}
+		tiers = append(tiers, &tier{resolution: res, retention: t.Retention})
+	}
+
+	// Resume downsampling after the last bucket written before a restart
+	now := time.Now().Unix()
+	for _, t := range tiers[1:] {
+		var last models.MetricSample
+		if database.DB.Where("resolution = ?", t.resolution).Order("timestamp desc").First(&last).Error == nil {
+			t.rolledTo = last.Timestamp + t.resolution
+		} else {
+			t.rolledTo = now - now%t.resolution
+		}
+	}
+	enabled = true
+
+	go collectLoop(cfg.Interval)
+	go pruneLoop()
+
+	log.Printf("📈 Metrics history enabled (%d tiers, every %s)", len(tiers), cfg.Interval)
+}
+
+// Enabled reports whether history is being collected
+func Enabled() bool {
+	return enabled
+}
+
+func collectLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		stats, err := monitor.GetSystemStats()
+		if err != nil {
+			log.Printf("Metrics: sampling failed: %v", err)
+			continue
+		}
+		now := time.Now()
+
+		if err := store(now.Unix(), Sample(stats)); err != nil {
+			log.Printf("Metrics: storing samples failed: %v", err)
+			continue
+		}
+		rollup(now.Unix())
+	}
+}
+
+// Sample flattens stats into named values
+func Sample(stats *monitor.SystemStats) map[string]float64 {
+	values := map[string]float64{
+		"cpu.usage_percent":          stats.CPU.UsagePercent,
+		"load.load1":                 stats.Load.Load1,
+		"load.load5":                 stats.Load.Load5,
+		"load.load15":                stats.Load.Load15,
+		"memory.used_percent":        stats.Memory.UsedPercent,
+		"memory.used_bytes":          float64(stats.Memory.Used),
+		"swap.used_percent":          stats.Swap.UsedPercent,
+		"network.recv_bytes_per_sec": stats.Network.BytesRecvPerSec,
+		"network.sent_bytes_per_sec": stats.Network.BytesSentPerSec,
+	}
+	for _, d := range stats.Disk {
+		values["disk.used_percent:"+d.Mountpoint] = d.UsedPercent
+		if d.InodesTotal > 0 {
+			values["disk.inodes_used_percent:"+d.Mountpoint] = d.InodesUsedPercent
+		}
+	}
+	for _, d := range stats.DiskIO {
+		values["diskio.read_bytes_per_sec:"+d.Name] = d.ReadBytesPerSec
+		values["diskio.write_bytes_per_sec:"+d.Name] = d.WriteBytesPerSec
+	}
+	for _, t := range stats.Temperatures {
+		values["temperature:"+t.Sensor] = t.Temperature
+	}
+	return values
+}
+
+// store writes raw samples into the finest tier
+func store(timestamp int64, values map[string]float64) error {
+	samples := make([]models.MetricSample, 0, len(values))
+	for metric, v := range values {
+		samples = append(samples, models.MetricSample{
+			Metric:     metric,
+			Resolution: int(tiers[0].resolution),
+			Timestamp:  timestamp,
+			Value:      v,
+			Min:        v,
+			Max:        v,
+		})
+	}
+	return database.DB.Create(&samples).Error
+}
+
+// rollup downsamples every finished bucket of each coarser tier from the
+// tier before it, finest first so each source bucket is complete
+func rollup(now int64) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for i, t := range tiers[1:] {
+		src := tiers[i]
+		current := now - now%t.resolution
+
+		// Source samples past their retention are gone; don't walk over them
+		if oldest := now - int64(src.retention/time.Second); src.retention > 0 && t.rolledTo < oldest {
+			t.rolledTo = oldest - oldest%t.resolution
+		}
+
+		for ; t.rolledTo < current; t.rolledTo += t.resolution {
+			if err := downsample(src.resolution, t.resolution, t.rolledTo); err != nil {
+				log.Printf("Metrics: downsampling to %ds failed: %v", t.resolution, err)
+				return
+			}
+		}
+	}
+}
+
+// downsample aggregates one bucket of the source tier into the target tier
+func downsample(srcRes, res, start int64) error {
+	var rows []models.MetricSample
+	err := database.DB.Model(&models.MetricSample{}).
+		Select("metric, AVG(value) AS value, MIN(min) AS min, MAX(max) AS max").
+		Where("resolution = ? AND timestamp >= ? AND timestamp < ?", srcRes, start, start+res).
+		Group("metric").
+		Scan(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+
+	for i := range rows {
+		rows[i].Resolution = int(res)
+		rows[i].Timestamp = start
+	}
+	return database.DB.Create(&rows).Error
+}
+
+// pruneLoop deletes samples past their tier's retention
+func pruneLoop() {
+	for {
+		now := time.Now()
+		for _, t := range tiers {
+			if t.retention <= 0 {
+				continue
+			}
+			cutoff := now.Add(-t.retention).Unix()
+			if err := database.DB.Where("resolution = ? AND timestamp < ?", t.resolution, cutoff).Delete(&models.MetricSample{}).Error; err != nil {
+				log.Printf("Metrics: pruning %ds samples failed: %v", t.resolution, err)
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// Names lists the metrics that have raw samples
+func Names() ([]string, error) {
+	var names []string
+	if !enabled {
+		return names, nil
+	}
+	err := database.DB.Model(&models.MetricSample{}).
+		Where("resolution = ?", tiers[0].resolution).
+		Distinct().Order("metric").Pluck("metric", &names).Error
+	return names, err
+}
+
+// Query returns a metric between from and to, averaged into buckets of step.
+// It reads the coarsest tier that still covers from and is no coarser than
+// step; a zero step picks one that yields at most maxPoints points.
+func Query(metric string, from, to time.Time, step time.Duration) (*Series, error) {
+	if !enabled {
+		return nil, fmt.Errorf("metrics history is disabled")
+	}
+	if metric == "" {
+		return nil, fmt.Errorf("metric is required")
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("to must be after from")
+	}
+
+	fromUnix, toUnix := from.Unix(), to.Unix()
+	stepSec := int64(step / time.Second)
+	if stepSec <= 0 {
+		stepSec = (toUnix - fromUnix + maxPoints - 1) / maxPoints
+	}
+
+	now := time.Now()
+	t := tiers[len(tiers)-1]
+	for i, candidate := range tiers {
+		if candidate.retention > 0 && now.Add(-candidate.retention).After(from) {
+			continue
+		}
+		t = candidate
+		for _, coarser := range tiers[i+1:] {
+			if coarser.resolution > stepSec {
+				break
+			}
+			t = coarser
+		}
+		break
+	}
+
+	// Points can't be finer than the samples they come from
+	if min := (toUnix - fromUnix + maxPoints - 1) / maxPoints; stepSec < min {
+		stepSec = min
+	}
+	stepSec = (stepSec + t.resolution - 1) / t.resolution * t.resolution
+
+	points := []Point{}
+	err := database.DB.Model(&models.MetricSample{}).
+		Select("(timestamp / ?) * ? AS time, AVG(value) AS value, MIN(min) AS min, MAX(max) AS max", stepSec, stepSec).
+		Where("metric = ? AND resolution = ? AND timestamp >= ? AND timestamp < ?", metric, t.resolution, fromUnix, toUnix).
+		Group("time").
+		Order("time").
+		Scan(&points).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &Series{
+		Metric:     metric,
+		From:       fromUnix,
+		To:         toUnix,
+		Step:       stepSec,
+		Resolution: t.resolution,
+		Points:     points,
+	}, nil
+}
@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"vps-panel/internal/services/events"
+)
+
+// Stats the sampler can collect
+const (
+	CollectCPU          = "cpu"
+	CollectLoad         = "load"
+	CollectMemory       = "memory"
+	CollectSwap         = "swap"
+	CollectDisk         = "disk"
+	CollectDiskIO       = "disk_io"
+	CollectNetwork      = "network"
+	CollectTemperatures = "temperatures"
+	CollectHost         = "host"
+)
+
+// Collectors lists every stat that can be collected
+var Collectors = []string{
+	CollectCPU, CollectLoad, CollectMemory, CollectSwap, CollectDisk,
+	CollectDiskIO, CollectNetwork, CollectTemperatures, CollectHost,
+}
+
+// DefaultInterval is used when Start is given no interval
+const DefaultInterval = 2 * time.Second
+
+var (
+	samplerMu sync.RWMutex
+	latest    *SystemStats
+	enabled   = allCollectors()
+
+	// sampleMu serializes sampling, which keeps rate counters consistent
+	sampleMu sync.Mutex
+)
+
+func allCollectors() map[string]bool {
+	set := make(map[string]bool, len(Collectors))
+	for _, name := range Collectors {
+		set[name] = true
+	}
+	return set
+}
+
+// Start samples system stats every interval in the background. Only the
+// named collectors run; an empty list enables all of them.
+func Start(interval time.Duration, collectors []string) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	set := allCollectors()
+	if len(collectors) > 0 {
+		set = make(map[string]bool, len(collectors))
+		for _, name := range collectors {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if !allCollectors()[name] {
+				log.Printf("Monitor: unknown collector '%s', ignoring it", name)
+				continue
+			}
+			set[name] = true
+		}
+	}
+
+	samplerMu.Lock()
+	enabled = set
+	samplerMu.Unlock()
+
+	// The first CPU reading covers the time since startup; take it now so
+	// the next one covers exactly one interval
+	sample()
+	go sampleLoop(interval)
+	log.Printf("📊 System stats sampled every %s", interval)
+}
+
+func sampleLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		sample()
+	}
+}
+
+// sample collects a snapshot, makes it the latest and publishes it on the
+// stats topic
+func sample() *SystemStats {
+	sampleMu.Lock()
+	defer sampleMu.Unlock()
+
+	samplerMu.RLock()
+	set := enabled
+	samplerMu.RUnlock()
+
+	stats := collect(set, time.Now())
+
+	samplerMu.Lock()
+	latest = stats
+	samplerMu.Unlock()
+
+	events.Publish(events.TopicStats, stats)
+	return stats
+}
+
+// GetSystemStats returns the latest snapshot without waiting for a sample.
+// The snapshot is shared between callers and must not be modified.
+func GetSystemStats() (*SystemStats, error) {
+	samplerMu.RLock()
+	stats := latest
+	samplerMu.RUnlock()
+	if stats != nil {
+		return stats, nil
+	}
+
+	// The sampler hasn't been started
+	return sample(), nil
+}
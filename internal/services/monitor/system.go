@@ -2,21 +2,29 @@ package monitor
 
 import (
 	"runtime"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
 	"github.com/shirou/gopsutil/v3/net"
 )
 
 type SystemStats struct {
-	CPU     CPUStats     `json:"cpu"`
-	Memory  MemoryStats  `json:"memory"`
-	Disk    []DiskStats  `json:"disk"`
-	Network NetworkStats `json:"network"`
-	Host    HostInfo     `json:"host"`
+	SampledAt    time.Time          `json:"sampled_at"`
+	CPU          CPUStats           `json:"cpu"`
+	Load         LoadStats          `json:"load"`
+	Memory       MemoryStats        `json:"memory"`
+	Swap         SwapStats          `json:"swap"`
+	Disk         []DiskStats        `json:"disk"`
+	DiskIO       []DiskIOStats      `json:"disk_io"`
+	Network      NetworkStats       `json:"network"`
+	Temperatures []TemperatureStats `json:"temperatures"`
+	Host         HostInfo           `json:"host"`
 }
 
 type CPUStats struct {
@@ -25,6 +33,12 @@ type CPUStats struct {
 	PerCore      []float64 `json:"per_core"`
 }
 
+type LoadStats struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+}
+
 type MemoryStats struct {
 	Total       uint64  `json:"total"`
 	Used        uint64  `json:"used"`
@@ -32,20 +46,78 @@ type MemoryStats struct {
 	UsedPercent float64 `json:"used_percent"`
 }
 
-type DiskStats struct {
-	Device      string  `json:"device"`
-	Mountpoint  string  `json:"mountpoint"`
+type SwapStats struct {
 	Total       uint64  `json:"total"`
 	Used        uint64  `json:"used"`
 	Free        uint64  `json:"free"`
 	UsedPercent float64 `json:"used_percent"`
 }
 
+type DiskStats struct {
+	Device            string  `json:"device"`
+	Mountpoint        string  `json:"mountpoint"`
+	Total             uint64  `json:"total"`
+	Used              uint64  `json:"used"`
+	Free              uint64  `json:"free"`
+	UsedPercent       float64 `json:"used_percent"`
+	InodesTotal       uint64  `json:"inodes_total"`
+	InodesUsed        uint64  `json:"inodes_used"`
+	InodesFree        uint64  `json:"inodes_free"`
+	InodesUsedPercent float64 `json:"inodes_used_percent"`
+}
+
+// DiskIOStats holds the cumulative counters of one block device and the
+// rates since the previous sample
+type DiskIOStats struct {
+	Name             string  `json:"name"`
+	ReadBytes        uint64  `json:"read_bytes"`
+	WriteBytes       uint64  `json:"write_bytes"`
+	ReadCount        uint64  `json:"read_count"`
+	WriteCount       uint64  `json:"write_count"`
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+	ReadOpsPerSec    float64 `json:"read_ops_per_sec"`
+	WriteOpsPerSec   float64 `json:"write_ops_per_sec"`
+}
+
+// NetworkStats holds the counters summed over all interfaces, the rates
+// since the previous sample, and the same per interface
 type NetworkStats struct {
-	BytesSent   uint64 `json:"bytes_sent"`
-	BytesRecv   uint64 `json:"bytes_recv"`
-	PacketsSent uint64 `json:"packets_sent"`
-	PacketsRecv uint64 `json:"packets_recv"`
+	BytesSent         uint64           `json:"bytes_sent"`
+	BytesRecv         uint64           `json:"bytes_recv"`
+	PacketsSent       uint64           `json:"packets_sent"`
+	PacketsRecv       uint64           `json:"packets_recv"`
+	BytesSentPerSec   float64          `json:"bytes_sent_per_sec"`
+	BytesRecvPerSec   float64          `json:"bytes_recv_per_sec"`
+	PacketsSentPerSec float64          `json:"packets_sent_per_sec"`
+	PacketsRecvPerSec float64          `json:"packets_recv_per_sec"`
+	Interfaces        []InterfaceStats `json:"interfaces"`
+}
+
+// InterfaceStats holds the cumulative counters of one network interface
+// and the rates since the previous sample
+type InterfaceStats struct {
+	Name              string  `json:"name"`
+	BytesSent         uint64  `json:"bytes_sent"`
+	BytesRecv         uint64  `json:"bytes_recv"`
+	PacketsSent       uint64  `json:"packets_sent"`
+	PacketsRecv       uint64  `json:"packets_recv"`
+	Errin             uint64  `json:"errin"`
+	Errout            uint64  `json:"errout"`
+	Dropin            uint64  `json:"dropin"`
+	Dropout           uint64  `json:"dropout"`
+	BytesSentPerSec   float64 `json:"bytes_sent_per_sec"`
+	BytesRecvPerSec   float64 `json:"bytes_recv_per_sec"`
+	PacketsSentPerSec float64 `json:"packets_sent_per_sec"`
+	PacketsRecvPerSec float64 `json:"packets_recv_per_sec"`
+}
+
+// TemperatureStats is one hardware sensor, in degrees Celsius
+type TemperatureStats struct {
+	Sensor      string  `json:"sensor"`
+	Temperature float64 `json:"temperature"`
+	High        float64 `json:"high,omitempty"`
+	Critical    float64 `json:"critical,omitempty"`
 }
 
 type HostInfo struct {
@@ -58,74 +130,240 @@ type HostInfo struct {
 	BootTime        uint64 `json:"boot_time"`
 }
 
-func GetSystemStats() (*SystemStats, error) {
-	stats := &SystemStats{}
+// counters are the cumulative values rates are computed against
+type counters struct {
+	at         time.Time
+	interfaces map[string]InterfaceStats
+	disks      map[string]DiskIOStats
+}
+
+var (
+	countersMu sync.Mutex
+	previous   *counters
+)
+
+// collect samples the enabled stats. CPU usage is measured since the
+// previous call instead of blocking for a measuring window.
+func collect(enabled map[string]bool, now time.Time) *SystemStats {
+	stats := &SystemStats{SampledAt: now}
+	stats.CPU.Cores = runtime.NumCPU()
 
-	// CPU
-	cpuPercent, err := cpu.Percent(time.Second, false)
-	if err == nil && len(cpuPercent) > 0 {
-		stats.CPU.UsagePercent = cpuPercent[0]
+	if enabled[CollectCPU] {
+		if cpuPercent, err := cpu.Percent(0, false); err == nil && len(cpuPercent) > 0 {
+			stats.CPU.UsagePercent = cpuPercent[0]
+		}
+		if perCore, err := cpu.Percent(0, true); err == nil {
+			stats.CPU.PerCore = perCore
+		}
 	}
 
-	perCore, err := cpu.Percent(time.Second, true)
-	if err == nil {
-		stats.CPU.PerCore = perCore
+	// Not available on Windows
+	if enabled[CollectLoad] {
+		if avg, err := load.Avg(); err == nil {
+			stats.Load = LoadStats{Load1: avg.Load1, Load5: avg.Load5, Load15: avg.Load15}
+		}
 	}
-	stats.CPU.Cores = runtime.NumCPU()
 
-	// Memory
-	memInfo, err := mem.VirtualMemory()
-	if err == nil {
-		stats.Memory = MemoryStats{
-			Total:       memInfo.Total,
-			Used:        memInfo.Used,
-			Free:        memInfo.Free,
-			UsedPercent: memInfo.UsedPercent,
+	if enabled[CollectMemory] {
+		if memInfo, err := mem.VirtualMemory(); err == nil {
+			stats.Memory = MemoryStats{
+				Total:       memInfo.Total,
+				Used:        memInfo.Used,
+				Free:        memInfo.Free,
+				UsedPercent: memInfo.UsedPercent,
+			}
 		}
 	}
 
-	// Disk
-	partitions, err := disk.Partitions(false)
-	if err == nil {
-		for _, partition := range partitions {
-			usage, err := disk.Usage(partition.Mountpoint)
-			if err == nil {
-				stats.Disk = append(stats.Disk, DiskStats{
-					Device:      partition.Device,
-					Mountpoint:  partition.Mountpoint,
-					Total:       usage.Total,
-					Used:        usage.Used,
-					Free:        usage.Free,
-					UsedPercent: usage.UsedPercent,
+	if enabled[CollectSwap] {
+		if swap, err := mem.SwapMemory(); err == nil {
+			stats.Swap = SwapStats{
+				Total:       swap.Total,
+				Used:        swap.Used,
+				Free:        swap.Free,
+				UsedPercent: swap.UsedPercent,
+			}
+		}
+	}
+
+	if enabled[CollectDisk] {
+		stats.Disk = diskUsage()
+	}
+
+	if enabled[CollectDiskIO] {
+		if ioCounters, err := disk.IOCounters(); err == nil {
+			for name, io := range ioCounters {
+				stats.DiskIO = append(stats.DiskIO, DiskIOStats{
+					Name:       name,
+					ReadBytes:  io.ReadBytes,
+					WriteBytes: io.WriteBytes,
+					ReadCount:  io.ReadCount,
+					WriteCount: io.WriteCount,
 				})
 			}
+			sort.Slice(stats.DiskIO, func(i, j int) bool { return stats.DiskIO[i].Name < stats.DiskIO[j].Name })
+		}
+	}
+
+	if enabled[CollectNetwork] {
+		if interfaces, err := networkInterfaces(); err == nil {
+			stats.Network.Interfaces = interfaces
+			for _, iface := range interfaces {
+				stats.Network.BytesSent += iface.BytesSent
+				stats.Network.BytesRecv += iface.BytesRecv
+				stats.Network.PacketsSent += iface.PacketsSent
+				stats.Network.PacketsRecv += iface.PacketsRecv
+			}
 		}
 	}
 
-	// Network
-	netIO, err := net.IOCounters(false)
-	if err == nil && len(netIO) > 0 {
-		stats.Network = NetworkStats{
-			BytesSent:   netIO[0].BytesSent,
-			BytesRecv:   netIO[0].BytesRecv,
-			PacketsSent: netIO[0].PacketsSent,
-			PacketsRecv: netIO[0].PacketsRecv,
+	applyRates(stats, now)
+
+	// Partial readings come with a warning error
+	if enabled[CollectTemperatures] {
+		sensors, _ := host.SensorsTemperatures()
+		for _, s := range sensors {
+			stats.Temperatures = append(stats.Temperatures, TemperatureStats{
+				Sensor:      s.SensorKey,
+				Temperature: s.Temperature,
+				High:        s.High,
+				Critical:    s.Critical,
+			})
 		}
 	}
 
-	// Host Info
-	hostInfo, err := host.Info()
-	if err == nil {
-		stats.Host = HostInfo{
-			Hostname:        hostInfo.Hostname,
-			OS:              hostInfo.OS,
-			Platform:        hostInfo.Platform,
-			PlatformVersion: hostInfo.PlatformVersion,
-			KernelArch:      hostInfo.KernelArch,
-			Uptime:          hostInfo.Uptime,
-			BootTime:        hostInfo.BootTime,
+	if enabled[CollectHost] {
+		if hostInfo, err := host.Info(); err == nil {
+			stats.Host = HostInfo{
+				Hostname:        hostInfo.Hostname,
+				OS:              hostInfo.OS,
+				Platform:        hostInfo.Platform,
+				PlatformVersion: hostInfo.PlatformVersion,
+				KernelArch:      hostInfo.KernelArch,
+				Uptime:          hostInfo.Uptime,
+				BootTime:        hostInfo.BootTime,
+			}
 		}
 	}
 
-	return stats, nil
+	return stats
+}
+
+func diskUsage() []DiskStats {
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		return nil
+	}
+
+	var disks []DiskStats
+	for _, partition := range partitions {
+		usage, err := disk.Usage(partition.Mountpoint)
+		if err != nil {
+			continue
+		}
+		disks = append(disks, DiskStats{
+			Device:            partition.Device,
+			Mountpoint:        partition.Mountpoint,
+			Total:             usage.Total,
+			Used:              usage.Used,
+			Free:              usage.Free,
+			UsedPercent:       usage.UsedPercent,
+			InodesTotal:       usage.InodesTotal,
+			InodesUsed:        usage.InodesUsed,
+			InodesFree:        usage.InodesFree,
+			InodesUsedPercent: usage.InodesUsedPercent,
+		})
+	}
+	return disks
+}
+
+// applyRates fills in per-second rates against the counters of the previous
+// sample and remembers the current ones. The first sample has no rates.
+func applyRates(stats *SystemStats, now time.Time) {
+	current := &counters{
+		at:         now,
+		interfaces: make(map[string]InterfaceStats, len(stats.Network.Interfaces)),
+		disks:      make(map[string]DiskIOStats, len(stats.DiskIO)),
+	}
+	for _, iface := range stats.Network.Interfaces {
+		current.interfaces[iface.Name] = iface
+	}
+	for _, d := range stats.DiskIO {
+		current.disks[d.Name] = d
+	}
+
+	countersMu.Lock()
+	prev := previous
+	previous = current
+	countersMu.Unlock()
+
+	if prev == nil {
+		return
+	}
+	seconds := now.Sub(prev.at).Seconds()
+	if seconds <= 0 {
+		return
+	}
+
+	for i := range stats.Network.Interfaces {
+		iface := &stats.Network.Interfaces[i]
+		last, ok := prev.interfaces[iface.Name]
+		if !ok {
+			continue
+		}
+		iface.BytesSentPerSec = rate(iface.BytesSent, last.BytesSent, seconds)
+		iface.BytesRecvPerSec = rate(iface.BytesRecv, last.BytesRecv, seconds)
+		iface.PacketsSentPerSec = rate(iface.PacketsSent, last.PacketsSent, seconds)
+		iface.PacketsRecvPerSec = rate(iface.PacketsRecv, last.PacketsRecv, seconds)
+
+		stats.Network.BytesSentPerSec += iface.BytesSentPerSec
+		stats.Network.BytesRecvPerSec += iface.BytesRecvPerSec
+		stats.Network.PacketsSentPerSec += iface.PacketsSentPerSec
+		stats.Network.PacketsRecvPerSec += iface.PacketsRecvPerSec
+	}
+
+	for i := range stats.DiskIO {
+		d := &stats.DiskIO[i]
+		last, ok := prev.disks[d.Name]
+		if !ok {
+			continue
+		}
+		d.ReadBytesPerSec = rate(d.ReadBytes, last.ReadBytes, seconds)
+		d.WriteBytesPerSec = rate(d.WriteBytes, last.WriteBytes, seconds)
+		d.ReadOpsPerSec = rate(d.ReadCount, last.ReadCount, seconds)
+		d.WriteOpsPerSec = rate(d.WriteCount, last.WriteCount, seconds)
+	}
+}
+
+// rate is the per-second change of a counter; a counter that went backwards
+// was reset and yields 0
+func rate(current, previous uint64, seconds float64) float64 {
+	if current < previous {
+		return 0
+	}
+	return float64(current-previous) / seconds
+}
+
+// networkInterfaces returns the counters of every network interface
+func networkInterfaces() ([]InterfaceStats, error) {
+	counters, err := net.IOCounters(true)
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := make([]InterfaceStats, 0, len(counters))
+	for _, c := range counters {
+		interfaces = append(interfaces, InterfaceStats{
+			Name:        c.Name,
+			BytesSent:   c.BytesSent,
+			BytesRecv:   c.BytesRecv,
+			PacketsSent: c.PacketsSent,
+			PacketsRecv: c.PacketsRecv,
+			Errin:       c.Errin,
+			Errout:      c.Errout,
+			Dropin:      c.Dropin,
+			Dropout:     c.Dropout,
+		})
+	}
+	return interfaces, nil
 }
@@ -0,0 +1,387 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// Process is a snapshot of one running process
+type Process struct {
+	PID        int32   `json:"pid"`
+	PPID       int32   `json:"ppid"`
+	Name       string  `json:"name"`
+	User       string  `json:"user"`
+	Cmdline    string  `json:"cmdline"`
+	Status     string  `json:"status"`
+	CPUPercent float64 `json:"cpu_percent"` // Since the previous snapshot, 100 per core
+	MemPercent float32 `json:"mem_percent"`
+	RSS        uint64  `json:"rss"`
+	VMS        uint64  `json:"vms"`
+	Nice       int32   `json:"nice"`
+	Threads    int32   `json:"threads"`
+	StartedAt  int64   `json:"started_at"` // Unix milliseconds
+	Ports      []Port  `json:"ports,omitempty"`
+}
+
+// Port is a socket a process listens on
+type Port struct {
+	Protocol string `json:"protocol"` // tcp, udp
+	Address  string `json:"address"`
+	Port     uint32 `json:"port"`
+}
+
+// Node is a process with its children, for the tree view
+type Node struct {
+	Process
+	Children []*Node `json:"children,omitempty"`
+}
+
+// Filter selects and orders processes
+type Filter struct {
+	Query string // Substring of the name or command line, case-insensitive
+	User  string
+	Sort  string // cpu, mem, rss, pid, name, user, started
+	Desc  bool
+	Limit int // 0 returns all
+}
+
+// primeDelay is how long a cold snapshot waits so CPU usage has an interval
+// to be measured over
+const primeDelay = 500 * time.Millisecond
+
+var (
+	mutex    sync.Mutex
+	tracked  = make(map[int32]*process.Process) // Kept between snapshots for CPU deltas
+	lastScan time.Time
+)
+
+// Snapshot lists every running process. CPU usage is measured since the
+// previous snapshot; when there is none recent enough, it waits briefly to
+// take a first measurement.
+func Snapshot() ([]Process, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if time.Since(lastScan) > time.Minute {
+		if _, err := refresh(); err != nil {
+			return nil, err
+		}
+		time.Sleep(primeDelay)
+	}
+	procs, err := refresh()
+	if err != nil {
+		return nil, err
+	}
+	lastScan = time.Now()
+
+	ports := listeningPorts()
+	list := make([]Process, 0, len(procs))
+	for _, p := range procs {
+		info, ok := describe(p)
+		if !ok {
+			continue
+		}
+		info.Ports = ports[p.Pid]
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+// refresh updates the tracked processes and measures their CPU usage.
+// mutex must be held.
+func refresh() ([]*process.Process, error) {
+	pids, err := process.Pids()
+	if err != nil {
+		return nil, err
+	}
+
+	alive := make(map[int32]*process.Process, len(pids))
+	for _, pid := range pids {
+		p, ok := tracked[pid]
+		if !ok {
+			if p, err = process.NewProcess(pid); err != nil {
+				continue
+			}
+		}
+		alive[pid] = p
+	}
+	tracked = alive
+
+	procs := make([]*process.Process, 0, len(alive))
+	for _, p := range alive {
+		procs = append(procs, p)
+	}
+	return procs, nil
+}
+
+// describe reads a process's details; it reports false once the process
+// has exited
+func describe(p *process.Process) (Process, bool) {
+	cpu, err := p.Percent(0)
+	if err != nil {
+		return Process{}, false
+	}
+
+	info := Process{PID: p.Pid, CPUPercent: cpu}
+	info.Name, _ = p.Name()
+	info.PPID, _ = p.Ppid()
+	info.User, _ = p.Username()
+	info.Cmdline, _ = p.Cmdline()
+	info.MemPercent, _ = p.MemoryPercent()
+	if nice, err := p.Nice(); err == nil {
+		info.Nice = nice
+		// gopsutil passes on the raw getpriority syscall, which is 20 - nice
+		if runtime.GOOS == "linux" {
+			info.Nice = 20 - nice
+		}
+	}
+	info.Threads, _ = p.NumThreads()
+	info.StartedAt, _ = p.CreateTime()
+	if status, err := p.Status(); err == nil && len(status) > 0 {
+		info.Status = status[0]
+	}
+	if mem, err := p.MemoryInfo(); err == nil {
+		info.RSS = mem.RSS
+		info.VMS = mem.VMS
+	}
+	return info, true
+}
+
+// listeningPorts maps PIDs to the TCP sockets they listen on and the UDP
+// sockets they have bound
+func listeningPorts() map[int32][]Port {
+	ports := make(map[int32][]Port)
+	conns, err := net.Connections("inet")
+	if err != nil {
+		return ports
+	}
+
+	for _, c := range conns {
+		if c.Pid == 0 {
+			continue
+		}
+		protocol := "tcp"
+		switch c.Type {
+		case syscall.SOCK_STREAM:
+			if c.Status != "LISTEN" {
+				continue
+			}
+		case syscall.SOCK_DGRAM:
+			if c.Raddr.Port != 0 {
+				continue
+			}
+			protocol = "udp"
+		default:
+			continue
+		}
+		ports[c.Pid] = append(ports[c.Pid], Port{Protocol: protocol, Address: c.Laddr.IP, Port: c.Laddr.Port})
+	}
+	return ports
+}
+
+// List returns the processes matching a filter, sorted
+func List(filter Filter) ([]Process, error) {
+	procs, err := Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return Apply(procs, filter), nil
+}
+
+// Apply filters, sorts and limits a snapshot
+func Apply(procs []Process, filter Filter) []Process {
+	query := strings.ToLower(filter.Query)
+	matched := make([]Process, 0, len(procs))
+	for _, p := range procs {
+		if filter.User != "" && p.User != filter.User {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(p.Name), query) && !strings.Contains(strings.ToLower(p.Cmdline), query) {
+			continue
+		}
+		matched = append(matched, p)
+	}
+
+	less := sortFunc(filter.Sort)
+	sort.SliceStable(matched, func(i, j int) bool {
+		if filter.Desc {
+			return less(matched[j], matched[i])
+		}
+		return less(matched[i], matched[j])
+	})
+
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched
+}
+
+func sortFunc(key string) func(a, b Process) bool {
+	switch key {
+	case "cpu":
+		return func(a, b Process) bool { return a.CPUPercent < b.CPUPercent }
+	case "mem":
+		return func(a, b Process) bool { return a.MemPercent < b.MemPercent }
+	case "rss":
+		return func(a, b Process) bool { return a.RSS < b.RSS }
+	case "name":
+		return func(a, b Process) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }
+	case "user":
+		return func(a, b Process) bool { return a.User < b.User }
+	case "started":
+		return func(a, b Process) bool { return a.StartedAt < b.StartedAt }
+	}
+	return func(a, b Process) bool { return a.PID < b.PID }
+}
+
+// ValidSort reports whether key is a sort key Apply understands
+func ValidSort(key string) bool {
+	switch key {
+	case "", "cpu", "mem", "rss", "pid", "name", "user", "started":
+		return true
+	}
+	return false
+}
+
+// Tree arranges processes under their parents. Processes whose parent isn't
+// in the list become roots.
+func Tree(procs []Process) []*Node {
+	nodes := make(map[int32]*Node, len(procs))
+	for _, p := range procs {
+		nodes[p.PID] = &Node{Process: p}
+	}
+
+	var roots []*Node
+	for _, p := range procs {
+		node := nodes[p.PID]
+		if parent, ok := nodes[p.PPID]; ok && p.PPID != p.PID {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	var sortNodes func([]*Node)
+	sortNodes = func(list []*Node) {
+		sort.Slice(list, func(i, j int) bool { return list[i].PID < list[j].PID })
+		for _, n := range list {
+			sortNodes(n.Children)
+		}
+	}
+	sortNodes(roots)
+	return roots
+}
+
+// Get returns one process
+func Get(pid int32) (*Process, error) {
+	procs, err := Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range procs {
+		if p.PID == pid {
+			return &p, nil
+		}
+	}
+	return nil, fmt.Errorf("process %d not found", pid)
+}
+
+// checkTarget refuses PIDs that must never be signalled or reniced from the
+// panel: init and the panel itself
+func checkTarget(pid int32) (*process.Process, error) {
+	if pid <= 1 {
+		return nil, fmt.Errorf("refusing to touch process %d", pid)
+	}
+	if int(pid) == os.Getpid() {
+		return nil, fmt.Errorf("refusing to touch the panel's own process")
+	}
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return nil, fmt.Errorf("process %d not found", pid)
+	}
+	return p, nil
+}
+
+// Signal sends TERM, KILL or HUP to a process
+func Signal(pid int32, signal string) error {
+	p, err := checkTarget(pid)
+	if err != nil {
+		return err
+	}
+
+	switch strings.TrimPrefix(strings.ToUpper(signal), "SIG") {
+	case "TERM":
+		return p.Terminate()
+	case "KILL":
+		return p.Kill()
+	case "HUP":
+		if runtime.GOOS == "windows" {
+			return fmt.Errorf("HUP is not supported on Windows")
+		}
+		return p.SendSignal(syscall.SIGHUP)
+	}
+	return fmt.Errorf("signal must be TERM, KILL or HUP")
+}
+
+// Renice changes a process's scheduling priority (-20 highest to 19 lowest)
+func Renice(pid int32, nice int) error {
+	if nice < -20 || nice > 19 {
+		return fmt.Errorf("nice must be between -20 and 19")
+	}
+	if _, err := checkTarget(pid); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		return fmt.Errorf("renice is not supported on Windows")
+	}
+
+	output, err := exec.Command("renice", "-n", strconv.Itoa(nice), "-p", strconv.Itoa(int(pid))).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("renice failed: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// FindOldest returns the PID of the oldest process whose command line
+// contains pattern, or 0 if none does
+func FindOldest(pattern string) int {
+	procs, err := process.Processes()
+	if err != nil {
+		return 0
+	}
+
+	self := int32(os.Getpid())
+	var pid int32
+	var oldest int64
+	for _, p := range procs {
+		if p.Pid == self {
+			continue
+		}
+		cmdline, err := p.Cmdline()
+		if err != nil || cmdline == "" {
+			cmdline, _ = p.Name()
+		}
+		if !strings.Contains(cmdline, pattern) {
+			continue
+		}
+		created, err := p.CreateTime()
+		if err != nil {
+			continue
+		}
+		if pid == 0 || created < oldest {
+			pid, oldest = p.Pid, created
+		}
+	}
+	return int(pid)
+}
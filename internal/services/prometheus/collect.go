@@ -0,0 +1,216 @@
+package prometheus
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"vps-panel/internal/services/appstore"
+	"vps-panel/internal/services/cron"
+	"vps-panel/internal/services/monitor"
+	"vps-panel/internal/services/terminal"
+)
+
+// Write collects every metric and writes it in the text exposition format
+func Write(out io.Writer) error {
+	bw := bufio.NewWriter(out)
+	w := &writer{w: bw}
+
+	writeHost(w)
+	writeServices(w)
+	writeContainers(w)
+	writeCron(w)
+	writePanel(w)
+	writeRequests(w)
+
+	return bw.Flush()
+}
+
+func writeHost(w *writer) {
+	stats, err := monitor.GetSystemStats()
+	if err != nil {
+		return
+	}
+
+	w.gauge("vpspanel_cpu_usage_percent", "Total CPU usage.", stats.CPU.UsagePercent)
+	w.gauge("vpspanel_cpu_cores", "Number of logical CPUs.", float64(stats.CPU.Cores))
+	w.family("vpspanel_cpu_core_usage_percent", "gauge", "CPU usage per logical CPU.")
+	for i, v := range stats.CPU.PerCore {
+		w.sample("vpspanel_cpu_core_usage_percent", Labels{"core": strconv.Itoa(i)}, v)
+	}
+
+	w.gauge("vpspanel_load1", "1-minute load average.", stats.Load.Load1)
+	w.gauge("vpspanel_load5", "5-minute load average.", stats.Load.Load5)
+	w.gauge("vpspanel_load15", "15-minute load average.", stats.Load.Load15)
+
+	w.gauge("vpspanel_memory_total_bytes", "Total physical memory.", float64(stats.Memory.Total))
+	w.gauge("vpspanel_memory_used_bytes", "Used physical memory.", float64(stats.Memory.Used))
+	w.gauge("vpspanel_memory_free_bytes", "Free physical memory.", float64(stats.Memory.Free))
+	w.gauge("vpspanel_memory_used_percent", "Used physical memory as a percentage.", stats.Memory.UsedPercent)
+
+	w.gauge("vpspanel_swap_total_bytes", "Total swap space.", float64(stats.Swap.Total))
+	w.gauge("vpspanel_swap_used_bytes", "Used swap space.", float64(stats.Swap.Used))
+	w.gauge("vpspanel_swap_free_bytes", "Free swap space.", float64(stats.Swap.Free))
+
+	disks := []struct {
+		name, help string
+		value      func(monitor.DiskStats) float64
+	}{
+		{"vpspanel_disk_total_bytes", "Size of the filesystem.", func(d monitor.DiskStats) float64 { return float64(d.Total) }},
+		{"vpspanel_disk_used_bytes", "Used space on the filesystem.", func(d monitor.DiskStats) float64 { return float64(d.Used) }},
+		{"vpspanel_disk_free_bytes", "Free space on the filesystem.", func(d monitor.DiskStats) float64 { return float64(d.Free) }},
+		{"vpspanel_disk_used_percent", "Used space on the filesystem as a percentage.", func(d monitor.DiskStats) float64 { return d.UsedPercent }},
+		{"vpspanel_disk_inodes_total", "Inodes on the filesystem.", func(d monitor.DiskStats) float64 { return float64(d.InodesTotal) }},
+		{"vpspanel_disk_inodes_used", "Used inodes on the filesystem.", func(d monitor.DiskStats) float64 { return float64(d.InodesUsed) }},
+		{"vpspanel_disk_inodes_free", "Free inodes on the filesystem.", func(d monitor.DiskStats) float64 { return float64(d.InodesFree) }},
+	}
+	for _, m := range disks {
+		w.family(m.name, "gauge", m.help)
+		for _, d := range stats.Disk {
+			w.sample(m.name, Labels{"device": d.Device, "mountpoint": d.Mountpoint}, m.value(d))
+		}
+	}
+
+	diskIO := []struct {
+		name, help string
+		value      func(monitor.DiskIOStats) uint64
+	}{
+		{"vpspanel_disk_read_bytes_total", "Bytes read from the device.", func(d monitor.DiskIOStats) uint64 { return d.ReadBytes }},
+		{"vpspanel_disk_written_bytes_total", "Bytes written to the device.", func(d monitor.DiskIOStats) uint64 { return d.WriteBytes }},
+		{"vpspanel_disk_reads_completed_total", "Reads completed on the device.", func(d monitor.DiskIOStats) uint64 { return d.ReadCount }},
+		{"vpspanel_disk_writes_completed_total", "Writes completed on the device.", func(d monitor.DiskIOStats) uint64 { return d.WriteCount }},
+	}
+	for _, m := range diskIO {
+		w.family(m.name, "counter", m.help)
+		for _, d := range stats.DiskIO {
+			w.sample(m.name, Labels{"device": d.Name}, float64(m.value(d)))
+		}
+	}
+
+	network := []struct {
+		name, help string
+		value      func(monitor.InterfaceStats) uint64
+	}{
+		{"vpspanel_network_receive_bytes_total", "Bytes received.", func(i monitor.InterfaceStats) uint64 { return i.BytesRecv }},
+		{"vpspanel_network_transmit_bytes_total", "Bytes sent.", func(i monitor.InterfaceStats) uint64 { return i.BytesSent }},
+		{"vpspanel_network_receive_packets_total", "Packets received.", func(i monitor.InterfaceStats) uint64 { return i.PacketsRecv }},
+		{"vpspanel_network_transmit_packets_total", "Packets sent.", func(i monitor.InterfaceStats) uint64 { return i.PacketsSent }},
+		{"vpspanel_network_receive_errors_total", "Receive errors.", func(i monitor.InterfaceStats) uint64 { return i.Errin }},
+		{"vpspanel_network_transmit_errors_total", "Transmit errors.", func(i monitor.InterfaceStats) uint64 { return i.Errout }},
+		{"vpspanel_network_receive_drop_total", "Received packets dropped.", func(i monitor.InterfaceStats) uint64 { return i.Dropin }},
+		{"vpspanel_network_transmit_drop_total", "Sent packets dropped.", func(i monitor.InterfaceStats) uint64 { return i.Dropout }},
+	}
+	for _, m := range network {
+		w.family(m.name, "counter", m.help)
+		for _, iface := range stats.Network.Interfaces {
+			w.sample(m.name, Labels{"interface": iface.Name}, float64(m.value(iface)))
+		}
+	}
+
+	w.family("vpspanel_temperature_celsius", "gauge", "Hardware sensor temperature.")
+	for _, t := range stats.Temperatures {
+		w.sample("vpspanel_temperature_celsius", Labels{"sensor": t.Sensor}, t.Temperature)
+	}
+
+	w.family("vpspanel_host_info", "gauge", "Host details, always 1.")
+	w.sample("vpspanel_host_info", Labels{
+		"hostname":         stats.Host.Hostname,
+		"os":               stats.Host.OS,
+		"platform":         stats.Host.Platform,
+		"platform_version": stats.Host.PlatformVersion,
+		"kernel_arch":      stats.Host.KernelArch,
+	}, 1)
+	w.gauge("vpspanel_host_boot_time_seconds", "Unix time the host booted.", float64(stats.Host.BootTime))
+	w.gauge("vpspanel_host_uptime_seconds", "Seconds since the host booted.", float64(stats.Host.Uptime))
+}
+
+func writeServices(w *writer) {
+	w.family("vpspanel_service_up", "gauge", "Whether an installed service is running.")
+	for _, inst := range appstore.GetInstalledPortablePackages() {
+		pkgID, _ := inst["package_id"].(string)
+		version, _ := inst["version"].(string)
+		status, err := appstore.GetServiceStatus(pkgID, version)
+		if err != nil {
+			continue
+		}
+		w.sample("vpspanel_service_up", Labels{
+			"package": pkgID,
+			"name":    status.Name,
+			"version": version,
+		}, boolValue(status.Running))
+	}
+}
+
+func writeContainers(w *writer) {
+	output, err := exec.Command("docker", "ps", "-a", "--format", "{{json .}}").Output()
+	w.gauge("vpspanel_docker_up", "Whether the Docker daemon answered.", boolValue(err == nil))
+	if err != nil {
+		return
+	}
+
+	w.family("vpspanel_container_state", "gauge", "Container state, 1 for the current state.")
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		var c struct {
+			Names string
+			Image string
+			State string
+		}
+		if line == "" || json.Unmarshal([]byte(line), &c) != nil {
+			continue
+		}
+		w.sample("vpspanel_container_state", Labels{
+			"name":  strings.TrimPrefix(c.Names, "/"),
+			"image": c.Image,
+			"state": c.State,
+		}, 1)
+	}
+}
+
+func writeCron(w *writer) {
+	jobs, err := cron.GetJobs()
+	if err != nil {
+		return
+	}
+
+	w.family("vpspanel_cron_job_enabled", "gauge", "Whether a cron job is scheduled.")
+	for _, job := range jobs {
+		w.sample("vpspanel_cron_job_enabled", cronLabels(job.ID, job.Name), boolValue(job.Enabled))
+	}
+
+	ran := jobs[:0]
+	for _, job := range jobs {
+		if job.LastRun != nil {
+			ran = append(ran, job)
+		}
+	}
+
+	w.family("vpspanel_cron_job_last_success", "gauge", "Whether the last run of a cron job succeeded.")
+	for _, job := range ran {
+		w.sample("vpspanel_cron_job_last_success", cronLabels(job.ID, job.Name), boolValue(job.LastStatus == "success"))
+	}
+	w.family("vpspanel_cron_job_last_run_timestamp_seconds", "gauge", "Unix time of the last run of a cron job.")
+	for _, job := range ran {
+		w.sample("vpspanel_cron_job_last_run_timestamp_seconds", cronLabels(job.ID, job.Name), float64(job.LastRun.Unix()))
+	}
+	w.family("vpspanel_cron_job_last_duration_seconds", "gauge", "Duration of the last run of a cron job.")
+	for _, job := range ran {
+		w.sample("vpspanel_cron_job_last_duration_seconds", cronLabels(job.ID, job.Name), job.LastDuration)
+	}
+}
+
+func cronLabels(id uint, name string) Labels {
+	return Labels{"id": strconv.Itoa(int(id)), "name": name}
+}
+
+func writePanel(w *writer) {
+	w.gauge("vpspanel_terminal_sessions", "Running terminal sessions.", float64(terminal.Count()))
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	w.gauge("vpspanel_go_goroutines", "Goroutines in the panel process.", float64(runtime.NumGoroutine()))
+	w.gauge("vpspanel_go_heap_alloc_bytes", "Heap bytes allocated by the panel process.", float64(mem.HeapAlloc))
+}
@@ -0,0 +1,84 @@
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Labels are the label pairs of one sample
+type Labels map[string]string
+
+// writer emits the Prometheus text exposition format (version 0.0.4)
+type writer struct {
+	w io.Writer
+}
+
+// family writes the HELP and TYPE lines that start a metric family
+func (w *writer) family(name, typ, help string) {
+	fmt.Fprintf(w.w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, typ)
+}
+
+// sample writes one sample line
+func (w *writer) sample(name string, labels Labels, value float64) {
+	io.WriteString(w.w, name)
+	if len(labels) > 0 {
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		io.WriteString(w.w, "{")
+		for i, k := range keys {
+			if i > 0 {
+				io.WriteString(w.w, ",")
+			}
+			fmt.Fprintf(w.w, `%s="%s"`, k, escapeLabel(labels[k]))
+		}
+		io.WriteString(w.w, "}")
+	}
+	fmt.Fprintf(w.w, " %s\n", formatValue(value))
+}
+
+// gauge writes a family with a single unlabelled sample
+func (w *writer) gauge(name, help string, value float64) {
+	w.family(name, "gauge", help)
+	w.sample(name, nil, value)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// boolValue maps true to 1 and false to 0
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,100 @@
+package prometheus
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request duration
+// histogram
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	method string
+	route  string
+	status int
+}
+
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+var (
+	requestsMu sync.Mutex
+	requests   = make(map[requestKey]*histogram)
+)
+
+// ObserveRequest records the duration of an HTTP request. The route is the
+// registered pattern (e.g. /api/users/:id), not the raw path, so that IDs
+// don't create a series each.
+func ObserveRequest(method, route string, status int, d time.Duration) {
+	seconds := d.Seconds()
+	key := requestKey{method: method, route: route, status: status}
+
+	requestsMu.Lock()
+	defer requestsMu.Unlock()
+
+	h, ok := requests[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		requests[key] = h
+	}
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// writeRequests writes the request duration histogram
+func writeRequests(w *writer) {
+	requestsMu.Lock()
+	defer requestsMu.Unlock()
+
+	keys := make([]requestKey, 0, len(requests))
+	for k := range requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	const name = "vpspanel_http_request_duration_seconds"
+	w.family(name, "histogram", "Duration of HTTP requests handled by the panel.")
+	for _, k := range keys {
+		h := requests[k]
+		labels := Labels{"method": k.method, "route": k.route, "status": strconv.Itoa(k.status)}
+
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			w.sample(name+"_bucket", withLabel(labels, "le", formatValue(bound)), float64(cumulative))
+		}
+		w.sample(name+"_bucket", withLabel(labels, "le", "+Inf"), float64(h.count))
+		w.sample(name+"_sum", labels, h.sum)
+		w.sample(name+"_count", labels, float64(h.count))
+	}
+}
+
+// withLabel returns a copy of labels with one more pair
+func withLabel(labels Labels, key, value string) Labels {
+	out := make(Labels, len(labels)+1)
+	for k, v := range labels {
+		out[k] = v
+	}
+	out[key] = value
+	return out
+}
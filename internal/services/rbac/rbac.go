@@ -0,0 +1,189 @@
+package rbac
+
+import (
+	"log"
+	"strings"
+
+	"vps-panel/internal/database"
+	"vps-panel/internal/models"
+)
+
+// Permissions, one read/write pair per module
+const (
+	DashboardView = "dashboard:view"
+
+	AppStoreRead    = "appstore:read"
+	AppStoreInstall = "appstore:install"
+
+	ServicesRead   = "services:read"
+	ServicesManage = "services:manage"
+
+	WebServerRead   = "webserver:read"
+	WebServerManage = "webserver:manage"
+
+	DatabaseRead   = "database:read"
+	DatabaseManage = "database:manage"
+
+	FilesRead  = "files:read"
+	FilesWrite = "files:write"
+
+	CronRead   = "cron:read"
+	CronManage = "cron:manage"
+
+	FirewallRead   = "firewall:read"
+	FirewallManage = "firewall:manage"
+
+	DockerRead   = "docker:read"
+	DockerManage = "docker:manage"
+
+	ProcessesRead   = "processes:read"
+	ProcessesManage = "processes:manage" // Signal and renice
+
+	TerminalOpen       = "terminal:open"        // Shell on the host as the panel's user
+	TerminalSwitchUser = "terminal:switch_user" // Host shell as another Unix user
+	TerminalDocker     = "terminal:docker"      // Shell inside a running container
+	TerminalRecordings = "terminal:recordings"
+
+	UsersManage = "users:manage"
+
+	AuditRead = "audit:read"
+
+	AlertsRead   = "alerts:read"
+	AlertsManage = "alerts:manage"
+
+	TasksRead   = "tasks:read"   // Everyone's background tasks; your own are always visible
+	TasksManage = "tasks:manage" // Cancel other users' tasks
+
+	All = "*"
+)
+
+// AllPermissions lists every known permission
+var AllPermissions = []string{
+	DashboardView,
+	AppStoreRead, AppStoreInstall,
+	ServicesRead, ServicesManage,
+	WebServerRead, WebServerManage,
+	DatabaseRead, DatabaseManage,
+	FilesRead, FilesWrite,
+	CronRead, CronManage,
+	FirewallRead, FirewallManage,
+	DockerRead, DockerManage,
+	ProcessesRead, ProcessesManage,
+	TerminalOpen, TerminalSwitchUser, TerminalDocker, TerminalRecordings,
+	UsersManage,
+	AuditRead,
+	AlertsRead, AlertsManage,
+	TasksRead, TasksManage,
+}
+
+// Built-in roles
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleReadOnly = "readonly"
+
+	// RoleLegacyUser is what accounts were given before roles existed
+	RoleLegacyUser = "user"
+)
+
+// defaultRoles are seeded on first start; edits made later are kept
+func defaultRoles() []models.Role {
+	var readOnly, operator []string
+	for _, perm := range AllPermissions {
+		if perm == DashboardView || strings.HasSuffix(perm, ":read") {
+			readOnly = append(readOnly, perm)
+		}
+		// Operators run the server but can't manage users or the firewall,
+		// or watch other people's terminal sessions
+		if perm != UsersManage && perm != FirewallManage && perm != TerminalRecordings {
+			operator = append(operator, perm)
+		}
+	}
+
+	return []models.Role{
+		{Name: RoleAdmin, Description: "Full access", Permissions: []string{All}},
+		{Name: RoleOperator, Description: "Manage apps, services, sites, databases, files, Docker and the terminal", Permissions: operator},
+		{Name: RoleReadOnly, Description: "View everything, change nothing", Permissions: readOnly},
+	}
+}
+
+// Init seeds the built-in roles
+func Init() {
+	for _, role := range defaultRoles() {
+		var count int64
+		database.DB.Model(&models.Role{}).Where("name = ?", role.Name).Count(&count)
+		if count > 0 {
+			continue
+		}
+		if err := database.DB.Create(&role).Error; err != nil {
+			log.Printf("Failed to seed role %s: %v", role.Name, err)
+		}
+	}
+	seedLegacyRole()
+}
+
+// seedLegacyRole keeps accounts from before roles existed working. They
+// had the old default role "user", which could use every module; without a
+// matching role they would get no permissions at all. User management, the
+// audit log and terminal recordings came with roles and stay admin-only.
+func seedLegacyRole() {
+	var users int64
+	database.DB.Model(&models.User{}).Where("role = ?", RoleLegacyUser).Count(&users)
+	if users == 0 || RoleExists(RoleLegacyUser) {
+		return
+	}
+
+	var perms []string
+	for _, perm := range AllPermissions {
+		if perm != UsersManage && perm != AuditRead && perm != TerminalRecordings {
+			perms = append(perms, perm)
+		}
+	}
+	role := models.Role{
+		Name:        RoleLegacyUser,
+		Description: "Accounts created before roles existed, with their previous access",
+		Permissions: perms,
+	}
+	if err := database.DB.Create(&role).Error; err != nil {
+		log.Printf("Failed to seed role %s: %v", role.Name, err)
+		return
+	}
+	log.Printf("RBAC: %d accounts have the old role %q, seeded it with their previous access", users, RoleLegacyUser)
+}
+
+// GetRoles returns all roles
+func GetRoles() ([]models.Role, error) {
+	var roles []models.Role
+	err := database.DB.Order("id asc").Find(&roles).Error
+	return roles, err
+}
+
+// RoleExists reports whether a role is defined
+func RoleExists(name string) bool {
+	var count int64
+	database.DB.Model(&models.Role{}).Where("name = ?", name).Count(&count)
+	return count > 0
+}
+
+// Permissions returns the effective permissions of a role. Unknown roles get
+// none.
+func Permissions(roleName string) []string {
+	var role models.Role
+	if err := database.DB.Where("name = ?", roleName).First(&role).Error; err != nil {
+		return []string{}
+	}
+	if Has(role.Permissions, All) {
+		return append([]string{}, AllPermissions...)
+	}
+	return role.Permissions
+}
+
+// Has reports whether perms grants perm
+func Has(perms []string, perm string) bool {
+	for _, p := range perms {
+		if p == perm || p == All {
+			return true
+		}
+	}
+	return false
+}
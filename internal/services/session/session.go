@@ -0,0 +1,103 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"vps-panel/internal/config"
+	"vps-panel/internal/database"
+	"vps-panel/internal/models"
+)
+
+// touchInterval limits how often LastSeenAt is written
+const touchInterval = time.Minute
+
+// Create records a new session for the user and returns it
+func Create(userID uint, ip, userAgent string) (*models.Session, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	now := time.Now()
+	s := models.Session{
+		JTI:        hex.EncodeToString(buf),
+		UserID:     userID,
+		IP:         ip,
+		UserAgent:  userAgent,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(config.AppConfig.JWT.Expiry),
+	}
+	if err := database.DB.Create(&s).Error; err != nil {
+		return nil, err
+	}
+
+	// Prune expired sessions while we're here
+	database.DB.Where("expires_at <= ?", now).Delete(&models.Session{})
+
+	return &s, nil
+}
+
+// Validate reports whether the session behind a token is still active and
+// refreshes its last-seen time
+func Validate(jti string) bool {
+	if jti == "" {
+		return false
+	}
+
+	var s models.Session
+	if err := database.DB.Where("jti = ?", jti).First(&s).Error; err != nil {
+		return false
+	}
+
+	now := time.Now()
+	if now.After(s.ExpiresAt) {
+		return false
+	}
+	if now.Sub(s.LastSeenAt) > touchInterval {
+		database.DB.Model(&s).Update("last_seen_at", now)
+	}
+	return true
+}
+
+// List returns a user's active sessions, most recently used first
+func List(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := database.DB.Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at desc").Find(&sessions).Error
+	return sessions, err
+}
+
+// Revoke ends one of the user's sessions
+func Revoke(userID, id uint) error {
+	result := database.DB.Where("user_id = ?", userID).Delete(&models.Session{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("session not found")
+	}
+	return nil
+}
+
+// RevokeJTI ends the session behind a token
+func RevokeJTI(jti string) error {
+	return database.DB.Where("jti = ?", jti).Delete(&models.Session{}).Error
+}
+
+// RevokeAll ends all of a user's sessions except the one with exceptJTI, if
+// given, and returns how many were ended
+func RevokeAll(userID uint, exceptJTI string) (int64, error) {
+	query := database.DB.Where("user_id = ?", userID)
+	if exceptJTI != "" {
+		query = query.Where("jti <> ?", exceptJTI)
+	}
+	result := query.Delete(&models.Session{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,64 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// ticketTTL is how long a WebSocket ticket can be redeemed
+const ticketTTL = 30 * time.Second
+
+// Ticket lets a client that can't send the session cookie open a WebSocket.
+// It carries the identity of the REST call that issued it and works once.
+type Ticket struct {
+	UserID      uint
+	Username    string
+	Role        string
+	Permissions []string
+	JTI         string
+	ExpiresAt   time.Time
+}
+
+var (
+	tickets  = map[string]Ticket{}
+	ticketMu sync.Mutex
+)
+
+// IssueTicket stores a ticket and returns its value
+func IssueTicket(t Ticket) (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	value := hex.EncodeToString(buf)
+
+	ticketMu.Lock()
+	defer ticketMu.Unlock()
+
+	now := time.Now()
+	for k, old := range tickets {
+		if now.After(old.ExpiresAt) {
+			delete(tickets, k)
+		}
+	}
+
+	t.ExpiresAt = now.Add(ticketTTL)
+	tickets[value] = t
+	return value, nil
+}
+
+// RedeemTicket consumes a ticket. It fails for unknown or expired tickets
+// and when the issuing session has been revoked since.
+func RedeemTicket(value string) (*Ticket, bool) {
+	ticketMu.Lock()
+	t, ok := tickets[value]
+	delete(tickets, value)
+	ticketMu.Unlock()
+
+	if !ok || time.Now().After(t.ExpiresAt) || !Validate(t.JTI) {
+		return nil, false
+	}
+	return &t, true
+}
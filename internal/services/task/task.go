@@ -0,0 +1,402 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"vps-panel/internal/config"
+	"vps-panel/internal/database"
+	"vps-panel/internal/models"
+	"vps-panel/internal/services/events"
+)
+
+// Task statuses
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSuccess   = "success"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+const (
+	// maxLog caps the output kept per task; older output is dropped
+	maxLog = 64 * 1024
+	// flushInterval limits how often progress of running tasks is saved
+	flushInterval = time.Second
+)
+
+// ErrDuplicate is returned when a task of the same type and target is
+// already queued or running; that task is returned alongside it
+var ErrDuplicate = errors.New("task already queued or running")
+
+// Func does the work of a task. It should stop when ctx is cancelled and
+// report through t.
+type Func func(ctx context.Context, t *Handle) error
+
+// Options describe a task to enqueue
+type Options struct {
+	Type     string
+	Title    string
+	Target   string // Empty targets are never treated as duplicates
+	UserID   uint
+	Username string
+}
+
+// Handle lets a running task report progress and output
+type Handle struct {
+	mutex  sync.Mutex
+	task   models.Task // Live copy, saved by the flush loop
+	dirty  bool
+	cancel context.CancelFunc
+
+	published struct {
+		status  string
+		percent int
+		message string
+	}
+}
+
+var (
+	mutex  sync.Mutex
+	active = make(map[uint]*Handle) // Queued and running tasks
+	slots  = make(map[string]chan struct{})
+)
+
+// Init fails tasks cut short by a restart and starts saving progress and
+// pruning old tasks
+func Init() {
+	now := time.Now()
+	result := database.DB.Model(&models.Task{}).
+		Where("status IN ?", []string{StatusQueued, StatusRunning}).
+		Updates(map[string]interface{}{
+			"status":      StatusFailed,
+			"error":       "Interrupted by a panel restart",
+			"finished_at": now,
+		})
+	if result.RowsAffected > 0 {
+		log.Printf("Tasks: %d interrupted tasks marked as failed", result.RowsAffected)
+	}
+
+	go flushLoop()
+	if config.AppConfig.Tasks.Retention > 0 {
+		go pruneLoop(config.AppConfig.Tasks.Retention)
+	}
+}
+
+// limit returns the slot semaphore of a task type
+func limit(taskType string) chan struct{} {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if ch, ok := slots[taskType]; ok {
+		return ch
+	}
+
+	cfg := config.AppConfig.Tasks
+	n, ok := cfg.Concurrency[taskType]
+	if !ok {
+		n = cfg.DefaultConcurrency
+	}
+	if n < 1 {
+		n = 1
+	}
+	ch := make(chan struct{}, n)
+	slots[taskType] = ch
+	return ch
+}
+
+// Enqueue records a task and runs fn once a slot for its type is free
+func Enqueue(opts Options, fn Func) (*models.Task, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if opts.Target != "" {
+		for _, h := range active {
+			h.mutex.Lock()
+			t := h.task
+			h.mutex.Unlock()
+			if t.Type == opts.Type && t.Target == opts.Target {
+				return &t, ErrDuplicate
+			}
+		}
+	}
+
+	t := models.Task{
+		Type:     opts.Type,
+		Title:    opts.Title,
+		Target:   opts.Target,
+		Status:   StatusQueued,
+		Message:  "Waiting to start...",
+		UserID:   opts.UserID,
+		Username: opts.Username,
+	}
+	if err := database.DB.Create(&t).Error; err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &Handle{task: t, cancel: cancel}
+	active[t.ID] = h
+	h.publish()
+
+	go run(ctx, h, fn)
+	return &t, nil
+}
+
+func run(ctx context.Context, h *Handle, fn Func) {
+	defer h.cancel()
+
+	slot := limit(h.task.Type)
+	select {
+	case slot <- struct{}{}:
+		defer func() { <-slot }()
+	case <-ctx.Done():
+	}
+	if ctx.Err() != nil {
+		// Cancelled while queued; select may still have picked the slot
+		h.finish(ctx.Err())
+		return
+	}
+
+	now := time.Now()
+	h.update(func(t *models.Task) {
+		t.Status = StatusRunning
+		t.Message = "Running..."
+		t.StartedAt = &now
+	})
+
+	h.finish(safeRun(ctx, h, fn))
+}
+
+// safeRun keeps a panicking task from taking the panel down
+func safeRun(ctx context.Context, h *Handle, fn Func) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task panicked: %v", r)
+		}
+	}()
+	err = fn(ctx, h)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// finish records the outcome, saves it and forgets the task
+func (h *Handle) finish(err error) {
+	now := time.Now()
+	h.update(func(t *models.Task) {
+		t.FinishedAt = &now
+		switch {
+		case errors.Is(err, context.Canceled):
+			t.Status = StatusCancelled
+			t.Message = "Cancelled"
+		case err != nil:
+			t.Status = StatusFailed
+			t.Error = err.Error()
+		default:
+			t.Status = StatusSuccess
+			t.Progress = 100
+		}
+	})
+
+	h.mutex.Lock()
+	t := h.task
+	h.dirty = false
+	h.mutex.Unlock()
+	if err := database.DB.Save(&t).Error; err != nil {
+		log.Printf("Tasks: saving task %d failed: %v", t.ID, err)
+	}
+
+	mutex.Lock()
+	delete(active, t.ID)
+	mutex.Unlock()
+}
+
+// update changes the live task and publishes it when something a viewer
+// would notice changed
+func (h *Handle) update(fn func(t *models.Task)) {
+	h.mutex.Lock()
+	fn(&h.task)
+	h.dirty = true
+	h.mutex.Unlock()
+	h.publish()
+}
+
+func (h *Handle) publish() {
+	h.mutex.Lock()
+	t := h.task
+	p := &h.published
+	percent := int(t.Progress)
+	changed := t.Status != p.status || percent != p.percent || t.Message != p.message
+	p.status, p.percent, p.message = t.Status, percent, t.Message
+	h.mutex.Unlock()
+
+	if changed {
+		t.Log = ""
+		events.Publish(events.TopicTask, t)
+	}
+}
+
+// ID returns the task's ID
+func (h *Handle) ID() uint {
+	return h.task.ID
+}
+
+// Progress sets the completion percentage and the current step
+func (h *Handle) Progress(percent float64, message string) {
+	h.update(func(t *models.Task) {
+		t.Progress = percent
+		if message != "" {
+			t.Message = message
+		}
+	})
+}
+
+// Logf appends a line to the task's output
+func (h *Handle) Logf(format string, args ...interface{}) {
+	h.Write([]byte(fmt.Sprintf(format, args...) + "\n"))
+}
+
+// Write appends command output to the task's output
+func (h *Handle) Write(p []byte) (int, error) {
+	h.mutex.Lock()
+	out := h.task.Log + string(p)
+	if len(out) > maxLog {
+		out = out[len(out)-maxLog:]
+	}
+	h.task.Log = out
+	h.dirty = true
+	h.mutex.Unlock()
+	return len(p), nil
+}
+
+// flushLoop saves the progress of running tasks so other requests and a
+// restart see it
+func flushLoop() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		mutex.Lock()
+		handles := make([]*Handle, 0, len(active))
+		for _, h := range active {
+			handles = append(handles, h)
+		}
+		mutex.Unlock()
+
+		for _, h := range handles {
+			h.mutex.Lock()
+			if !h.dirty || h.task.FinishedAt != nil {
+				h.mutex.Unlock()
+				continue
+			}
+			t := h.task
+			h.dirty = false
+			h.mutex.Unlock()
+
+			database.DB.Model(&models.Task{}).Where("id = ? AND finished_at IS NULL", t.ID).Updates(map[string]interface{}{
+				"status":     t.Status,
+				"progress":   t.Progress,
+				"message":    t.Message,
+				"log":        t.Log,
+				"started_at": t.StartedAt,
+			})
+		}
+	}
+}
+
+func pruneLoop(retention time.Duration) {
+	for {
+		cutoff := time.Now().Add(-retention)
+		result := database.DB.Where("finished_at IS NOT NULL AND finished_at < ?", cutoff).Delete(&models.Task{})
+		if result.Error != nil {
+			log.Printf("Tasks: pruning failed: %v", result.Error)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// Get returns a task, with live progress while it runs
+func Get(id uint) (*models.Task, error) {
+	mutex.Lock()
+	h, ok := active[id]
+	mutex.Unlock()
+	if ok {
+		h.mutex.Lock()
+		t := h.task
+		h.mutex.Unlock()
+		return &t, nil
+	}
+
+	var t models.Task
+	if err := database.DB.First(&t, id).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Filter narrows List; zero values match everything
+type Filter struct {
+	Type     string
+	Status   string
+	UserID   uint
+	Page     int
+	PageSize int
+}
+
+// List returns tasks newest first, without their output. Active tasks show
+// live progress.
+func List(f Filter) ([]models.Task, int64, error) {
+	query := database.DB.Model(&models.Task{})
+	if f.Type != "" {
+		query = query.Where("type = ?", f.Type)
+	}
+	if f.Status != "" {
+		query = query.Where("status = ?", f.Status)
+	}
+	if f.UserID != 0 {
+		query = query.Where("user_id = ?", f.UserID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var tasks []models.Task
+	err := query.Omit("log").Order("id desc").
+		Offset((f.Page - 1) * f.PageSize).Limit(f.PageSize).
+		Find(&tasks).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	mutex.Lock()
+	for i := range tasks {
+		if h, ok := active[tasks[i].ID]; ok {
+			h.mutex.Lock()
+			tasks[i] = h.task
+			h.mutex.Unlock()
+			tasks[i].Log = ""
+		}
+	}
+	mutex.Unlock()
+	return tasks, total, nil
+}
+
+// Cancel stops a queued or running task. It finishes as cancelled once its
+// work notices.
+func Cancel(id uint) error {
+	mutex.Lock()
+	h, ok := active[id]
+	mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("task is not queued or running")
+	}
+	h.cancel()
+	return nil
+}
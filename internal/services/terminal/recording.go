@@ -0,0 +1,264 @@
+package terminal
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"vps-panel/internal/config"
+	"vps-panel/internal/database"
+	"vps-panel/internal/models"
+)
+
+// Recorder writes a terminal session as an asciicast v2 file: a JSON header
+// line followed by one [time, code, data] event per line. Only output ("o")
+// and resize ("r") events are kept; input is not recorded so that passwords
+// typed at no-echo prompts stay out of the file.
+type Recorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	w       *bufio.Writer
+	start   time.Time
+	pending []byte      // Incomplete UTF-8 sequence held back from the last write
+	flush   *time.Timer // Pending flush of buffered events
+	closed  bool
+	record  models.TerminalRecording
+}
+
+// recordingFlushDelay bounds how long events sit in the buffer, so a live
+// recording can be replayed up to the last moment and a crash loses little
+const recordingFlushDelay = time.Second
+
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Command   string            `json:"command,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// initRecordings creates the recording directory and starts retention
+func initRecordings() {
+	if err := os.MkdirAll(config.AppConfig.Terminal.RecordingDir, 0700); err != nil {
+		log.Printf("Terminal: cannot create recording directory: %v", err)
+	}
+
+	// Sessions that were live when the panel stopped never got an end time
+	now := time.Now()
+	database.DB.Model(&models.TerminalRecording{}).Where("ended_at IS NULL").Update("ended_at", now)
+
+	go retentionLoop()
+}
+
+// NewRecorder starts recording a session. It returns nil when recording is
+// disabled; a nil Recorder ignores all calls.
+func NewRecorder(userID uint, username, ip, command string, cols, rows int) (*Recorder, error) {
+	if !config.AppConfig.Terminal.Record {
+		return nil, nil
+	}
+
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate recording name: %w", err)
+	}
+	start := time.Now()
+	name := fmt.Sprintf("%s-%s-%s.cast", start.Format("20060102-150405"), sanitizeName(username), hex.EncodeToString(buf))
+
+	file, err := os.OpenFile(filepath.Join(config.AppConfig.Terminal.RecordingDir, name), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		file:  file,
+		w:     bufio.NewWriter(file),
+		start: start,
+		record: models.TerminalRecording{
+			UserID:    userID,
+			Username:  username,
+			IP:        ip,
+			Command:   command,
+			File:      name,
+			StartedAt: start,
+		},
+	}
+
+	header, _ := json.Marshal(castHeader{
+		Version:   2,
+		Width:     cols,
+		Height:    rows,
+		Timestamp: start.Unix(),
+		Command:   command,
+		Title:     fmt.Sprintf("%s@%s", username, ip),
+		Env:       map[string]string{"TERM": "xterm-256color"},
+	})
+	r.w.Write(header)
+	r.w.WriteByte('\n')
+	r.w.Flush()
+
+	if err := database.DB.Create(&r.record).Error; err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return r, nil
+}
+
+// Output records data written to the terminal
+func (r *Recorder) Output(data []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// PTY reads can split multi-byte characters; hold the tail back
+	data = append(r.pending, data...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.pending = append([]byte(nil), data[cut:]...)
+	if cut > 0 {
+		r.event("o", string(data[:cut]))
+	}
+}
+
+// Resize records a terminal size change
+func (r *Recorder) Resize(cols, rows int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+func (r *Recorder) event(code, data string) {
+	line, _ := json.Marshal([]interface{}{
+		float64(time.Since(r.start).Microseconds()) / 1e6, code, data,
+	})
+	r.w.Write(line)
+	r.w.WriteByte('\n')
+
+	// Output comes in bursts; one flush covers the events that follow
+	if r.flush == nil {
+		r.flush = time.AfterFunc(recordingFlushDelay, r.flushEvents)
+	}
+}
+
+func (r *Recorder) flushEvents() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flush = nil
+	if !r.closed {
+		r.w.Flush()
+	}
+}
+
+// Close finishes the file and stores its duration and size
+func (r *Recorder) Close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pending) > 0 {
+		r.event("o", string(r.pending))
+		r.pending = nil
+	}
+	if r.flush != nil {
+		r.flush.Stop()
+		r.flush = nil
+	}
+	r.closed = true
+	r.w.Flush()
+
+	var size int64
+	if info, err := r.file.Stat(); err == nil {
+		size = info.Size()
+	}
+	r.file.Close()
+
+	now := time.Now()
+	database.DB.Model(&r.record).Updates(map[string]interface{}{
+		"ended_at": now,
+		"duration": now.Sub(r.start).Seconds(),
+		"size":     size,
+	})
+}
+
+// GetRecordings returns recordings, newest first, optionally for one user
+func GetRecordings(username string) ([]models.TerminalRecording, error) {
+	query := database.DB.Order("started_at desc")
+	if username != "" {
+		query = query.Where("username = ?", username)
+	}
+	var recordings []models.TerminalRecording
+	err := query.Find(&recordings).Error
+	return recordings, err
+}
+
+// RecordingPath returns the file of a recording
+func RecordingPath(id uint) (*models.TerminalRecording, string, error) {
+	var rec models.TerminalRecording
+	if err := database.DB.First(&rec, id).Error; err != nil {
+		return nil, "", fmt.Errorf("recording not found")
+	}
+	return &rec, filepath.Join(config.AppConfig.Terminal.RecordingDir, filepath.Base(rec.File)), nil
+}
+
+func retentionLoop() {
+	for {
+		pruneRecordings()
+		time.Sleep(time.Hour)
+	}
+}
+
+// pruneRecordings deletes finished recordings past the retention period
+func pruneRecordings() {
+	retention := config.AppConfig.Terminal.RecordingRetention
+	if retention <= 0 {
+		return
+	}
+
+	var old []models.TerminalRecording
+	database.DB.Where("ended_at IS NOT NULL AND started_at < ?", time.Now().Add(-retention)).Find(&old)
+	for _, rec := range old {
+		path := filepath.Join(config.AppConfig.Terminal.RecordingDir, filepath.Base(rec.File))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Terminal: failed to delete recording %s: %v", rec.File, err)
+			continue
+		}
+		database.DB.Delete(&rec)
+	}
+	if len(old) > 0 {
+		log.Printf("🎬 Deleted %d terminal recordings past retention", len(old))
+	}
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+func sanitizeName(name string) string {
+	if name == "" {
+		return "unknown"
+	}
+	return unsafeNameChars.ReplaceAllString(name, "_")
+}
@@ -0,0 +1,52 @@
+package terminal
+
+import "unicode/utf8"
+
+// scrollback keeps the last size bytes of terminal output in a ring
+type scrollback struct {
+	buf  []byte
+	pos  int  // Next write position
+	full bool // Whether buf has wrapped at least once
+}
+
+func newScrollback(size int) *scrollback {
+	if size <= 0 {
+		size = 64 * 1024
+	}
+	return &scrollback{buf: make([]byte, size)}
+}
+
+func (s *scrollback) Write(p []byte) {
+	if len(p) >= len(s.buf) {
+		copy(s.buf, p[len(p)-len(s.buf):])
+		s.pos = 0
+		s.full = true
+		return
+	}
+	n := copy(s.buf[s.pos:], p)
+	if n < len(p) {
+		copy(s.buf, p[n:])
+		s.full = true
+	}
+	s.pos = (s.pos + len(p)) % len(s.buf)
+	if s.pos == 0 && len(p) > 0 {
+		s.full = true
+	}
+}
+
+// Bytes returns a copy of the buffered output, oldest first. Once the ring
+// has wrapped, a leading partial UTF-8 character is dropped.
+func (s *scrollback) Bytes() []byte {
+	if !s.full {
+		return append([]byte(nil), s.buf[:s.pos]...)
+	}
+	out := make([]byte, 0, len(s.buf))
+	out = append(out, s.buf[s.pos:]...)
+	out = append(out, s.buf[:s.pos]...)
+	for i := 0; i < utf8.UTFMax && i < len(out); i++ {
+		if utf8.RuneStart(out[i]) {
+			return out[i:]
+		}
+	}
+	return out
+}
@@ -0,0 +1,393 @@
+package terminal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creack/pty"
+	"vps-panel/internal/config"
+	"vps-panel/internal/services/activity"
+)
+
+// Session is a shell running on a PTY. It outlives the WebSocket that
+// opened it, so a client can detach and reattach later; output produced in
+// between is kept in a scrollback buffer.
+type Session struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	Command   string    `json:"command"`
+	Target    Target    `json:"target"`
+	CreatedAt time.Time `json:"created_at"`
+
+	cmd  *exec.Cmd
+	ptmx *os.File
+	rec  *Recorder
+	done chan struct{}
+
+	mu           sync.Mutex
+	scrollback   *scrollback
+	clients      map[*Client]struct{}
+	shares       map[uint]Share
+	lastActivity time.Time
+}
+
+// Client is one attached viewer of a session
+type Client struct {
+	UserID   uint
+	Username string
+	send     chan Frame
+}
+
+// Frame is a message for a client: terminal output, or a JSON control
+// event when Event is set
+type Frame struct {
+	Data  []byte
+	Event bool
+}
+
+// Output delivers frames for the client. It is closed when the client is
+// detached, falls too far behind, loses access, or the session ends.
+func (cl *Client) Output() <-chan Frame {
+	return cl.send
+}
+
+// SessionInfo describes a session for listing
+type SessionInfo struct {
+	*Session
+	Mode         string    `json:"mode"` // The listing user's access
+	Shares       []Share   `json:"shares,omitempty"`
+	Viewers      []Viewer  `json:"viewers"`
+	LastActivity time.Time `json:"last_activity"`
+}
+
+var (
+	sessions   = make(map[string]*Session)
+	starting   = make(map[uint]int) // Sessions being started, by user
+	sessionsMu sync.Mutex
+)
+
+// Init prepares recordings and starts reaping idle sessions
+func Init() {
+	initRecordings()
+	go reapLoop()
+}
+
+// shellCommand picks the shell for new sessions
+func shellCommand() *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd.exe")
+	}
+	// Fallback to sh if bash not found
+	if _, err := exec.LookPath("bash"); err != nil {
+		return exec.Command("sh")
+	}
+	return exec.Command("bash")
+}
+
+// Create starts a new shell session for a user with the client's terminal
+// size, 80x24 when unknown. Permission to use the target is checked by the
+// caller. The attempt is audited before the shell starts, and so is a
+// failure.
+func Create(userID uint, username, ip, name string, target Target, cols, rows int) (*Session, error) {
+	fail := func(err error) (*Session, error) {
+		activity.Log(userID, username, ip, "terminal.open_failed", target.String(), err.Error())
+		return nil, err
+	}
+
+	// Reserve a slot under the same lock that registers the session, so
+	// concurrent opens cannot exceed the limit
+	sessionsMu.Lock()
+	count := starting[userID]
+	for _, s := range sessions {
+		if s.UserID == userID {
+			count++
+		}
+	}
+	if max := config.AppConfig.Terminal.MaxSessions; max > 0 && count >= max {
+		sessionsMu.Unlock()
+		return fail(fmt.Errorf("terminal session limit reached (%d), close one first", max))
+	}
+	starting[userID]++
+	sessionsMu.Unlock()
+
+	registered := false
+	defer func() {
+		if !registered {
+			sessionsMu.Lock()
+			releaseSlotLocked(userID)
+			sessionsMu.Unlock()
+		}
+	}()
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fail(err)
+	}
+	id := hex.EncodeToString(buf)
+	if name == "" {
+		name = fmt.Sprintf("Session %d", count+1)
+	}
+
+	cmd, err := target.command()
+	if err != nil {
+		return fail(err)
+	}
+	command := strings.Join(cmd.Args, " ")
+
+	if cols <= 0 || rows <= 0 || cols > math.MaxUint16 || rows > math.MaxUint16 {
+		cols, rows = 80, 24
+	}
+
+	activity.Log(userID, username, ip, "terminal.open", target.String(), command)
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Rows: uint16(rows), Cols: uint16(cols)})
+	if err != nil {
+		return fail(err)
+	}
+
+	rec, err := NewRecorder(userID, username, ip, command, cols, rows)
+	if err != nil {
+		log.Printf("Terminal: failed to start recording: %v", err)
+	}
+
+	s := &Session{
+		ID:           id,
+		Name:         name,
+		UserID:       userID,
+		Username:     username,
+		Command:      command,
+		Target:       target,
+		CreatedAt:    time.Now(),
+		cmd:          cmd,
+		ptmx:         ptmx,
+		rec:          rec,
+		done:         make(chan struct{}),
+		scrollback:   newScrollback(config.AppConfig.Terminal.Scrollback),
+		clients:      make(map[*Client]struct{}),
+		shares:       make(map[uint]Share),
+		lastActivity: time.Now(),
+	}
+
+	sessionsMu.Lock()
+	releaseSlotLocked(userID)
+	sessions[id] = s
+	registered = true
+	sessionsMu.Unlock()
+
+	go s.readLoop()
+	return s, nil
+}
+
+// releaseSlotLocked gives back a slot reserved by Create. The caller must
+// hold sessionsMu.
+func releaseSlotLocked(userID uint) {
+	if starting[userID]--; starting[userID] <= 0 {
+		delete(starting, userID)
+	}
+}
+
+// Get returns a running session by ID
+func Get(id string) *Session {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	return sessions[id]
+}
+
+// Count returns the number of running sessions
+func Count() int {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	return len(sessions)
+}
+
+// List returns the running sessions a user owns or has been invited to,
+// oldest first
+func List(userID uint) []SessionInfo {
+	sessionsMu.Lock()
+	var list []*Session
+	for _, s := range sessions {
+		if s.Access(userID) != "" {
+			list = append(list, s)
+		}
+	}
+	sessionsMu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	infos := make([]SessionInfo, 0, len(list))
+	for _, s := range list {
+		info := SessionInfo{Session: s, Mode: s.Access(userID), Viewers: s.Viewers()}
+		if info.Mode == ModeOwner {
+			info.Shares = s.Shares()
+		}
+		s.mu.Lock()
+		info.LastActivity = s.lastActivity
+		s.mu.Unlock()
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// readLoop copies PTY output to the scrollback, the recording and every
+// attached client until the shell exits
+func (s *Session) readLoop() {
+	buffer := make([]byte, 4096)
+	for {
+		n, err := s.ptmx.Read(buffer)
+		if err != nil {
+			break
+		}
+		data := append([]byte(nil), buffer[:n]...)
+		s.rec.Output(data)
+
+		s.mu.Lock()
+		s.scrollback.Write(data)
+		s.lastActivity = time.Now()
+		s.broadcastLocked(Frame{Data: data})
+		s.mu.Unlock()
+	}
+	s.end()
+}
+
+// end releases the session once the shell has exited or been killed
+func (s *Session) end() {
+	_ = s.cmd.Process.Kill()
+	_ = s.cmd.Wait()
+	_ = s.ptmx.Close()
+	s.rec.Close()
+
+	sessionsMu.Lock()
+	delete(sessions, s.ID)
+	sessionsMu.Unlock()
+
+	s.mu.Lock()
+	for cl := range s.clients {
+		delete(s.clients, cl)
+		close(cl.send)
+	}
+	s.mu.Unlock()
+	close(s.done)
+}
+
+// Done is closed when the session has ended
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// broadcastLocked queues a frame for every client. s.mu must be held.
+func (s *Session) broadcastLocked(frame Frame) {
+	for cl := range s.clients {
+		select {
+		case cl.send <- frame:
+		default:
+			// Too slow to keep up; it can reattach and replay scrollback
+			delete(s.clients, cl)
+			close(cl.send)
+		}
+	}
+}
+
+// Attach adds a client for a user with access and returns the scrollback
+// to replay before the client's live output
+func (s *Session) Attach(userID uint, username string) (*Client, []byte, error) {
+	if s.Access(userID) == "" {
+		return nil, nil, fmt.Errorf("terminal session not found")
+	}
+	cl := &Client{UserID: userID, Username: username, send: make(chan Frame, 256)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		close(cl.send)
+	default:
+		s.clients[cl] = struct{}{}
+		s.broadcastPresenceLocked()
+	}
+	s.lastActivity = time.Now()
+	return cl, s.scrollback.Bytes(), nil
+}
+
+// Detach removes a client; the shell keeps running
+func (s *Session) Detach(cl *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[cl]; ok {
+		delete(s.clients, cl)
+		close(cl.send)
+		s.broadcastPresenceLocked()
+	}
+	s.lastActivity = time.Now()
+}
+
+// Input sends a client's keystrokes to the shell. Input from read-only
+// viewers is dropped.
+func (s *Session) Input(cl *Client, data []byte) {
+	if !s.CanWrite(cl.UserID) {
+		return
+	}
+	s.mu.Lock()
+	s.lastActivity = time.Now()
+	s.mu.Unlock()
+	s.ptmx.Write(data)
+}
+
+// Resize changes the PTY window size on behalf of a client; read-only
+// viewers can't resize
+func (s *Session) Resize(cl *Client, cols, rows int) {
+	if cols <= 0 || rows <= 0 || !s.CanWrite(cl.UserID) {
+		return
+	}
+	if err := pty.Setsize(s.ptmx, &pty.Winsize{Rows: uint16(rows), Cols: uint16(cols)}); err == nil {
+		s.rec.Resize(cols, rows)
+	}
+}
+
+// Kill terminates the shell. Closing the PTY also hangs up any jobs it
+// started, and ends the read loop.
+func (s *Session) Kill() {
+	_ = s.cmd.Process.Kill()
+	_ = s.ptmx.Close()
+}
+
+func reapLoop() {
+	for {
+		time.Sleep(time.Minute)
+		reapIdle()
+	}
+}
+
+// reapIdle kills sessions that have had no client and no output for longer
+// than the idle timeout, so a detached long-running job is left alone
+func reapIdle() {
+	timeout := config.AppConfig.Terminal.IdleTimeout
+	if timeout <= 0 {
+		return
+	}
+
+	sessionsMu.Lock()
+	var idle []*Session
+	for _, s := range sessions {
+		s.mu.Lock()
+		if len(s.clients) == 0 && time.Since(s.lastActivity) > timeout {
+			idle = append(idle, s)
+		}
+		s.mu.Unlock()
+	}
+	sessionsMu.Unlock()
+
+	for _, s := range idle {
+		log.Printf("Terminal: closing idle session %s (%s)", s.Name, s.Username)
+		s.Kill()
+	}
+}
@@ -0,0 +1,129 @@
+package terminal
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Access levels to a session
+const (
+	ModeOwner = "owner"
+	ModeWrite = "write" // Invited and may type
+	ModeRead  = "read"  // Invited to watch
+)
+
+// Share invites another panel user into a session
+type Share struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Mode     string `json:"mode"`
+}
+
+// Viewer is a user currently attached to a session
+type Viewer struct {
+	Username string `json:"username"`
+	Mode     string `json:"mode"`
+}
+
+type presenceEvent struct {
+	Type    string   `json:"type"`
+	Viewers []Viewer `json:"viewers"`
+}
+
+type revokedEvent struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// Access returns the user's access to the session, or "" for none
+func (s *Session) Access(userID uint) string {
+	if userID == s.UserID {
+		return ModeOwner
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shares[userID].Mode
+}
+
+// CanWrite reports whether the user may type into the session
+func (s *Session) CanWrite(userID uint) bool {
+	mode := s.Access(userID)
+	return mode == ModeOwner || mode == ModeWrite
+}
+
+// Share invites a user, or changes the mode of an existing invite
+func (s *Session) Share(userID uint, username, mode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shares[userID] = Share{UserID: userID, Username: username, Mode: mode}
+	s.broadcastPresenceLocked()
+}
+
+// Unshare withdraws an invite and disconnects the user's clients
+func (s *Session) Unshare(userID uint) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.shares[userID]; !ok {
+		return false
+	}
+	delete(s.shares, userID)
+
+	data, _ := json.Marshal(revokedEvent{Type: "error", Message: "Access to this session was revoked"})
+	for cl := range s.clients {
+		if cl.UserID != userID {
+			continue
+		}
+		select {
+		case cl.send <- Frame{Data: data, Event: true}:
+		default:
+		}
+		delete(s.clients, cl)
+		close(cl.send)
+	}
+	s.broadcastPresenceLocked()
+	return true
+}
+
+// Shares lists the users invited to the session
+func (s *Session) Shares() []Share {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	shares := make([]Share, 0, len(s.shares))
+	for _, share := range s.shares {
+		shares = append(shares, share)
+	}
+	sort.Slice(shares, func(i, j int) bool { return shares[i].Username < shares[j].Username })
+	return shares
+}
+
+// Viewers lists the users attached to the session
+func (s *Session) Viewers() []Viewer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.viewersLocked()
+}
+
+func (s *Session) viewersLocked() []Viewer {
+	seen := make(map[uint]bool)
+	viewers := []Viewer{}
+	for cl := range s.clients {
+		if seen[cl.UserID] {
+			continue
+		}
+		seen[cl.UserID] = true
+		mode := ModeOwner
+		if cl.UserID != s.UserID {
+			mode = s.shares[cl.UserID].Mode
+		}
+		viewers = append(viewers, Viewer{Username: cl.Username, Mode: mode})
+	}
+	sort.Slice(viewers, func(i, j int) bool { return viewers[i].Username < viewers[j].Username })
+	return viewers
+}
+
+// broadcastPresenceLocked tells every client who is attached and with what
+// access. s.mu must be held.
+func (s *Session) broadcastPresenceLocked() {
+	data, _ := json.Marshal(presenceEvent{Type: "presence", Viewers: s.viewersLocked()})
+	s.broadcastLocked(Frame{Data: data, Event: true})
+}
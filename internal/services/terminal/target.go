@@ -0,0 +1,120 @@
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// Target says where a session's shell runs: on the host, optionally as
+// another Unix user and in a given directory, or inside a container
+type Target struct {
+	User      string `json:"user,omitempty"`      // Unix user, or the user inside the container
+	Dir       string `json:"dir,omitempty"`       // Starting directory
+	Container string `json:"container,omitempty"` // Running container name or ID
+}
+
+var (
+	unixUserPattern  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]{0,31}\$?$`)
+	containerPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,127}$`)
+)
+
+// containerShell starts bash when the image has it
+const containerShell = "if command -v bash >/dev/null 2>&1; then exec bash; else exec sh; fi"
+
+// Validate checks the target's fields without touching the system
+func (t Target) Validate() error {
+	if t.User != "" && !unixUserPattern.MatchString(t.User) {
+		return fmt.Errorf("invalid user name")
+	}
+	if t.Container != "" && !containerPattern.MatchString(t.Container) {
+		return fmt.Errorf("invalid container name")
+	}
+	if t.Dir != "" {
+		abs := filepath.IsAbs(t.Dir)
+		if t.Container != "" {
+			abs = path.IsAbs(t.Dir)
+		}
+		if !abs {
+			return fmt.Errorf("directory must be an absolute path")
+		}
+	}
+	return nil
+}
+
+// String describes the target for logs and listings
+func (t Target) String() string {
+	var where string
+	if t.Container != "" {
+		where = "container " + t.Container
+	} else {
+		where = "host"
+	}
+	if t.User != "" {
+		where += " as " + t.User
+	}
+	if t.Dir != "" {
+		where += " in " + t.Dir
+	}
+	return where
+}
+
+// command builds the process to run on the session's PTY
+func (t Target) command() (*exec.Cmd, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+
+	if t.Container != "" {
+		out, err := exec.Command("docker", "inspect", "-f", "{{.State.Running}}", t.Container).Output()
+		if err != nil {
+			return nil, fmt.Errorf("container %s not found", t.Container)
+		}
+		if strings.TrimSpace(string(out)) != "true" {
+			return nil, fmt.Errorf("container %s is not running", t.Container)
+		}
+
+		args := []string{"exec", "-it"}
+		if t.User != "" {
+			args = append(args, "-u", t.User)
+		}
+		if t.Dir != "" {
+			args = append(args, "-w", t.Dir)
+		}
+		args = append(args, t.Container, "sh", "-c", containerShell)
+		return exec.Command("docker", args...), nil
+	}
+
+	if t.Dir != "" {
+		if info, err := os.Stat(t.Dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("directory %s does not exist", t.Dir)
+		}
+	}
+
+	var cmd *exec.Cmd
+	if t.User != "" {
+		if runtime.GOOS == "windows" {
+			return nil, fmt.Errorf("switching user is not supported on Windows")
+		}
+		if _, err := user.Lookup(t.User); err != nil {
+			return nil, fmt.Errorf("unknown user %s", t.User)
+		}
+		// A login shell starts in the user's home; without "-" su keeps
+		// the working directory
+		if t.Dir == "" {
+			cmd = exec.Command("su", "-", t.User)
+		} else {
+			cmd = exec.Command("su", t.User)
+		}
+	} else {
+		cmd = shellCommand()
+	}
+	cmd.Dir = t.Dir
+	return cmd, nil
+}
@@ -6,108 +6,314 @@ import (
 	"time"
 
 	"github.com/gofiber/websocket/v2"
-	"vps-panel/internal/services/monitor"
+	"vps-panel/internal/services/events"
 )
 
+const (
+	// Messages queued per client before it counts as a slow consumer
+	sendBuffer = 16
+	// Time allowed to write one message or ping
+	writeWait = 10 * time.Second
+	// Time allowed between pongs before the peer counts as gone
+	pongWait = 60 * time.Second
+	// Pings are sent well within pongWait
+	pingPeriod = pongWait * 9 / 10
+	// Clients only send small control messages
+	maxMessageSize = 4096
+)
+
+// Conn is the part of a WebSocket connection the hub uses
+type Conn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetReadLimit(limit int64)
+	SetPongHandler(h func(appData string) error)
+	Close() error
+}
+
+// Options configure one connection
+type Options struct {
+	Topics  []string                // Subscribed on connect
+	Allowed func(topic string) bool // Topics the client may subscribe to; nil allows all
+	Raw     bool                    // Send only event data, for single-topic streams such as /ws/stats
+}
+
+// Request is a message from a client changing its subscriptions
+type Request struct {
+	Action string   `json:"action"` // subscribe or unsubscribe
+	Topics []string `json:"topics"`
+}
+
+// Reply answers a Request with the resulting subscriptions
+type Reply struct {
+	Action string   `json:"action"` // subscribed, or error
+	Topics []string `json:"topics"`
+	Denied []string `json:"denied,omitempty"` // Unknown or not permitted
+	Error  string   `json:"error,omitempty"`
+}
+
+// Client is one connection with its own send queue. A single goroutine
+// writes to the connection, so a slow peer only ever delays itself.
+type Client struct {
+	hub       *Hub
+	conn      Conn
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+
+	allowed func(topic string) bool
+	raw     bool
+	topics  map[string]bool // Guarded by hub.mutex
+}
+
+// close stops the writer and closes the connection, which also aborts a
+// write stuck on a peer that stopped reading
+func (c *Client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// Hub multiplexes published events onto client connections by topic
 type Hub struct {
-	clients    map[*websocket.Conn]bool
-	broadcast  chan []byte
-	register   chan *websocket.Conn
-	unregister chan *websocket.Conn
-	mutex      sync.RWMutex
+	clients map[*Client]struct{}
+	mutex   sync.RWMutex
+
+	sendBuffer int
+	writeWait  time.Duration
+	pongWait   time.Duration
+	pingPeriod time.Duration
 }
 
 var WSHub *Hub
 
 func NewHub() *Hub {
 	return &Hub{
-		clients:    make(map[*websocket.Conn]bool),
-		broadcast:  make(chan []byte),
-		register:   make(chan *websocket.Conn),
-		unregister: make(chan *websocket.Conn),
+		clients:    make(map[*Client]struct{}),
+		sendBuffer: sendBuffer,
+		writeWait:  writeWait,
+		pongWait:   pongWait,
+		pingPeriod: pingPeriod,
 	}
 }
 
-func (h *Hub) Run() {
-	go h.broadcastStats()
+// Dispatch queues an event for every client subscribed to its topic
+// without blocking. Clients whose queue is full are evicted. The event is
+// encoded at most once per format, and only when someone listens.
+func (h *Hub) Dispatch(event events.Event) {
+	var envelope, raw []byte
+	var slow []*Client
 
-	for {
-		select {
-		case client := <-h.register:
-			h.mutex.Lock()
-			h.clients[client] = true
-			h.mutex.Unlock()
-
-		case client := <-h.unregister:
-			h.mutex.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				client.Close()
+	h.mutex.RLock()
+	for client := range h.clients {
+		if !client.topics[event.Topic] {
+			continue
+		}
+
+		var message []byte
+		if client.raw {
+			if raw == nil {
+				raw, _ = json.Marshal(event.Data)
 			}
-			h.mutex.Unlock()
-
-		case message := <-h.broadcast:
-			h.mutex.RLock()
-			for client := range h.clients {
-				if err := client.WriteMessage(websocket.TextMessage, message); err != nil {
-					h.mutex.RUnlock()
-					h.unregister <- client
-					h.mutex.RLock()
-				}
+			message = raw
+		} else {
+			if envelope == nil {
+				envelope, _ = json.Marshal(event)
 			}
-			h.mutex.RUnlock()
+			message = envelope
+		}
+		if message == nil {
+			continue
 		}
+
+		select {
+		case client.send <- message:
+		default:
+			slow = append(slow, client)
+		}
+	}
+	h.mutex.RUnlock()
+
+	for _, client := range slow {
+		h.unregister(client)
 	}
 }
 
-func (h *Hub) broadcastStats() {
-	ticker := time.NewTicker(2 * time.Second)
-	defer ticker.Stop()
+// Count returns the number of connected clients
+func (h *Hub) Count() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.clients)
+}
 
-	for range ticker.C {
-		h.mutex.RLock()
-		clientCount := len(h.clients)
-		h.mutex.RUnlock()
+func (h *Hub) register(conn Conn, opts Options) *Client {
+	client := &Client{
+		hub:     h,
+		conn:    conn,
+		send:    make(chan []byte, h.sendBuffer),
+		done:    make(chan struct{}),
+		allowed: opts.Allowed,
+		raw:     opts.Raw,
+		topics:  make(map[string]bool),
+	}
 
-		if clientCount == 0 {
-			continue
-		}
+	h.mutex.Lock()
+	h.clients[client] = struct{}{}
+	h.mutex.Unlock()
 
-		stats, err := monitor.GetSystemStats()
-		if err != nil {
-			continue
-		}
+	if len(opts.Topics) > 0 {
+		h.subscribe(client, opts.Topics)
+	}
+	return client
+}
 
-		data, err := json.Marshal(stats)
-		if err != nil {
+func (h *Hub) unregister(client *Client) {
+	h.mutex.Lock()
+	delete(h.clients, client)
+	h.mutex.Unlock()
+	client.close()
+}
+
+// subscribe adds the topics the client may see and returns the rest
+func (h *Hub) subscribe(client *Client, topics []string) (denied []string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, topic := range topics {
+		if !events.Known(topic) || (client.allowed != nil && !client.allowed(topic)) {
+			denied = append(denied, topic)
 			continue
 		}
+		client.topics[topic] = true
+	}
+	return denied
+}
 
-		h.broadcast <- data
+func (h *Hub) unsubscribe(client *Client, topics []string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, topic := range topics {
+		delete(client.topics, topic)
 	}
 }
 
-func (h *Hub) Register(conn *websocket.Conn) {
-	h.register <- conn
+// Topics returns the client's current subscriptions
+func (h *Hub) Topics(client *Client) []string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	topics := make([]string, 0, len(client.topics))
+	for _, topic := range events.Topics {
+		if client.topics[topic] {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
 }
 
-func (h *Hub) Unregister(conn *websocket.Conn) {
-	h.unregister <- conn
+// Serve registers the connection and blocks until it is gone, either
+// because the peer left, stopped answering pings or fell behind
+func (h *Hub) Serve(conn Conn, opts Options) {
+	client := h.register(conn, opts)
+
+	written := make(chan struct{})
+	go func() {
+		client.writePump()
+		close(written)
+	}()
+
+	client.readPump()
+	h.unregister(client)
+
+	// The connection must not be used once the handler returns
+	<-written
 }
 
-func HandleWebSocket(c *websocket.Conn) {
-	WSHub.Register(c)
-	defer WSHub.Unregister(c)
+// readPump handles subscription requests and keeps the read deadline
+// moving with every pong; it returns once reading fails
+func (c *Client) readPump() {
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(c.hub.pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(c.hub.pongWait))
+	})
 
 	for {
-		_, _, err := c.ReadMessage()
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
-			break
+			return
+		}
+		if c.raw {
+			continue
+		}
+
+		var req Request
+		reply := Reply{Action: "subscribed"}
+		if err := json.Unmarshal(data, &req); err != nil {
+			reply = Reply{Action: "error", Error: "Invalid request"}
+		} else {
+			switch req.Action {
+			case "subscribe":
+				reply.Denied = c.hub.subscribe(c, req.Topics)
+			case "unsubscribe":
+				c.hub.unsubscribe(c, req.Topics)
+			default:
+				reply = Reply{Action: "error", Error: "Unknown action '" + req.Action + "'"}
+			}
+		}
+		if reply.Action == "subscribed" {
+			reply.Topics = c.hub.Topics(c)
+		}
+
+		message, _ := json.Marshal(reply)
+		select {
+		case c.send <- message:
+		default:
+			return
 		}
 	}
 }
 
+// writePump is the only writer of the connection. A failed write
+// unregisters the client, which closes the connection and ends readPump.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(c.hub.pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.hub.unregister(c)
+	}()
+
+	for {
+		select {
+		case <-c.done:
+			return
+
+		case message := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.hub.writeWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// HandleWebSocket streams bare system stats, as /ws/stats always has
+func HandleWebSocket(c *websocket.Conn) {
+	WSHub.Serve(c, Options{
+		Topics:  []string{events.TopicStats},
+		Allowed: func(topic string) bool { return topic == events.TopicStats },
+		Raw:     true,
+	})
+}
+
 func InitHub() {
 	WSHub = NewHub()
-	go WSHub.Run()
+	events.Subscribe(WSHub.Dispatch)
 }
@@ -0,0 +1,402 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+	"vps-panel/internal/services/events"
+)
+
+var errClosed = errors.New("connection closed")
+
+// fakeConn stands in for a browser. Writes can be made to block or fail,
+// and pings are answered unless noPong is set.
+type fakeConn struct {
+	mu           sync.Mutex
+	messages     [][]byte
+	pings        int
+	readDeadline time.Time
+	pong         func(string) error
+
+	block      chan struct{} // WriteMessage waits for this when set
+	failWrites bool
+	noPong     bool
+
+	incoming chan []byte // Messages from the browser
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{incoming: make(chan []byte, 4), closed: make(chan struct{})}
+}
+
+// request sends a subscription request as the browser
+func (f *fakeConn) request(t *testing.T, req Request) {
+	t.Helper()
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.incoming <- data
+}
+
+func (f *fakeConn) ReadMessage() (int, []byte, error) {
+	for {
+		f.mu.Lock()
+		deadline := f.readDeadline
+		f.mu.Unlock()
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return 0, nil, errors.New("read deadline exceeded")
+		}
+
+		select {
+		case <-f.closed:
+			return 0, nil, errClosed
+		case data := <-f.incoming:
+			return websocket.TextMessage, data, nil
+		case <-time.After(2 * time.Millisecond):
+		}
+	}
+}
+
+func (f *fakeConn) WriteMessage(messageType int, data []byte) error {
+	if f.block != nil {
+		select {
+		case <-f.block:
+		case <-f.closed:
+			return errClosed
+		}
+	}
+	if f.failWrites {
+		return errors.New("broken pipe")
+	}
+
+	select {
+	case <-f.closed:
+		return errClosed
+	default:
+	}
+
+	f.mu.Lock()
+	f.messages = append(f.messages, data)
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	select {
+	case <-f.closed:
+		return errClosed
+	default:
+	}
+	if messageType != websocket.PingMessage {
+		return nil
+	}
+
+	f.mu.Lock()
+	f.pings++
+	pong := f.pong
+	f.mu.Unlock()
+	if pong != nil && !f.noPong {
+		return pong("")
+	}
+	return nil
+}
+
+func (f *fakeConn) SetReadDeadline(t time.Time) error {
+	f.mu.Lock()
+	f.readDeadline = t
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func (f *fakeConn) SetReadLimit(limit int64) {}
+
+func (f *fakeConn) SetPongHandler(h func(string) error) {
+	f.mu.Lock()
+	f.pong = h
+	f.mu.Unlock()
+}
+
+func (f *fakeConn) Close() error {
+	f.closeOnce.Do(func() { close(f.closed) })
+	return nil
+}
+
+func (f *fakeConn) received() [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]byte(nil), f.messages...)
+}
+
+// serve runs the hub handler for conn the way the HTTP handler does, as a
+// raw stats stream, and returns a channel closed once it returns
+func serve(h *Hub, conn Conn) <-chan struct{} {
+	return serveWith(h, conn, Options{Topics: []string{events.TopicStats}, Raw: true})
+}
+
+func serveWith(h *Hub, conn Conn, opts Options) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		h.Serve(conn, opts)
+		close(done)
+	}()
+	return done
+}
+
+// broadcast publishes i on the stats topic, which raw clients get as "i"
+func broadcast(h *Hub, i int) {
+	h.Dispatch(events.Event{Topic: events.TopicStats, Data: i})
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func waitClosed(t *testing.T, what string, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestBroadcastReachesEveryClient(t *testing.T) {
+	const clients, messages = 200, 50
+
+	h := NewHub()
+	h.sendBuffer = messages
+
+	conns := make([]*fakeConn, clients)
+	served := make([]<-chan struct{}, clients)
+	for i := range conns {
+		conns[i] = newFakeConn()
+		served[i] = serve(h, conns[i])
+	}
+	waitFor(t, "clients to register", func() bool { return h.Count() == clients })
+
+	for i := 0; i < messages; i++ {
+		broadcast(h, i)
+	}
+
+	for i, conn := range conns {
+		waitFor(t, "messages to be written", func() bool { return len(conn.received()) == messages })
+		for j, msg := range conn.received() {
+			if string(msg) != fmt.Sprint(j) {
+				t.Fatalf("client %d: message %d is %q, want %q", i, j, msg, fmt.Sprint(j))
+			}
+		}
+	}
+
+	for i, conn := range conns {
+		conn.Close()
+		waitClosed(t, "handler to return", served[i])
+	}
+	if n := h.Count(); n != 0 {
+		t.Fatalf("%d clients left after disconnecting", n)
+	}
+}
+
+func TestSlowClientIsEvicted(t *testing.T) {
+	const fast, slow, messages = 100, 5, 40
+
+	h := NewHub()
+	h.sendBuffer = 8
+
+	fastConns := make([]*fakeConn, fast)
+	for i := range fastConns {
+		fastConns[i] = newFakeConn()
+		serve(h, fastConns[i])
+	}
+	slowConns := make([]*fakeConn, slow)
+	slowServed := make([]<-chan struct{}, slow)
+	for i := range slowConns {
+		slowConns[i] = newFakeConn()
+		slowConns[i].block = make(chan struct{}) // Never released
+		slowServed[i] = serve(h, slowConns[i])
+	}
+	waitFor(t, "clients to register", func() bool { return h.Count() == fast+slow })
+
+	for i := 0; i < messages; i++ {
+		start := time.Now()
+		broadcast(h, i)
+		if d := time.Since(start); d > time.Second {
+			t.Fatalf("broadcast blocked for %s", d)
+		}
+
+		// Let fast clients drain so only the stuck ones overflow
+		for _, conn := range fastConns {
+			waitFor(t, "fast client to keep up", func() bool { return len(conn.received()) == i+1 })
+		}
+	}
+
+	for i := range slowConns {
+		waitClosed(t, "slow client to be evicted", slowServed[i])
+	}
+	if n := h.Count(); n != fast {
+		t.Fatalf("%d clients connected, want %d", n, fast)
+	}
+	for _, conn := range fastConns {
+		conn.Close()
+	}
+	waitFor(t, "fast clients to leave", func() bool { return h.Count() == 0 })
+}
+
+func TestWriteErrorRemovesClient(t *testing.T) {
+	h := NewHub()
+
+	broken := newFakeConn()
+	broken.failWrites = true
+	healthy := newFakeConn()
+
+	brokenServed := serve(h, broken)
+	serve(h, healthy)
+	waitFor(t, "clients to register", func() bool { return h.Count() == 2 })
+
+	broadcast(h, 1)
+
+	waitClosed(t, "broken client to be dropped", brokenServed)
+	waitFor(t, "healthy client to get the message", func() bool { return len(healthy.received()) == 1 })
+	if n := h.Count(); n != 1 {
+		t.Fatalf("%d clients connected, want 1", n)
+	}
+	healthy.Close()
+}
+
+func TestPingKeepsClientAlive(t *testing.T) {
+	h := NewHub()
+	h.pongWait = 100 * time.Millisecond
+	h.pingPeriod = 20 * time.Millisecond
+
+	alive := newFakeConn()
+	silent := newFakeConn()
+	silent.noPong = true
+
+	serve(h, alive)
+	silentServed := serve(h, silent)
+
+	waitClosed(t, "client without pongs to time out", silentServed)
+
+	time.Sleep(3 * h.pongWait)
+	if n := h.Count(); n != 1 {
+		t.Fatalf("%d clients connected, want the ponging one", n)
+	}
+	alive.mu.Lock()
+	pings := alive.pings
+	alive.mu.Unlock()
+	if pings == 0 {
+		t.Fatal("no pings sent")
+	}
+	alive.Close()
+}
+
+func TestConcurrentConnectBroadcastDisconnect(t *testing.T) {
+	const workers, rounds = 50, 20
+
+	h := NewHub()
+
+	stop := make(chan struct{})
+	broadcasting := make(chan struct{})
+	go func() {
+		defer close(broadcasting)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				broadcast(h, 0)
+				time.Sleep(100 * time.Microsecond)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				conn := newFakeConn()
+				served := serve(h, conn)
+				time.Sleep(time.Millisecond)
+				conn.Close()
+				<-served
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-broadcasting
+
+	if n := h.Count(); n != 0 {
+		t.Fatalf("%d clients left after all disconnected", n)
+	}
+}
+
+func TestTopicSubscriptions(t *testing.T) {
+	h := NewHub()
+
+	conn := newFakeConn()
+	served := serveWith(h, conn, Options{
+		Topics:  []string{events.TopicCron},
+		Allowed: func(topic string) bool { return topic != events.TopicFiles },
+	})
+	waitFor(t, "client to register", func() bool { return h.Count() == 1 })
+
+	h.Dispatch(events.Event{Topic: events.TopicStats, Data: "stats"})
+	h.Dispatch(events.Event{Topic: events.TopicCron, Data: "cron"})
+	waitFor(t, "cron event", func() bool { return len(conn.received()) == 1 })
+
+	var event struct {
+		Topic string `json:"topic"`
+		Data  string `json:"data"`
+	}
+	if err := json.Unmarshal(conn.received()[0], &event); err != nil || event.Topic != events.TopicCron || event.Data != "cron" {
+		t.Fatalf("got %s, want the cron event", conn.received()[0])
+	}
+
+	conn.request(t, Request{Action: "subscribe", Topics: []string{events.TopicStats, events.TopicFiles, "bogus"}})
+	waitFor(t, "subscribe reply", func() bool { return len(conn.received()) == 2 })
+
+	var reply Reply
+	if err := json.Unmarshal(conn.received()[1], &reply); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(reply.Topics) != fmt.Sprint([]string{events.TopicStats, events.TopicCron}) {
+		t.Fatalf("subscribed to %v", reply.Topics)
+	}
+	if fmt.Sprint(reply.Denied) != fmt.Sprint([]string{events.TopicFiles, "bogus"}) {
+		t.Fatalf("denied %v", reply.Denied)
+	}
+
+	conn.request(t, Request{Action: "unsubscribe", Topics: []string{events.TopicCron}})
+	waitFor(t, "unsubscribe reply", func() bool { return len(conn.received()) == 3 })
+
+	h.Dispatch(events.Event{Topic: events.TopicCron, Data: "cron"})
+	h.Dispatch(events.Event{Topic: events.TopicFiles, Data: "files"})
+	h.Dispatch(events.Event{Topic: events.TopicStats, Data: "stats"})
+	waitFor(t, "stats event", func() bool { return len(conn.received()) == 4 })
+	if err := json.Unmarshal(conn.received()[3], &event); err != nil || event.Topic != events.TopicStats {
+		t.Fatalf("got %s, want the stats event", conn.received()[3])
+	}
+
+	conn.Close()
+	waitClosed(t, "handler to return", served)
+}
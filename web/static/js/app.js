@@ -2,7 +2,7 @@
 
 // Utility functions
 function formatBytes(bytes) {
-    if (bytes === 0) return '0 B';
+    if (bytes < 1) return '0 B';
     const k = 1024;
     const sizes = ['B', 'KB', 'MB', 'GB', 'TB'];
     const i = Math.floor(Math.log(bytes) / Math.log(k));
@@ -52,6 +52,20 @@ async function api(endpoint, options = {}) {
     return response.json();
 }
 
+// Poll a background task until it finishes and return it. onUpdate gets
+// the task each time it is polled.
+async function waitForTask(id, onUpdate) {
+    while (true) {
+        const task = await api(`/tasks/${id}`);
+        if (!task || task.error) {
+            throw new Error((task && task.error) || 'Lost track of the task');
+        }
+        if (onUpdate) onUpdate(task);
+        if (task.finished_at) return task;
+        await new Promise(resolve => setTimeout(resolve, 500));
+    }
+}
+
 // Load user profile
 async function loadProfile() {
     try {
@@ -4,6 +4,7 @@ let cpuChart, memChart;
 let cpuHistory = [];
 let memHistory = [];
 const MAX_HISTORY = 30;
+let chartRange = 'live';
 
 // Initialize charts
 function initCharts() {
@@ -95,13 +96,31 @@ function updateDashboard(stats) {
                     <span>Free: ${formatBytes(d.free)}</span>
                     <span>Total: ${formatBytes(d.total)}</span>
                 </div>
+                ${d.inodes_total ? `<div class="disk-info"><span>Inodes: ${d.inodes_used_percent.toFixed(1)}% used</span></div>` : ''}
             </div>
         `).join('');
     }
 
     // Network
     document.getElementById('netInfo').textContent =
-        `↓ ${formatBytes(stats.network.bytes_recv)} / ↑ ${formatBytes(stats.network.bytes_sent)}`;
+        `↓ ${formatBytes(stats.network.bytes_recv_per_sec)}/s / ↑ ${formatBytes(stats.network.bytes_sent_per_sec)}/s`;
+
+    // Load, swap, disk I/O and sensors
+    const load = stats.load;
+    document.getElementById('loadInfo').textContent =
+        `${load.load1.toFixed(2)} / ${load.load5.toFixed(2)} / ${load.load15.toFixed(2)}`;
+    document.getElementById('swapInfo').textContent = stats.swap.total > 0
+        ? `${formatBytes(stats.swap.used)} / ${formatBytes(stats.swap.total)}`
+        : 'None';
+    const diskIO = stats.disk_io || [];
+    const readRate = diskIO.reduce((sum, d) => sum + d.read_bytes_per_sec, 0);
+    const writeRate = diskIO.reduce((sum, d) => sum + d.write_bytes_per_sec, 0);
+    document.getElementById('diskIOInfo').textContent =
+        `R ${formatBytes(readRate)}/s / W ${formatBytes(writeRate)}/s`;
+    const temps = stats.temperatures || [];
+    document.getElementById('tempInfo').textContent = temps.length > 0
+        ? Math.max(...temps.map(t => t.temperature)).toFixed(0) + ' °C'
+        : 'N/A';
 
     // Host info
     document.getElementById('hostname').textContent = stats.host.hostname;
@@ -120,16 +139,53 @@ function updateDashboard(stats) {
     if (cpuHistory.length > MAX_HISTORY) cpuHistory.shift();
     if (memHistory.length > MAX_HISTORY) memHistory.shift();
 
-    cpuChart.data.datasets[0].data = [...cpuHistory];
-    memChart.data.datasets[0].data = [...memHistory];
+    if (chartRange !== 'live') return;
+    showHistory(Array(MAX_HISTORY).fill(''), cpuHistory, memHistory);
+}
+
+function showHistory(labels, cpu, mem) {
+    cpuChart.data.labels = labels;
+    memChart.data.labels = labels;
+    cpuChart.data.datasets[0].data = [...cpu];
+    memChart.data.datasets[0].data = [...mem];
     cpuChart.update('none');
     memChart.update('none');
 }
 
+// Switch the charts between live samples and stored history
+async function setChartRange(range) {
+    chartRange = range;
+    if (range === 'live') {
+        showHistory(Array(MAX_HISTORY).fill(''), cpuHistory, memHistory);
+        return;
+    }
+
+    const hours = parseInt(range);
+    const from = Math.floor(Date.now() / 1000) - hours * 3600;
+    try {
+        const [cpu, mem] = await Promise.all([
+            api(`/metrics/query?metric=cpu.usage_percent&from=${from}`),
+            api(`/metrics/query?metric=memory.used_percent&from=${from}`)
+        ]);
+        if (chartRange !== range) return;
+        if (!cpu || cpu.error || !mem || mem.error) {
+            console.error('Failed to load history:', (cpu && cpu.error) || (mem && mem.error));
+            return;
+        }
+
+        // Both series share buckets; align memory to the CPU timestamps
+        const memByTime = new Map(mem.points.map(p => [p.time, p.value]));
+        const labels = cpu.points.map(p => new Date(p.time * 1000).toLocaleString());
+        showHistory(labels, cpu.points.map(p => p.value), cpu.points.map(p => memByTime.get(p.time) ?? null));
+    } catch (err) {
+        console.error('Failed to load history:', err);
+    }
+}
+
 // Connect to WebSocket for real-time updates
 function connectWebSocket() {
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-    const ws = new WebSocket(`${protocol}//${window.location.host}/ws/stats`);
+    const ws = new WebSocket(`${protocol}//${window.location.host}/ws/events?topics=stats`);
 
     ws.onopen = () => {
         console.log('WebSocket connected');
@@ -137,8 +193,10 @@ function connectWebSocket() {
 
     ws.onmessage = (event) => {
         try {
-            const stats = JSON.parse(event.data);
-            updateDashboard(stats);
+            const msg = JSON.parse(event.data);
+            if (msg.topic === 'stats') {
+                updateDashboard(msg.data);
+            }
         } catch (err) {
             console.error('Failed to parse stats:', err);
         }